@@ -61,6 +61,25 @@ Fabric_Client.newDefaultKeyValueStore({ path: store_path
                   mspid: 'Org1MSP',
                   cryptoContent: { privateKeyPEM: enrollment.key.toBytes(), signedCertPEM: enrollment.certificate }
               });
+        }).then((user) => {
+          // The chaincode treats identities carrying admin=true as org admins, so the attribute
+          // is added to the admin identity and a certificate carrying it is enrolled
+          return fabric_ca_client.newIdentityService().update('admin', {
+              attrs: [{name: 'admin', value: 'true', ecert: true}]
+          }, user);
+        }).then(() => {
+          return fabric_ca_client.enroll({
+            enrollmentID: 'admin',
+            enrollmentSecret: 'adminpw',
+            attr_reqs: [{name: 'admin', optional: false}]
+          });
+        }).then((enrollment) => {
+          console.log('Successfully enrolled admin user "admin" with the admin attribute');
+          return fabric_client.createUser(
+              {username: 'admin',
+                  mspid: 'Org1MSP',
+                  cryptoContent: { privateKeyPEM: enrollment.key.toBytes(), signedCertPEM: enrollment.certificate }
+              });
         }).then((user) => {
           admin_user = user;
           return fabric_client.setUserContext(admin_user);
@@ -25,6 +25,10 @@ var member_user = null;
 var store_path = path.join(os.homedir(), '.hfc-key-store');
 console.log(' Store path:'+store_path);
 
+// The chaincode only accepts callers whose certificate names the participant they act as
+// usage: node registerUser.js [participantId]
+var participant_id = process.argv[2] || 'DEMO-TRANSPORTER';
+
 // create the key value store as defined in the fabric-client/config/default.json 'key-value-store' setting
 Fabric_Client.newDefaultKeyValueStore({ path: store_path
 }).then((state_store) => {
@@ -55,12 +59,14 @@ Fabric_Client.newDefaultKeyValueStore({ path: store_path
 
     // at this point we should have the admin user
     // first need to register the user with the CA server
-    return fabric_ca_client.register({enrollmentID: 'user1', affiliation: 'org1.department1'}, admin_user);
+    return fabric_ca_client.register({enrollmentID: 'user1', affiliation: 'org1.department1',
+        attrs: [{name: 'participantId', value: participant_id, ecert: true}]}, admin_user);
 }).then((secret) => {
     // next we need to enroll the user with CA server
-    console.log('Successfully registered user1 - secret:'+ secret);
+    console.log('Successfully registered user1 as participant '+ participant_id +' - secret:'+ secret);
 
-    return fabric_ca_client.enroll({enrollmentID: 'user1', enrollmentSecret: secret});
+    return fabric_ca_client.enroll({enrollmentID: 'user1', enrollmentSecret: secret,
+        attr_reqs: [{name: 'participantId', optional: false}]});
 }).then((enrollment) => {
   console.log('Successfully enrolled member user "user1" ');
   return fabric_client.createUser(
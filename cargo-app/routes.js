@@ -11,6 +11,9 @@ module.exports = function(app){
   app.post('/addNewContainer/', jsonParser, function(req, res){
     cargo.addNewContainer(req, res);
   });
+  app.post('/addContainersBatch/', jsonParser, function(req, res){
+    cargo.addContainersBatch(req, res);
+  });
   app.get('/getParticipant/:key', function(req, res){
     cargo.getParticipant(req, res);
   });
@@ -35,6 +38,12 @@ module.exports = function(app){
   app.put('/changeContainerCustody/', jsonParser, function(req, res){
     cargo.changeContainerCustody(req, res);
   });
+  app.put('/updateContainersBatch/', jsonParser, function(req, res){
+    cargo.updateContainersBatch(req, res);
+  });
+  app.put('/changeContainerCustodyBatch/', jsonParser, function(req, res){
+    cargo.changeContainerCustodyBatch(req, res);
+  });
   app.put('/unloadContainerFromCargo/', jsonParser, function(req, res){
     cargo.unloadContainerFromCargo(req, res);
   });
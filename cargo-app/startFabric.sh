@@ -22,11 +22,14 @@ cd ../basic-network
 ./start.sh
 
 # Now launch the CLI container in order to install, instantiate chaincode
-# and prime the ledger with our 10 tuna catches
+# and prime the ledger with the network configuration and the demo dataset
 docker-compose -f ./docker-compose.yml up -d cli
 
+# The configuration is passed to Init as a single JSON string argument
+LEDGER_CONFIG=$(tr -d '\n' < ../chaincode/cargo-app/ledger_config.json | sed 's/"/\\"/g')
+
 docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode install -n cargo-app -v 0.1691 -p github.com/cargo-app
-docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode instantiate -o orderer.example.com:7050 -C mychannel -n cargo-app -v 0.1691 -c '{"Args":[""]}' -P "OR ('Org1MSP.member','Org2MSP.member')"
+docker exec -e "CORE_PEER_LOCALMSPID=Org1MSP" -e "CORE_PEER_MSPCONFIGPATH=/opt/gopath/src/github.com/hyperledger/fabric/peer/crypto/peerOrganizations/org1.example.com/users/Admin@org1.example.com/msp" cli peer chaincode instantiate -o orderer.example.com:7050 -C mychannel -n cargo-app -v 0.1691 -c "{\"Args\":[\"initLedger\",\"${LEDGER_CONFIG}\"]}" -P "OR ('Org1MSP.member','Org2MSP.member')" --collections-config /opt/gopath/src/github.com/cargo-app/collections_config.json
 sleep 10
 
 
@@ -0,0 +1,204 @@
+/*
+ * Archival and deletion:
+ * Once a Cargo has Arrived and its Containers have gone back to their supplier, an admin of the
+ * organisation holding it can archive it. An Archived Cargo is taken out of the organisation index,
+ * so it no longer shows in listing queries, but stays readable with its full history.
+ * Archived Cargo and idle Containers can then be deleted. The key history is kept by the peers
+ * regardless, and a Tombstone records who deleted the record, when and why.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const tombstoneObjectType = "Tombstone"
+
+type Tombstone struct {
+	HashId         string `json:"hashId"`
+	ObjectType     string `json:"objectType"`
+	Reason         string `json:"reason"`
+	SubmitterMspId string `json:"submitterMspId"`
+	SubmitterId    string `json:"submitterId"`
+	DeletedAt      string `json:"deletedAt"`
+	TxnId          string `json:"txnId"`
+	SchemaVersion  int    `json:"schemaVersion"`
+}
+
+func readTombstone(APIstub shim.ChaincodeStubInterface, hashId string) (*Tombstone, string, error) {
+	tombstoneKey, err := APIstub.CreateCompositeKey(tombstoneObjectType, []string{hashId})
+	if err != nil {
+		return nil, "", err
+	}
+	tombstoneAsBytes, err := APIstub.GetState(tombstoneKey)
+	if err != nil || tombstoneAsBytes == nil {
+		return nil, tombstoneKey, err
+	}
+
+	tombstone := Tombstone{}
+	err = unmarshalRecord(tombstoneObjectType, tombstoneAsBytes, &tombstone)
+	return &tombstone, tombstoneKey, err
+}
+
+// deleteRecord deletes a Container or Cargo and leaves a Tombstone in its place.
+func deleteRecord(APIstub shim.ChaincodeStubInterface, objectType string, hashId string, ownerOrganisation string, reason string) error {
+	_, tombstoneKey, err := readTombstone(APIstub, hashId)
+	if err != nil {
+		return err
+	}
+
+	tombstone := Tombstone{HashId: hashId, ObjectType: objectType, Reason: reason, TxnId: APIstub.GetTxID()}
+	if tombstone.SubmitterMspId, err = cid.GetMSPID(APIstub); err != nil {
+		return err
+	}
+	if tombstone.SubmitterId, err = cid.GetID(APIstub); err != nil {
+		return err
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	tombstone.DeletedAt = now.UTC().Format(time.RFC3339)
+
+	if err := moveHolding(APIstub, objectType, hashId, ownerOrganisation, ""); err != nil {
+		return err
+	}
+	if err := APIstub.DelState(hashId); err != nil {
+		return err
+	}
+	return putObject(APIstub, tombstoneKey, tombstone)
+}
+
+// archiveCargo - args: cargoHashId. The Cargo must have Arrived and each of its Containers must have been returned
+// (or moved on to another Cargo, or deleted). Only an admin of the organisation holding the Cargo can archive it.
+func (s *SmartContract) archiveCargo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Arrived" {
+		return shim.Error("Only Arrived Cargo can be archived. Cargo status is " + cargo.Status)
+	}
+	if err := assertOrgAdmin(APIstub, ownerMspId(APIstub, cargo.Owner)); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	for _, containerHashId := range cargo.AssociatedContainerHashIds {
+		containerAsBytes, err := APIstub.GetState(containerHashId)
+		if err != nil {
+			return shim.Error("Failed to get Container: " + err.Error())
+		} else if containerAsBytes == nil {
+			continue
+		}
+		container := Container{}
+		if err := unmarshalRecord("Container", containerAsBytes, &container); err != nil {
+			return shim.Error("Failed to decode Container " + containerHashId + ": " + err.Error())
+		}
+		if container.CargoId == args[0] && container.Status != "Returned" && container.Status != "Available" {
+			return shim.Error("Container " + containerHashId + " has not been returned. Container status is " + container.Status)
+		}
+	}
+
+	if err := moveHolding(APIstub, "Cargo", args[0], cargo.OwnerOrganisation, ""); err != nil {
+		return shim.Error("Failed to update organisation index: " + err.Error())
+	}
+	cargo.Status = "Archived"
+
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// deleteCargo - args: cargoHashId, reason. Only Archived Cargo can be deleted, by an admin of the organisation that held it.
+func (s *SmartContract) deleteCargo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	} else if args[1] == "" {
+		return shim.Error("A reason is required to delete a Cargo")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Archived" {
+		return shim.Error("Only Archived Cargo can be deleted. Cargo status is " + cargo.Status)
+	}
+	if err := assertOrgAdmin(APIstub, ownerMspId(APIstub, cargo.Owner)); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := deleteRecord(APIstub, "Cargo", args[0], cargo.OwnerOrganisation, args[1]); err != nil {
+		return shim.Error("Failed to delete Cargo: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// deleteContainer - args: containerHashId, reason. Only a Container that is not on a trip (Available or Returned) can be deleted,
+// by an admin of the organisation holding it. Its container number becomes free to register again.
+func (s *SmartContract) deleteContainer(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	} else if args[1] == "" {
+		return shim.Error("A reason is required to delete a Container")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if container.Status != "Available" && container.Status != "Returned" {
+		return shim.Error("Only Available or Returned Containers can be deleted. Container status is " + container.Status)
+	}
+	if err := assertOrgAdmin(APIstub, ownerMspId(APIstub, container.Owner)); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if container.ContainerNumber != "" {
+		registeredHashId, numberKey, err := readContainerNumber(APIstub, container.ContainerNumber)
+		if err != nil {
+			return shim.Error("Failed to get container number: " + err.Error())
+		}
+		if registeredHashId == args[0] {
+			if err := APIstub.DelState(numberKey); err != nil {
+				return shim.Error("Failed to release container number: " + err.Error())
+			}
+		}
+	}
+	if err := deleteRecord(APIstub, "Container", args[0], container.OwnerOrganisation, args[1]); err != nil {
+		return shim.Error("Failed to delete Container: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getTombstone - args: hashId of a deleted Cargo or Container
+func (s *SmartContract) getTombstone(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	tombstone, _, err := readTombstone(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get tombstone: " + err.Error())
+	} else if tombstone == nil {
+		return shim.Error("No record has been deleted under " + args[0])
+	}
+
+	tombstoneAsBytes, _ := json.Marshal(tombstone)
+	return shim.Success(tombstoneAsBytes)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestArchiveAndDeleteCargo(t *testing.T) {
+	stub := newTestStub(t)
+	stub.asAdmin(testMspId).mustInvoke("registerOrganisation", "LINE", "Line Shipping", testMspId, "SG", "Transporter", "")
+	stub.asAdmin(testMspId).mustInvoke("registerParticipant", "CARRIER", "Carrier Ltd", "ops@line.example.com", "Transporter", "LINE")
+	stub.seedTestRecord("Container", "C1", "CARRIER", Container{HashId: "C1", Owner: "CARRIER", OwnerOrganisation: "LINE", Status: "Unloaded", CargoId: "CG1"})
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", OwnerOrganisation: "LINE", Status: "Arrived", AssociatedContainerHashIds: []string{"C1", "C9"}})
+
+	holdings := func() []string {
+		t.Helper()
+		var hashIds []string
+		if err := stub.run(func() (err error) { hashIds, err = getHoldings(stub, "LINE", "Cargo"); return err }); err != nil {
+			t.Fatal(err)
+		}
+		return hashIds
+	}
+
+	stub.asAdmin(testMspId).mustFail("Only Archived Cargo can be deleted", "deleteCargo", "CG1", "Retention period over")
+	stub.asAdmin(testMspId).mustFail("Container C1 has not been returned", "archiveCargo", "CG1")
+	// A Container that cannot be decoded must not be taken as returned.
+	if err := stub.run(func() error { return stub.PutState("C1", []byte(`{"hashId":"C1","status":`)) }); err != nil {
+		t.Fatal(err)
+	}
+	stub.asAdmin(testMspId).mustFail("Failed to decode Container C1", "archiveCargo", "CG1")
+	// C9 was deleted before, which does not hold up archival.
+	stub.seedTestRecord("Container", "C1", "", Container{HashId: "C1", Owner: "SUPPLIER", Status: "Returned", CargoId: "CG1"})
+	stub.asAdmin(otherTestMspId).mustFail("Caller is not a member of organisation Org1MSP", "archiveCargo", "CG1")
+	stub.asAdmin(testMspId).mustInvoke("archiveCargo", "CG1")
+
+	var cargo Cargo
+	stub.readTestRecord("CG1", &cargo)
+	if cargo.Status != "Archived" {
+		t.Errorf("cargo is %s, want Archived", cargo.Status)
+	}
+	if hashIds := holdings(); len(hashIds) != 0 {
+		t.Errorf("LINE still lists archived cargo %v", hashIds)
+	}
+
+	stub.asAdmin(testMspId).mustFail("A reason is required", "deleteCargo", "CG1", "")
+	stub.asAdmin(testMspId).mustInvoke("deleteCargo", "CG1", "Retention period over")
+	if stub.State["CG1"] != nil {
+		t.Error("deleted cargo is still in state")
+	}
+
+	var tombstone Tombstone
+	if err := json.Unmarshal(stub.asAdmin(testMspId).mustInvoke("getTombstone", "CG1"), &tombstone); err != nil {
+		t.Fatal(err)
+	}
+	if tombstone.ObjectType != "Cargo" || tombstone.Reason != "Retention period over" || tombstone.SubmitterMspId != testMspId {
+		t.Errorf("tombstone = %+v, want Cargo deleted by %s for the retention period", tombstone, testMspId)
+	}
+}
+
+func TestDeleteContainerReleasesNumber(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+
+	container := func(hashId string, status string) []string {
+		return []string{hashId, "2020-03-01T08:00:00Z", "Maersk", status, "", "CARRIER", "", "Pending", "Mumbai", "Rotterdam", "Mumbai", "CSQU3054383", "22G1", "2200", "28280"}
+	}
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("addNewContainer", container("C1", "Loaded")...)
+	stub.asAdmin(testMspId).mustFail("Only Available or Returned Containers can be deleted", "deleteContainer", "C1", "Scrapped")
+
+	stub.seedTestRecord("Container", "C2", "CARRIER", Container{HashId: "C2", Owner: "CARRIER", Status: "Available"})
+	stub.asAdmin(otherTestMspId).mustFail("Caller is not a member of organisation Org1MSP", "deleteContainer", "C2", "Scrapped")
+	stub.asAdmin(testMspId).mustInvoke("deleteContainer", "C2", "Scrapped")
+
+	// Once C1 goes, its container number can be registered again.
+	stub.asParticipant(testMspId, "CARRIER").mustFail("already registered", "addNewContainer", container("C3", "Available")...)
+	var c1 Container
+	stub.readTestRecord("C1", &c1)
+	c1.Status = "Available"
+	stub.seedTestRecord("Container", "C1", "", c1)
+	stub.asAdmin(testMspId).mustInvoke("deleteContainer", "C1", "Scrapped")
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("addNewContainer", container("C3", "Available")...)
+}
@@ -0,0 +1,146 @@
+/*
+ * As-of queries:
+ * Reconstructs what the ledger said about a Container or Cargo at a point in time from key history,
+ * for audits such as "what did the ledger say about this container on 3 March?". The version
+ * effective at a time is the last one written at or before it; a record deleted by then has none.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// VersionAsOf is the version of a record effective at AsOf. TxId and Value are empty if there was none.
+type VersionAsOf struct {
+	Key           string          `json:"key"`
+	AsOf          string          `json:"asOf"`
+	TxId          string          `json:"txId"`
+	EffectiveFrom string          `json:"effectiveFrom"`
+	Value         json.RawMessage `json:"value"`
+}
+
+// versionAt returns the version of key effective at the given time, or nil if the key did not exist then.
+// Versions are taken in commit order up to the first one stamped after the time, so a backdated version
+// committed later never replaces one committed before it.
+func versionAt(APIstub shim.ChaincodeStubInterface, key string, at time.Time) (*historyVersion, error) {
+	versions, err := readHistory(APIstub, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var effective *historyVersion
+	for i := range versions {
+		if versions[i].At.After(at) {
+			break
+		}
+		effective = &versions[i]
+	}
+	if effective == nil || effective.IsDelete {
+		return nil, nil
+	}
+	return effective, nil
+}
+
+// readVersionAsOf looks up the version of key effective at the given time.
+func readVersionAsOf(APIstub shim.ChaincodeStubInterface, key string, at time.Time) (VersionAsOf, error) {
+	asOf := VersionAsOf{Key: key, AsOf: at.UTC().Format(time.RFC3339Nano)}
+
+	version, err := versionAt(APIstub, key, at)
+	if err != nil || version == nil {
+		return asOf, err
+	}
+	asOf.TxId = version.TxId
+	asOf.EffectiveFrom = version.At.UTC().Format(time.RFC3339Nano)
+	asOf.Value = json.RawMessage(version.Value)
+	return asOf, nil
+}
+
+// getContainerAsOf - args: containerHashId, timestamp (RFC3339)
+func (s *SmartContract) getContainerAsOf(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	at, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("timestamp must be in RFC3339 format: " + err.Error())
+	}
+
+	asOf, err := readVersionAsOf(APIstub, args[0], at)
+	if err != nil {
+		return shim.Error("Failed to get Container history: " + err.Error())
+	} else if asOf.TxId == "" {
+		return shim.Error("Container " + args[0] + " was not on the ledger at " + args[1])
+	}
+
+	asOfAsBytes, _ := json.Marshal(asOf)
+	return shim.Success(asOfAsBytes)
+}
+
+// getCargoAsOf - args: cargoHashId, timestamp (RFC3339)
+func (s *SmartContract) getCargoAsOf(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	at, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("timestamp must be in RFC3339 format: " + err.Error())
+	}
+
+	asOf, err := readVersionAsOf(APIstub, args[0], at)
+	if err != nil {
+		return shim.Error("Failed to get Cargo history: " + err.Error())
+	} else if asOf.TxId == "" {
+		return shim.Error("Cargo " + args[0] + " was not on the ledger at " + args[1])
+	}
+
+	asOfAsBytes, _ := json.Marshal(asOf)
+	return shim.Success(asOfAsBytes)
+}
+
+// getCargoContainersAsOf - args: cargoHashId, timestamp (RFC3339). Returns the Cargo and each of the Containers it held at that time,
+// all as of that time. A Container that was not on the ledger then is listed without a value.
+func (s *SmartContract) getCargoContainersAsOf(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type CargoContainersAsOf struct {
+		Cargo      VersionAsOf   `json:"cargo"`
+		Containers []VersionAsOf `json:"containers"`
+	}
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	at, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("timestamp must be in RFC3339 format: " + err.Error())
+	}
+
+	cargoAsOf, err := readVersionAsOf(APIstub, args[0], at)
+	if err != nil {
+		return shim.Error("Failed to get Cargo history: " + err.Error())
+	} else if cargoAsOf.TxId == "" {
+		return shim.Error("Cargo " + args[0] + " was not on the ledger at " + args[1])
+	}
+	cargo := Cargo{}
+	if err := json.Unmarshal(cargoAsOf.Value, &cargo); err != nil {
+		return shim.Error("Failed to decode Cargo: " + err.Error())
+	}
+
+	result := CargoContainersAsOf{Cargo: cargoAsOf, Containers: []VersionAsOf{}}
+	for _, containerHashId := range cargo.AssociatedContainerHashIds {
+		containerAsOf, err := readVersionAsOf(APIstub, containerHashId, at)
+		if err != nil {
+			return shim.Error("Failed to get Container history: " + err.Error())
+		}
+		result.Containers = append(result.Containers, containerAsOf)
+	}
+
+	resultAsBytes, _ := json.Marshal(result)
+	return shim.Success(resultAsBytes)
+}
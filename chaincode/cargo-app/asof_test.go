@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestGetContainerAsOf(t *testing.T) {
+	stub := newTestStub(t)
+	put := func(key string, record interface{}) {
+		t.Helper()
+		if err := stub.run(func() error { return putObject(stub, key, record) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// tx1 at 08:00 registers the viewer; the Container is written at 08:01 and 08:02 and deleted at 08:03.
+	stub.registerTestParticipant(testMspId, "VIEWER", "Importer")
+	put("C1", Container{HashId: "C1", Status: "Available"})
+	put("C1", Container{HashId: "C1", Status: "Loaded"})
+	if err := stub.run(func() error { return stub.DelState("C1") }); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		at     string
+		txId   string
+		status string
+	}{
+		{"2020-03-01T08:00:59Z", "", ""},
+		{"2020-03-01T08:01:30Z", "tx2", "Available"},
+		{"2020-03-01T08:02:00Z", "tx3", "Loaded"},
+		{"2020-03-01T09:00:00Z", "", ""},
+	}
+	stub.asParticipant(testMspId, "VIEWER")
+	for _, test := range tests {
+		if test.txId == "" {
+			stub.mustFail("Container C1 was not on the ledger at "+test.at, "getContainerAsOf", "C1", test.at)
+			continue
+		}
+		var asOf VersionAsOf
+		if err := json.Unmarshal(stub.mustInvoke("getContainerAsOf", "C1", test.at), &asOf); err != nil {
+			t.Fatal(err)
+		}
+		var container Container
+		json.Unmarshal(asOf.Value, &container)
+		if asOf.TxId != test.txId || container.Status != test.status {
+			t.Errorf("getContainerAsOf(C1, %s) = %s %s, want %s %s", test.at, asOf.TxId, container.Status, test.txId, test.status)
+		}
+	}
+	stub.mustFail("timestamp must be in RFC3339 format", "getContainerAsOf", "C1", "3 March")
+}
+
+func TestGetCargoContainersAsOf(t *testing.T) {
+	stub := newTestStub(t)
+	put := func(key string, record interface{}) {
+		t.Helper()
+		if err := stub.run(func() error { return putObject(stub, key, record) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The Cargo names C2 from 08:02, before C2 is written at 08:03.
+	stub.registerTestParticipant(testMspId, "VIEWER", "Importer")
+	put("C1", Container{HashId: "C1", Status: "InCargo", CargoId: "CG1"})
+	put("CG1", Cargo{HashId: "CG1", Status: "Ready", AssociatedContainerHashIds: []string{"C1", "C2"}})
+	put("C2", Container{HashId: "C2", Status: "InCargo", CargoId: "CG1"})
+
+	tests := []struct {
+		at    string
+		txIds []string
+	}{
+		{"2020-03-01T08:02:30Z", []string{"tx2", ""}},
+		{"2020-03-01T08:03:00Z", []string{"tx2", "tx4"}},
+	}
+	stub.asParticipant(testMspId, "VIEWER")
+	for _, test := range tests {
+		var asOf struct {
+			Cargo      VersionAsOf   `json:"cargo"`
+			Containers []VersionAsOf `json:"containers"`
+		}
+		if err := json.Unmarshal(stub.mustInvoke("getCargoContainersAsOf", "CG1", test.at), &asOf); err != nil {
+			t.Fatal(err)
+		}
+		txIds := []string{}
+		for _, container := range asOf.Containers {
+			txIds = append(txIds, container.TxId)
+		}
+		if asOf.Cargo.TxId != "tx3" || !reflect.DeepEqual(txIds, test.txIds) {
+			t.Errorf("getCargoContainersAsOf(CG1, %s) = cargo %s, containers %v; want cargo tx3, containers %v", test.at, asOf.Cargo.TxId, txIds, test.txIds)
+		}
+	}
+	stub.mustFail("Cargo CG1 was not on the ledger at 2020-03-01T08:01:00Z", "getCargoContainersAsOf", "CG1", "2020-03-01T08:01:00Z")
+}
@@ -0,0 +1,307 @@
+/*
+ * Batch operations:
+ * addContainersBatch, updateContainersBatch and changeContainerCustodyBatch apply the single-item
+ * functions to an array of typed records in one transaction. Every item is validated and reported
+ * on, including against the business rules of the single-item function; if any item fails the
+ * whole batch is rejected, so either all items are written or none are.
+ * Batches are capped at a maximum size (default 100, see setMaxBatchSize) to stay within
+ * transaction size and time limits.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	batchConfigObjectType = "BatchConfig"
+	defaultMaxBatchSize   = 100
+)
+
+// ContainerRecord holds the arguments of addNewContainer. Supplier is optional.
+type ContainerRecord struct {
+	HashId                string `json:"hashId"`
+	Timestamp             string `json:"timestamp"`
+	Manufacturer          string `json:"manufacturer"`
+	Status                string `json:"status"`
+	LoadedItems           string `json:"loadedItems"`
+	Owner                 string `json:"owner"`
+	CargoId               string `json:"cargoId"`
+	CustomClearanceStatus string `json:"customClearanceStatus"`
+	ShippedFrom           string `json:"shippedFrom"`
+	ShippedTo             string `json:"shippedTo"`
+	ContainerLocation     string `json:"containerLocation"`
+	ContainerNumber       string `json:"containerNumber"`
+	SizeTypeCode          string `json:"sizeTypeCode"`
+	TareWeight            string `json:"tareWeight"`
+	MaxPayload            string `json:"maxPayload"`
+	Supplier              string `json:"supplier"`
+}
+
+// ContainerUpdate holds the arguments of updateContainerAttributes. Fields left empty keep their current value.
+type ContainerUpdate struct {
+	HashId                string `json:"hashId"`
+	Timestamp             string `json:"timestamp"`
+	Manufacturer          string `json:"manufacturer"`
+	Status                string `json:"status"`
+	LoadedItems           string `json:"loadedItems"`
+	CustomClearanceStatus string `json:"customClearanceStatus"`
+	ShippedFrom           string `json:"shippedFrom"`
+	ShippedTo             string `json:"shippedTo"`
+	ContainerLocation     string `json:"containerLocation"`
+}
+
+// CustodyChange holds the arguments of changeContainerCustody. SealNumber is optional.
+type CustodyChange struct {
+	HashId     string `json:"hashId"`
+	NewOwner   string `json:"newOwner"`
+	SealNumber string `json:"sealNumber"`
+}
+
+type BatchItemResult struct {
+	Index   int    `json:"index"`
+	HashId  string `json:"hashId"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type BatchReport struct {
+	Total   int               `json:"total"`
+	Failed  int               `json:"failed"`
+	Results []BatchItemResult `json:"results"`
+}
+
+// maxBatchSizeKey is a composite key, so a Container or Cargo cannot have the same hashId.
+func maxBatchSizeKey(APIstub shim.ChaincodeStubInterface) (string, error) {
+	return APIstub.CreateCompositeKey(batchConfigObjectType, []string{"maxBatchSize"})
+}
+
+func readMaxBatchSize(APIstub shim.ChaincodeStubInterface) (int, error) {
+	key, err := maxBatchSizeKey(APIstub)
+	if err != nil {
+		return defaultMaxBatchSize, err
+	}
+	maxBatchSizeAsBytes, err := APIstub.GetState(key)
+	if err != nil || maxBatchSizeAsBytes == nil {
+		return defaultMaxBatchSize, err
+	}
+	return strconv.Atoi(string(maxBatchSizeAsBytes))
+}
+
+// writeMaxBatchSize stores the maximum batch size. Like the role assignments, every organisation with a
+// business role must agree to any later change.
+func writeMaxBatchSize(APIstub shim.ChaincodeStubInterface, maxBatchSize int) error {
+	key, err := maxBatchSizeKey(APIstub)
+	if err != nil {
+		return err
+	}
+	if err := APIstub.PutState(key, []byte(strconv.Itoa(maxBatchSize))); err != nil {
+		return err
+	}
+
+	roleOrganisations, err := readRoleOrganisations(APIstub)
+	if err != nil {
+		return err
+	}
+	return setKeyEndorsementOrgs(APIstub, key, roleMspIds(roleOrganisations)...)
+}
+
+// decodeBatch decodes a JSON array of records, rejecting fields the record type does not have.
+func decodeBatch(value string, records interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(records); err != nil {
+		return fmt.Errorf("Failed to decode batch: %s", err.Error())
+	}
+	return nil
+}
+
+// runBatch applies each item of a batch and reports on all of them. A HashId may only appear once,
+// because a later item would not see what an earlier one wrote in the same transaction.
+func runBatch(APIstub shim.ChaincodeStubInterface, hashIds []string, apply func(i int) sc.Response) sc.Response {
+	maxBatchSize, err := readMaxBatchSize(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get max batch size: " + err.Error())
+	}
+	if len(hashIds) == 0 {
+		return shim.Error("Batch is empty")
+	} else if len(hashIds) > maxBatchSize {
+		return shim.Error(fmt.Sprintf("Batch of %d items exceeds the maximum batch size of %d", len(hashIds), maxBatchSize))
+	}
+
+	report := BatchReport{Total: len(hashIds), Results: []BatchItemResult{}}
+	seen := map[string]bool{}
+	for i, hashId := range hashIds {
+		var response sc.Response
+		if seen[hashId] {
+			response = shim.Error("HashId appears more than once in the batch")
+		} else {
+			seen[hashId] = true
+			response = apply(i)
+		}
+
+		result := BatchItemResult{Index: i, HashId: hashId, Status: "OK"}
+		if response.Status != shim.OK {
+			result.Status = "Failed"
+			result.Message = response.Message
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	reportAsBytes, _ := json.Marshal(report)
+	if report.Failed > 0 {
+		return shim.Error("Batch rejected, no changes were made: " + string(reportAsBytes))
+	}
+	return shim.Success(reportAsBytes)
+}
+
+// addContainersBatch - args: containers (JSON array of ContainerRecord). Registers every Container or none.
+func (s *SmartContract) addContainersBatch(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	var records []ContainerRecord
+	if err := decodeBatch(args[0], &records); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	hashIds := make([]string, len(records))
+	for i, record := range records {
+		hashIds[i] = record.HashId
+	}
+	containerNumbers := map[string]bool{}
+
+	return runBatch(APIstub, hashIds, func(i int) sc.Response {
+		record := records[i]
+		containerNumber := normaliseContainerNumber(record.ContainerNumber)
+		if containerNumbers[containerNumber] {
+			return shim.Error("Container number " + containerNumber + " appears more than once in the batch")
+		}
+		containerNumbers[containerNumber] = true
+
+		addArgs := []string{record.HashId, record.Timestamp, record.Manufacturer, record.Status, record.LoadedItems, record.Owner, record.CargoId, record.CustomClearanceStatus, record.ShippedFrom, record.ShippedTo, record.ContainerLocation, record.ContainerNumber, record.SizeTypeCode, record.TareWeight, record.MaxPayload}
+		if record.Supplier != "" {
+			addArgs = append(addArgs, record.Supplier)
+		}
+		if err := assertRules(APIstub, "addNewContainer", addArgs); err != nil {
+			return shim.Error(err.Error())
+		}
+		return s.addNewContainer(APIstub, addArgs)
+	})
+}
+
+// updateContainersBatch - args: updates (JSON array of ContainerUpdate). Updates every Container or none.
+func (s *SmartContract) updateContainersBatch(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	var updates []ContainerUpdate
+	if err := decodeBatch(args[0], &updates); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	hashIds := make([]string, len(updates))
+	for i, update := range updates {
+		hashIds[i] = update.HashId
+	}
+
+	return runBatch(APIstub, hashIds, func(i int) sc.Response {
+		update := updates[i]
+		container, err := readContainer(APIstub, update.HashId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		updateArgs := []string{update.HashId, update.Timestamp, update.Manufacturer, update.Status, update.LoadedItems, update.CustomClearanceStatus, update.ShippedFrom, update.ShippedTo, update.ContainerLocation}
+		current := []string{container.HashId, container.Timestamp, container.Manufacturer, container.Status, container.LoadedItems, container.CustomClearanceStatus, container.ShippedFrom, container.ShippedTo, container.ContainerLocation}
+		for j := range updateArgs {
+			if updateArgs[j] == "" {
+				updateArgs[j] = current[j]
+			}
+		}
+		if err := assertRules(APIstub, "updateContainerAttributes", updateArgs); err != nil {
+			return shim.Error(err.Error())
+		}
+		return s.updateContainerAttributes(APIstub, updateArgs)
+	})
+}
+
+// changeContainerCustodyBatch - args: changes (JSON array of CustodyChange). Hands over every Container or none.
+func (s *SmartContract) changeContainerCustodyBatch(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	var changes []CustodyChange
+	if err := decodeBatch(args[0], &changes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	hashIds := make([]string, len(changes))
+	for i, change := range changes {
+		hashIds[i] = change.HashId
+	}
+
+	return runBatch(APIstub, hashIds, func(i int) sc.Response {
+		change := changes[i]
+		if _, err := readContainer(APIstub, change.HashId); err != nil {
+			return shim.Error(err.Error())
+		}
+		custodyArgs := []string{change.HashId, change.NewOwner, change.SealNumber}
+		if err := assertRules(APIstub, "changeContainerCustody", custodyArgs); err != nil {
+			return shim.Error(err.Error())
+		}
+		return s.changeContainerCustody(APIstub, custodyArgs)
+	})
+}
+
+// setMaxBatchSize - args: maxBatchSize. Only an org admin can change it and, once business roles are assigned, only an
+// admin of an organisation that plays one. Under governance it changes through proposals instead.
+func (s *SmartContract) setMaxBatchSize(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	maxBatchSize, err := strconv.Atoi(args[0])
+	if err != nil || maxBatchSize < 1 {
+		return shim.Error("Max batch size must be a whole number of at least 1")
+	}
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get caller organisation: " + err.Error())
+	}
+	if err := assertOrgAdmin(APIstub, mspId); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertUngoverned(APIstub, "maxBatchSize"); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	roleOrganisations, err := readRoleOrganisations(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get role organisations: " + err.Error())
+	}
+	if len(roleOrganisations) > 0 && !playsRole(roleOrganisations, mspId) {
+		return shim.Error("Only an organisation that plays a business role can change the max batch size")
+	}
+
+	if err := writeMaxBatchSize(APIstub, maxBatchSize); err != nil {
+		return shim.Error("Failed to record max batch size: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDecodeBatch(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{`[{"hashId":"C1","newOwner":"P2"}]`, false},
+		{`[]`, false},
+		{`[{"hashId":"C1","newOwnr":"P2"}]`, true},
+		{`{"hashId":"C1"}`, true},
+	}
+	for _, test := range tests {
+		var changes []CustodyChange
+		if err := decodeBatch(test.value, &changes); (err != nil) != test.wantErr {
+			t.Errorf("decodeBatch(%s) = %v, wantErr %v", test.value, err, test.wantErr)
+		}
+	}
+}
+
+func TestAddContainersBatch(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+
+	record := func(hashId string, containerNumber string) ContainerRecord {
+		return ContainerRecord{HashId: hashId, Timestamp: "2020-03-01T08:00:00Z", Manufacturer: "Maersk", Status: "Available", Owner: "CARRIER", CustomClearanceStatus: "Pending", ShippedFrom: "Mumbai", ShippedTo: "Rotterdam", ContainerLocation: "Mumbai", ContainerNumber: containerNumber, SizeTypeCode: "22G1", TareWeight: "2200", MaxPayload: "28280"}
+	}
+	batch := func(records ...ContainerRecord) string {
+		recordsAsBytes, _ := json.Marshal(records)
+		return string(recordsAsBytes)
+	}
+
+	tests := []struct {
+		name    string
+		records []ContainerRecord
+		reason  string
+	}{
+		{"empty", []ContainerRecord{}, "Batch is empty"},
+		{"invalid item", []ContainerRecord{record("C1", "CSQU3054383"), record("C2", "MSCU6639871")}, `"index":1,"hashId":"C2","status":"Failed"`},
+		{"repeated HashId", []ContainerRecord{record("C1", "CSQU3054383"), record("C1", "MSCU6639870")}, "HashId appears more than once in the batch"},
+		{"repeated container number", []ContainerRecord{record("C1", "CSQU3054383"), record("C2", "CSQU 305438-3")}, "appears more than once in the batch"},
+	}
+	stub.asParticipant(testMspId, "CARRIER")
+	for _, test := range tests {
+		stub.mustFail(test.reason, "addContainersBatch", batch(test.records...))
+		// A rejected batch writes nothing, not even the items that were valid.
+		if stub.State["C1"] != nil {
+			t.Fatalf("%s: rejected batch wrote C1", test.name)
+		}
+	}
+
+	var report BatchReport
+	if err := json.Unmarshal(stub.mustInvoke("addContainersBatch", batch(record("C1", "CSQU3054383"), record("C2", "MSCU6639870"))), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 2 || report.Failed != 0 || stub.State["C2"] == nil {
+		t.Errorf("report = %+v, want both containers registered", report)
+	}
+
+	stub.mustFail(`"hashId":"C2","status":"Failed","message":"This Container record already exists. HashId: C2"`, "addContainersBatch", batch(record("C2", "MSCU6639870")))
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant CARRIER", "addContainersBatch", batch(record("C3", "TCLU1234560")))
+
+	stub.asAdmin(testMspId).mustInvoke("setMaxBatchSize", "1")
+	stub.asParticipant(testMspId, "CARRIER").mustFail("Batch of 2 items exceeds the maximum batch size of 1", "addContainersBatch", batch(record("C3", "CSQU3054383"), record("C4", "MSCU6639870")))
+}
+
+func TestMaxBatchSize(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	// A Container may be called MaxBatchSize without becoming the batch size.
+	stub.seedTestRecord("Container", "MaxBatchSize", "CARRIER", Container{HashId: "MaxBatchSize", Owner: "CARRIER", Status: "Available"})
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("updateContainersBatch", `[{"hashId":"MaxBatchSize","containerLocation":"Nhava Sheva"}]`)
+
+	stub.asAdmin(testMspId).mustInvoke("setRoleOrganisation", "Transporter", testMspId)
+	stub.asParticipant(testMspId, "CARRIER").mustFail("not an org admin", "setMaxBatchSize", "1")
+	stub.asAdmin(otherTestMspId).mustFail("Only an organisation that plays a business role can change the max batch size", "setMaxBatchSize", "1")
+	stub.asAdmin(testMspId).mustInvoke("setMaxBatchSize", "1")
+
+	var container Container
+	stub.readTestRecord("MaxBatchSize", &container)
+	if maxBatchSize, err := readMaxBatchSize(stub); err != nil || maxBatchSize != 1 || container.ContainerLocation != "Nhava Sheva" {
+		t.Errorf("max batch size = %d (%v) with container at %s, want 1 and Nhava Sheva", maxBatchSize, err, container.ContainerLocation)
+	}
+}
+
+func TestUpdateAndHandOverContainersBatch(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(testMspId, "HAULIER", "Transporter")
+	for _, hashId := range []string{"C1", "C2"} {
+		stub.seedTestRecord("Container", hashId, "CARRIER", Container{HashId: hashId, Owner: "CARRIER", Manufacturer: "Maersk", Status: "Available", ShippedFrom: "Mumbai", ShippedTo: "Rotterdam", ContainerLocation: "Mumbai"})
+	}
+
+	stub.asParticipant(testMspId, "HAULIER").mustFail("Caller is not participant CARRIER", "updateContainersBatch", `[{"hashId":"C1","containerLocation":"Nhava Sheva"}]`)
+	stub.asParticipant(testMspId, "CARRIER")
+	stub.mustFail("Failed to decode batch", "updateContainersBatch", `[{"hashId":"C1","colour":"blue"}]`)
+	stub.mustInvoke("updateContainersBatch", `[{"hashId":"C1","containerLocation":"Nhava Sheva"},{"hashId":"C2","status":"Loaded"}]`)
+
+	var c1, c2 Container
+	stub.readTestRecord("C1", &c1)
+	stub.readTestRecord("C2", &c2)
+	// Fields left empty keep their current value.
+	if c1.ContainerLocation != "Nhava Sheva" || c1.Status != "Available" || c2.Status != "Loaded" || c2.ContainerLocation != "Mumbai" || c2.Manufacturer != "Maersk" {
+		t.Errorf("C1 is %s at %s, C2 is %s at %s by %s; want C1 Available at Nhava Sheva, C2 Loaded at Mumbai by Maersk", c1.Status, c1.ContainerLocation, c2.Status, c2.ContainerLocation, c2.Manufacturer)
+	}
+
+	handovers := `[{"hashId":"C1","newOwner":"HAULIER"},{"hashId":"C2","newOwner":"HAULIER"}]`
+	stub.asParticipant(testMspId, "HAULIER").mustFail("Caller is not participant CARRIER", "changeContainerCustodyBatch", handovers)
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("changeContainerCustodyBatch", handovers)
+	stub.readTestRecord("C1", &c1)
+	stub.readTestRecord("C2", &c2)
+	if c1.Owner != "HAULIER" || c2.Owner != "HAULIER" {
+		t.Errorf("containers are held by %s and %s, want HAULIER", c1.Owner, c2.Owner)
+	}
+}
@@ -0,0 +1,299 @@
+/*
+ * Electronic Bill of Lading (eBL):
+ * The carrier issues a bill of lading for a Cargo, the holder endorses it on to the
+ * next party, and the final holder surrenders it at destination to release the containers.
+ * The holder endorsing or surrendering the bill is the participant named by the caller's certificate.
+ * The bill carries title, not custody: carriers and terminals hand the Cargo over as usual while it is
+ * outstanding, but only the holder can surrender it and then unload the containers.
+ * Bill of Lading States --> Issued, Surrendered.
+ * Endorsement Types --> To Order (endorsee may endorse further), Named (endorsee is the final holder).
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const billOfLadingObjectType = "BillOfLading"
+
+// BillOfLading is the title document for a Cargo. Holder is the participant currently entitled to the goods.
+type BillOfLading struct {
+	BlNumber      string        `json:"blNumber"`
+	CargoId       string        `json:"cargoId"`
+	Carrier       string        `json:"carrier"`
+	Shipper       string        `json:"shipper"`
+	Consignee     string        `json:"consignee"`
+	Negotiable    bool          `json:"negotiable"`
+	Holder        string        `json:"holder"`
+	Status        string        `json:"status"`
+	IssuedAt      string        `json:"issuedAt"`
+	SurrenderedAt string        `json:"surrenderedAt"`
+	Endorsements  []Endorsement `json:"endorsements"`
+	SchemaVersion int           `json:"schemaVersion"`
+}
+
+// Endorsement records one transfer of the bill of lading from one holder to the next.
+type Endorsement struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Type      string `json:"type"`
+	TxnId     string `json:"txnId"`
+	Timestamp string `json:"timestamp"`
+}
+
+func readBillOfLading(APIstub shim.ChaincodeStubInterface, blNumber string) (BillOfLading, string, error) {
+	bill := BillOfLading{}
+
+	billKey, err := APIstub.CreateCompositeKey(billOfLadingObjectType, []string{blNumber})
+	if err != nil {
+		return bill, "", err
+	}
+	billAsBytes, err := APIstub.GetState(billKey)
+	if err != nil {
+		return bill, billKey, err
+	} else if billAsBytes == nil {
+		return bill, billKey, nil
+	}
+
+	err = unmarshalRecord(billOfLadingObjectType, billAsBytes, &bill)
+	return bill, billKey, err
+}
+
+// issueBillOfLading - args: blNumber, cargoHashId, carrier, shipper, consignee, toOrder (true/false), timestamp. The caller must be the carrier,
+// and the carrier must hold the Cargo or operate the Voyage it is assigned to.
+func (s *SmartContract) issueBillOfLading(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 7 {
+		return shim.Error("Incorrect number of arguments. Expecting 7")
+	}
+
+	toOrder, err := strconv.ParseBool(args[5])
+	if err != nil {
+		return shim.Error("toOrder must be true or false: " + err.Error())
+	}
+
+	bill, billKey, err := readBillOfLading(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get Bill of Lading: " + err.Error())
+	} else if bill.BlNumber != "" {
+		return shim.Error("This Bill of Lading already exists. BlNumber: " + args[0])
+	}
+
+	cargo, err := readCargo(APIstub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.BillOfLading != "" {
+		return shim.Error("Cargo already has a Bill of Lading. BlNumber: " + cargo.BillOfLading)
+	}
+
+	carrier, err := readParticipant(APIstub, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if carrier.Role != "Transporter" {
+		return shim.Error("Bill of Lading can only be issued by a Transporter")
+	}
+	if err := assertCallerActsFor(APIstub, args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if args[2] != cargo.Owner {
+		voyageCarrier := ""
+		if cargo.VoyageId != "" {
+			voyage, _, err := readVoyage(APIstub, cargo.VoyageId)
+			if err != nil {
+				return shim.Error("Failed to get Voyage: " + err.Error())
+			} else if voyage != nil {
+				voyageCarrier = voyage.Carrier
+			}
+		}
+		if args[2] != voyageCarrier {
+			return shim.Error(args[2] + " is neither the owner of Cargo " + args[1] + " nor the carrier of its Voyage")
+		}
+	}
+	for _, hashId := range args[3:5] {
+		if _, err := readParticipant(APIstub, hashId); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+	if err := assertNotSuspended(APIstub, args[2:5]...); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bill = BillOfLading{BlNumber: args[0], CargoId: args[1], Carrier: args[2], Shipper: args[3], Consignee: args[4], Negotiable: toOrder, Holder: args[3], Status: "Issued", IssuedAt: args[6], Endorsements: []Endorsement{}}
+
+	if err := putObject(APIstub, billKey, bill); err != nil {
+		return shim.Error("Failed to record Bill of Lading: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, billKey, ownerMspId(APIstub, bill.Holder)); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	cargo.BillOfLading = args[0]
+	if err := putObject(APIstub, args[1], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// endorseBillOfLading - args: blNumber, endorsee, endorsementType (To Order/Named), timestamp. The caller must be the current holder.
+func (s *SmartContract) endorseBillOfLading(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	holder, err := callerParticipant(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bill, billKey, err := readBillOfLading(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get Bill of Lading: " + err.Error())
+	} else if bill.BlNumber == "" {
+		return shim.Error("Bill of Lading does not exist. BlNumber: " + args[0])
+	}
+
+	if bill.Status != "Issued" {
+		return shim.Error("Bill of Lading is " + bill.Status + " and can no longer be endorsed")
+	} else if bill.Holder != holder.HashId {
+		return shim.Error("Only the current holder can endorse the Bill of Lading")
+	} else if args[1] == bill.Holder {
+		return shim.Error("Bill of Lading cannot be endorsed to its current holder")
+	}
+
+	if _, err := readParticipant(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	switch args[2] {
+	case "To Order":
+		if !bill.Negotiable {
+			return shim.Error("Bill of Lading is not negotiable")
+		}
+	case "Named":
+		// A straight bill can only ever pass to its consignee.
+		if !bill.Negotiable && args[1] != bill.Consignee {
+			return shim.Error("Bill of Lading is not negotiable and can only be endorsed to the consignee")
+		}
+		bill.Negotiable = false
+	default:
+		return shim.Error("Invalid endorsement type. Expecting To Order or Named")
+	}
+
+	bill.Endorsements = append(bill.Endorsements, Endorsement{From: holder.HashId, To: args[1], Type: args[2], TxnId: APIstub.GetTxID(), Timestamp: args[3]})
+	bill.Holder = args[1]
+
+	if err := putObject(APIstub, billKey, bill); err != nil {
+		return shim.Error("Failed to record endorsement: " + err.Error())
+	}
+	// Only the new holder's organisation can endorse the bill from here on.
+	if err := setKeyEndorsementOrgs(APIstub, billKey, ownerMspId(APIstub, bill.Holder)); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// surrenderBillOfLading - args: blNumber, timestamp. The caller must be the current holder.
+func (s *SmartContract) surrenderBillOfLading(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	holder, err := callerParticipant(APIstub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	bill, billKey, err := readBillOfLading(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get Bill of Lading: " + err.Error())
+	} else if bill.BlNumber == "" {
+		return shim.Error("Bill of Lading does not exist. BlNumber: " + args[0])
+	}
+
+	if bill.Status != "Issued" {
+		return shim.Error("Bill of Lading is already " + bill.Status)
+	} else if bill.Holder != holder.HashId {
+		return shim.Error("Only the current holder can surrender the Bill of Lading")
+	}
+
+	cargo, err := readCargo(APIstub, bill.CargoId)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Arrived" {
+		return shim.Error("Bill of Lading can only be surrendered once the Cargo has Arrived")
+	}
+
+	bill.Status = "Surrendered"
+	bill.SurrenderedAt = args[1]
+
+	if err := putObject(APIstub, billKey, bill); err != nil {
+		return shim.Error("Failed to surrender Bill of Lading: " + err.Error())
+	}
+
+	// Title has passed to the holder, so release the cargo and its containers to them.
+	holderOrg := ownerMspId(APIstub, bill.Holder)
+
+	cargo.OwnerOrganisation, err = updateHolding(APIstub, "Cargo", bill.CargoId, cargo.OwnerOrganisation, bill.Holder)
+	if err != nil {
+		return shim.Error("Failed to update organisation index: " + err.Error())
+	}
+	cargo.Owner = bill.Holder
+	cargo.PendingOwner = ""
+	if err := putObject(APIstub, bill.CargoId, cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, bill.CargoId, holderOrg); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	for _, containerHashId := range cargo.AssociatedContainerHashIds {
+		container, err := readContainer(APIstub, containerHashId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		container.OwnerOrganisation, err = updateHolding(APIstub, "Container", containerHashId, container.OwnerOrganisation, bill.Holder)
+		if err != nil {
+			return shim.Error("Failed to update organisation index: " + err.Error())
+		}
+		container.Owner = bill.Holder
+		container.PendingOwner = ""
+		if err := putObject(APIstub, containerHashId, container); err != nil {
+			return shim.Error("Failed to update Container: " + err.Error())
+		}
+		if err := setKeyEndorsementOrgs(APIstub, containerHashId, holderOrg); err != nil {
+			return shim.Error("Failed to set endorsement policy: " + err.Error())
+		}
+	}
+
+	return shim.Success(nil)
+}
+
+// getBillOfLading - args: blNumber. Returns the bill with its full endorsement chain.
+func (s *SmartContract) getBillOfLading(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	bill, _, err := readBillOfLading(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get Bill of Lading: " + err.Error())
+	} else if bill.BlNumber == "" {
+		return shim.Error("Bill of Lading does not exist. BlNumber: " + args[0])
+	}
+
+	billAsBytes, _ := json.Marshal(bill)
+	return shim.Success(billAsBytes)
+}
@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestBillOfLadingHolderIsCaller(t *testing.T) {
+	stub := newTestStub(t)
+	for hashId, role := range map[string]string{"CARRIER": "Transporter", "SHIPPER": "Exporter", "BANK": "Importer", "CONSIGNEE": "Importer"} {
+		stub.registerTestParticipant(testMspId, hashId, role)
+	}
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", Status: "In-Transit", AssociatedContainerHashIds: []string{}})
+
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("not participant CARRIER", "issueBillOfLading", "BL1", "CG1", "CARRIER", "SHIPPER", "CONSIGNEE", "true", "2020-03-01T00:00:00Z")
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("issueBillOfLading", "BL1", "CG1", "CARRIER", "SHIPPER", "CONSIGNEE", "true", "2020-03-01T00:00:00Z")
+
+	tests := []struct {
+		caller  string
+		args    []string
+		wantErr string
+	}{
+		{"CARRIER", []string{"BL1", "CARRIER", "To Order", "2020-03-02T00:00:00Z"}, "Only the current holder"},
+		{"SHIPPER", []string{"BL1", "BANK", "To Order", "2020-03-02T00:00:00Z"}, ""},
+		{"SHIPPER", []string{"BL1", "CONSIGNEE", "Named", "2020-03-03T00:00:00Z"}, "Only the current holder"},
+		{"BANK", []string{"BL1", "CONSIGNEE", "Sideways", "2020-03-03T00:00:00Z"}, "Invalid endorsement type"},
+		{"BANK", []string{"BL1", "CONSIGNEE", "Named", "2020-03-03T00:00:00Z"}, ""},
+		{"CONSIGNEE", []string{"BL1", "BANK", "To Order", "2020-03-04T00:00:00Z"}, "not negotiable"},
+	}
+	for _, test := range tests {
+		stub.asParticipant(testMspId, test.caller)
+		if test.wantErr == "" {
+			stub.mustInvoke("endorseBillOfLading", test.args...)
+		} else {
+			stub.mustFail(test.wantErr, "endorseBillOfLading", test.args...)
+		}
+	}
+
+	stub.asParticipant(testMspId, "CONSIGNEE").mustFail("once the Cargo has Arrived", "surrenderBillOfLading", "BL1", "2020-03-20T00:00:00Z")
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", OwnerOrganisation: "", Status: "Arrived", BillOfLading: "BL1", AssociatedContainerHashIds: []string{}})
+	stub.asParticipant(testMspId, "BANK").mustFail("Only the current holder", "surrenderBillOfLading", "BL1", "2020-03-20T00:00:00Z")
+	stub.asParticipant(testMspId, "CONSIGNEE").mustInvoke("surrenderBillOfLading", "BL1", "2020-03-20T00:00:00Z")
+
+	var cargo Cargo
+	stub.readTestRecord("CG1", &cargo)
+	if cargo.Owner != "CONSIGNEE" {
+		t.Errorf("Cargo owner after surrender = %s, want CONSIGNEE", cargo.Owner)
+	}
+}
+
+func TestIssueBillOfLadingCarrier(t *testing.T) {
+	stub := newTestStub(t)
+	for hashId, role := range map[string]string{"CARRIER": "Transporter", "OTHER-CARRIER": "Transporter", "SHIPPER": "Exporter", "CONSIGNEE": "Importer"} {
+		stub.registerTestParticipant(testMspId, hashId, role)
+	}
+	stub.seedTestRecord("Cargo", "CG1", "SHIPPER", Cargo{HashId: "CG1", Owner: "SHIPPER", Status: "Ready", ShippedFrom: "Mumbai", ShippedTo: "Rotterdam", AssociatedContainerHashIds: []string{}})
+
+	stub.asParticipant(testMspId, "OTHER-CARRIER").mustFail("neither the owner of Cargo CG1 nor the carrier of its Voyage", "issueBillOfLading", "BL1", "CG1", "OTHER-CARRIER", "SHIPPER", "CONSIGNEE", "true", "2020-03-01T00:00:00Z")
+
+	portCalls := `[{"port":"Mumbai","plannedEtd":"2020-03-02T00:00:00Z"},{"port":"Rotterdam","plannedEta":"2020-03-20T00:00:00Z"}]`
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("createVoyage", "V1", "CARRIER", "Sea", "IMO9074729", portCalls)
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("assignCargoToVoyage", "CG1", "V1")
+
+	stub.asParticipant(testMspId, "OTHER-CARRIER").mustFail("neither the owner of Cargo CG1 nor the carrier of its Voyage", "issueBillOfLading", "BL1", "CG1", "OTHER-CARRIER", "SHIPPER", "CONSIGNEE", "true", "2020-03-01T00:00:00Z")
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("issueBillOfLading", "BL1", "CG1", "CARRIER", "SHIPPER", "CONSIGNEE", "true", "2020-03-01T00:00:00Z")
+}
+
+func TestBillOfLadingTitleNotCustody(t *testing.T) {
+	stub := newTestStub(t)
+	for hashId, role := range map[string]string{"CARRIER": "Transporter", "FEEDER": "Transporter", "SHIPPER": "Exporter", "CONSIGNEE": "Importer"} {
+		stub.registerTestParticipant(testMspId, hashId, role)
+	}
+	stub.seedTestRecord("Container", "C1", "CARRIER", Container{HashId: "C1", Owner: "CARRIER", Status: "InCargo", CargoId: "CG1"})
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", Status: "In-Transit", AssociatedContainerHashIds: []string{"C1"}})
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("issueBillOfLading", "BL1", "CG1", "CARRIER", "SHIPPER", "CONSIGNEE", "false", "2020-03-01T00:00:00Z")
+
+	// Physical custody can move between carriers while the bill is outstanding; title stays with the holder.
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("changeCargoCustody", "CG1", "FEEDER")
+	stub.seedTestRecord("Cargo", "CG1", "FEEDER", Cargo{HashId: "CG1", Owner: "FEEDER", Status: "Arrived", BillOfLading: "BL1", AssociatedContainerHashIds: []string{"C1"}})
+	stub.asParticipant(testMspId, "FEEDER").mustFail("must be surrendered before unloading", "unloadContainerFromCargo", "CG1", "C1")
+	stub.asParticipant(testMspId, "FEEDER").mustFail("Only the current holder", "surrenderBillOfLading", "BL1", "2020-03-20T00:00:00Z")
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("endorseBillOfLading", "BL1", "CONSIGNEE", "Named", "2020-03-10T00:00:00Z")
+	stub.asParticipant(testMspId, "CONSIGNEE").mustInvoke("surrenderBillOfLading", "BL1", "2020-03-20T00:00:00Z")
+
+	// Once the bill is surrendered only its holder can take the containers off.
+	stub.seedTestRecord("Cargo", "CG1", "FEEDER", Cargo{HashId: "CG1", Owner: "FEEDER", Status: "Arrived", BillOfLading: "BL1", AssociatedContainerHashIds: []string{"C1"}})
+	stub.asParticipant(testMspId, "FEEDER").mustFail("not participant CONSIGNEE", "unloadContainerFromCargo", "CG1", "C1")
+	stub.asParticipant(testMspId, "CONSIGNEE").mustInvoke("unloadContainerFromCargo", "CG1", "C1")
+}
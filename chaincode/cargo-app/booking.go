@@ -0,0 +1,302 @@
+/*
+ * Bookings:
+ * A shipper books space with a Transporter for a route, asking for a number of containers of each
+ * ISO 6346 size/type (e.g. {"22G1":2,"45R1":1}) between requested dates. The Transporter confirms
+ * the booking with the capacity it allocates, and every Cargo must be created against a confirmed
+ * booking without using more containers of any type than were allocated.
+ * Booking States --> Requested, Confirmed, Rejected, Cancelled.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const bookingObjectType = "Booking"
+
+type Booking struct {
+	BookingId           string         `json:"bookingId"`
+	Shipper             string         `json:"shipper"`
+	Transporter         string         `json:"transporter"`
+	ShippedFrom         string         `json:"shippedFrom"`
+	ShippedTo           string         `json:"shippedTo"`
+	RequestedContainers map[string]int `json:"requestedContainers"`
+	RequestedDeparture  string         `json:"requestedDeparture"`
+	RequestedArrival    string         `json:"requestedArrival"`
+	AllocatedContainers map[string]int `json:"allocatedContainers"`
+	UsedContainers      map[string]int `json:"usedContainers"`
+	CargoIds            []string       `json:"cargoIds"`
+	Status              string         `json:"status"`
+	Reason              string         `json:"reason"`
+	SchemaVersion       int            `json:"schemaVersion"`
+}
+
+func readBooking(APIstub shim.ChaincodeStubInterface, bookingId string) (*Booking, string, error) {
+	bookingKey, err := APIstub.CreateCompositeKey(bookingObjectType, []string{bookingId})
+	if err != nil {
+		return nil, "", err
+	}
+	bookingAsBytes, err := APIstub.GetState(bookingKey)
+	if err != nil || bookingAsBytes == nil {
+		return nil, bookingKey, err
+	}
+
+	booking := Booking{}
+	err = unmarshalRecord(bookingObjectType, bookingAsBytes, &booking)
+	return &booking, bookingKey, err
+}
+
+// parseContainerCounts decodes a JSON object of size/type code to number of containers.
+func parseContainerCounts(value string) (map[string]int, error) {
+	counts := map[string]int{}
+	if err := json.Unmarshal([]byte(value), &counts); err != nil {
+		return nil, fmt.Errorf("Failed to decode container counts: %s", err.Error())
+	}
+	for sizeTypeCode, count := range counts {
+		if !sizeTypeCodePattern.MatchString(sizeTypeCode) {
+			return nil, fmt.Errorf("Size/type code %s is not an ISO 6346 code such as 22G1 or 45R1", sizeTypeCode)
+		} else if count < 0 {
+			return nil, fmt.Errorf("Container count for %s cannot be negative", sizeTypeCode)
+		}
+	}
+	return counts, nil
+}
+
+// useBookingCapacity checks a new Cargo against its booking and records the containers it uses.
+func useBookingCapacity(APIstub shim.ChaincodeStubInterface, bookingId string, cargo Cargo) error {
+	booking, bookingKey, err := readBooking(APIstub, bookingId)
+	if err != nil {
+		return fmt.Errorf("Failed to get booking: %s", err.Error())
+	} else if booking == nil {
+		return fmt.Errorf("Booking does not exist. BookingId: %s", bookingId)
+	} else if booking.Status != "Confirmed" {
+		return fmt.Errorf("Booking %s is %s, not Confirmed", bookingId, booking.Status)
+	} else if booking.Transporter != cargo.Owner {
+		return fmt.Errorf("Booking %s was confirmed by %s, not %s", bookingId, booking.Transporter, cargo.Owner)
+	} else if booking.ShippedFrom != cargo.ShippedFrom || booking.ShippedTo != cargo.ShippedTo {
+		return fmt.Errorf("Cargo route %s to %s does not match booking %s", cargo.ShippedFrom, cargo.ShippedTo, bookingId)
+	}
+
+	for _, containerHashId := range cargo.AssociatedContainerHashIds {
+		container, err := readContainer(APIstub, containerHashId)
+		if err != nil {
+			return err
+		}
+		booking.UsedContainers[container.SizeTypeCode]++
+		if booking.UsedContainers[container.SizeTypeCode] > booking.AllocatedContainers[container.SizeTypeCode] {
+			return fmt.Errorf("Booking %s has no capacity left for another %s container (%s)", bookingId, container.SizeTypeCode, containerHashId)
+		}
+	}
+	booking.CargoIds = append(booking.CargoIds, cargo.HashId)
+
+	return putObject(APIstub, bookingKey, booking)
+}
+
+// sameHashIds reports whether two lists name the same HashIds, in any order.
+func sameHashIds(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := map[string]int{}
+	for _, hashId := range a {
+		counts[hashId]++
+	}
+	for _, hashId := range b {
+		if counts[hashId] == 0 {
+			return false
+		}
+		counts[hashId]--
+	}
+	return true
+}
+
+// requestBooking - args: bookingId, shipper, transporter, shippedFrom, shippedTo, containers (JSON, e.g. {"22G1":2}), requestedDeparture, requestedArrival (RFC3339)
+func (s *SmartContract) requestBooking(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 8 {
+		return shim.Error("Incorrect number of arguments. Expecting 8")
+	}
+
+	booking, bookingKey, err := readBooking(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get booking: " + err.Error())
+	} else if booking != nil {
+		return shim.Error("This Booking already exists. BookingId: " + args[0])
+	}
+
+	requestedContainers, err := parseContainerCounts(args[5])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if len(requestedContainers) == 0 {
+		return shim.Error("A booking must request at least one container")
+	}
+	departure, err := time.Parse(time.RFC3339, args[6])
+	if err != nil {
+		return shim.Error("requestedDeparture must be in RFC3339 format: " + err.Error())
+	}
+	arrival, err := time.Parse(time.RFC3339, args[7])
+	if err != nil {
+		return shim.Error("requestedArrival must be in RFC3339 format: " + err.Error())
+	} else if !arrival.After(departure) {
+		return shim.Error("requestedArrival must be after requestedDeparture")
+	}
+
+	if _, err := readParticipant(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	transporter, err := readParticipant(APIstub, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if transporter.Role != "Transporter" {
+		return shim.Error("Participant " + args[2] + " is not a Transporter")
+	}
+	if err := assertNotSuspended(APIstub, args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	booking = &Booking{BookingId: args[0], Shipper: args[1], Transporter: args[2], ShippedFrom: args[3], ShippedTo: args[4], RequestedContainers: requestedContainers, RequestedDeparture: args[6], RequestedArrival: args[7], AllocatedContainers: map[string]int{}, UsedContainers: map[string]int{}, CargoIds: []string{}, Status: "Requested"}
+
+	if err := putObject(APIstub, bookingKey, booking); err != nil {
+		return shim.Error("Failed to record booking: " + err.Error())
+	}
+	// Both parties have to endorse any later change to the booking.
+	if err := setKeyEndorsementOrgs(APIstub, bookingKey, ownerMspId(APIstub, args[1]), transporter.MspId); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// confirmBooking - args: bookingId, transporter, allocation (JSON, containers allocated per size/type, at most those requested)
+func (s *SmartContract) confirmBooking(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	booking, bookingKey, err := readBooking(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get booking: " + err.Error())
+	} else if booking == nil {
+		return shim.Error("Booking does not exist. BookingId: " + args[0])
+	} else if booking.Status != "Requested" {
+		return shim.Error("Only Requested bookings can be confirmed. Booking is " + booking.Status)
+	} else if booking.Transporter != args[1] {
+		return shim.Error("Only the booked Transporter can confirm a booking")
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	allocation, err := parseContainerCounts(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for sizeTypeCode, count := range allocation {
+		if count > booking.RequestedContainers[sizeTypeCode] {
+			return shim.Error(fmt.Sprintf("Cannot allocate %d %s containers; %d were requested", count, sizeTypeCode, booking.RequestedContainers[sizeTypeCode]))
+		}
+	}
+
+	booking.AllocatedContainers = allocation
+	booking.Status = "Confirmed"
+
+	if err := putObject(APIstub, bookingKey, booking); err != nil {
+		return shim.Error("Failed to update booking: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// rejectBooking - args: bookingId, transporter, reason
+func (s *SmartContract) rejectBooking(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	booking, bookingKey, err := readBooking(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get booking: " + err.Error())
+	} else if booking == nil {
+		return shim.Error("Booking does not exist. BookingId: " + args[0])
+	} else if booking.Status != "Requested" {
+		return shim.Error("Only Requested bookings can be rejected. Booking is " + booking.Status)
+	} else if booking.Transporter != args[1] {
+		return shim.Error("Only the booked Transporter can reject a booking")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	booking.Status = "Rejected"
+	booking.Reason = args[2]
+
+	if err := putObject(APIstub, bookingKey, booking); err != nil {
+		return shim.Error("Failed to update booking: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// cancelBooking - args: bookingId, shipper, reason. A booking can be cancelled until a Cargo has been created against it.
+func (s *SmartContract) cancelBooking(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	booking, bookingKey, err := readBooking(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get booking: " + err.Error())
+	} else if booking == nil {
+		return shim.Error("Booking does not exist. BookingId: " + args[0])
+	} else if booking.Status != "Requested" && booking.Status != "Confirmed" {
+		return shim.Error("Booking is already " + booking.Status)
+	} else if len(booking.CargoIds) > 0 {
+		return shim.Error("Booking is in use by Cargo and cannot be cancelled")
+	} else if booking.Shipper != args[1] {
+		return shim.Error("Only the shipper can cancel a booking")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	booking.Status = "Cancelled"
+	booking.Reason = args[2]
+
+	if err := putObject(APIstub, bookingKey, booking); err != nil {
+		return shim.Error("Failed to update booking: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+func (s *SmartContract) getBooking(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	booking, _, err := readBooking(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get booking: " + err.Error())
+	} else if booking == nil {
+		return shim.Error("Booking does not exist. BookingId: " + args[0])
+	}
+
+	bookingAsBytes, _ := json.Marshal(booking)
+	return shim.Success(bookingAsBytes)
+}
@@ -0,0 +1,114 @@
+package main
+
+import "testing"
+
+func TestParseContainerCounts(t *testing.T) {
+	tests := []struct {
+		value   string
+		count   int
+		wantErr bool
+	}{
+		{`{"22G1":2,"45R1":1}`, 2, false},
+		{`{}`, 0, false},
+		{`{"22X1":2}`, 0, true},
+		{`{"22G1":-1}`, 0, true},
+		{`["22G1"]`, 0, true},
+	}
+	for _, test := range tests {
+		counts, err := parseContainerCounts(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseContainerCounts(%s) = %v, wantErr %v", test.value, err, test.wantErr)
+		} else if err == nil && len(counts) != test.count {
+			t.Errorf("parseContainerCounts(%s) = %v, want %d size/types", test.value, counts, test.count)
+		}
+	}
+}
+
+func TestBookingCapacity(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "SHIPPER", "Exporter")
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+	for _, hashId := range []string{"C1", "C2"} {
+		stub.seedTestRecord("Container", hashId, "CARRIER", Container{HashId: hashId, Owner: "CARRIER", Status: "Loaded", SizeTypeCode: "22G1", Vgm: Vgm{Weight: "24000"}})
+	}
+
+	stub.asParticipant(testMspId, "CARRIER").mustFail("not participant SHIPPER", "requestBooking", "B1", "SHIPPER", "CARRIER", "Mumbai", "Rotterdam", `{"22G1":2}`, "2020-03-02T00:00:00Z", "2020-03-20T00:00:00Z")
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("is not a Transporter", "requestBooking", "B1", "SHIPPER", "SHIPPER", "Mumbai", "Rotterdam", `{"22G1":2}`, "2020-03-02T00:00:00Z", "2020-03-20T00:00:00Z")
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("must be after requestedDeparture", "requestBooking", "B1", "SHIPPER", "CARRIER", "Mumbai", "Rotterdam", `{"22G1":2}`, "2020-03-20T00:00:00Z", "2020-03-02T00:00:00Z")
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("requestBooking", "B1", "SHIPPER", "CARRIER", "Mumbai", "Rotterdam", `{"22G1":2}`, "2020-03-02T00:00:00Z", "2020-03-20T00:00:00Z")
+
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("not participant CARRIER", "confirmBooking", "B1", "CARRIER", `{"22G1":1}`)
+	stub.asParticipant(testMspId, "CARRIER").mustFail("Cannot allocate 3 22G1 containers; 2 were requested", "confirmBooking", "B1", "CARRIER", `{"22G1":3}`)
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("confirmBooking", "B1", "CARRIER", `{"22G1":1}`)
+
+	cargo := func(hashId string, containers string, bookingId string) []string {
+		return []string{hashId, "tx", "2020-03-01T09:00:00Z", hashId, "Mumbai", "Rotterdam", "Mumbai", "Sea", "1", "CARRIER", containers, "Ready", bookingId}
+	}
+	stub.mustFail("has no capacity left for another 22G1 container (C2)", "createCargoLoadContainers", cargo("CG1", "C1,C2", "B1")...)
+	stub.mustFail("Booking does not exist", "createCargoLoadContainers", cargo("CG1", "C1", "B9")...)
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("does not act for any of CARRIER, SHIPPER", "createCargoLoadContainers", cargo("CG1", "C1", "B1")...)
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("createCargoLoadContainers", cargo("CG1", "C1", "B1")...)
+	// Creating it again would overwrite the live Cargo.
+	stub.mustFail("This Cargo record already exists. HashId: CG1", "createCargoLoadContainers", cargo("CG1", "C1", "B1")...)
+
+	var booking *Booking
+	if err := stub.run(func() (err error) { booking, _, err = readBooking(stub, "B1"); return err }); err != nil || booking == nil {
+		t.Fatalf("readBooking(B1) = %v, %v", booking, err)
+	}
+	if booking.UsedContainers["22G1"] != 1 || len(booking.CargoIds) != 1 || booking.CargoIds[0] != "CG1" {
+		t.Errorf("booking used %v for cargo %v, want one 22G1 for CG1", booking.UsedContainers, booking.CargoIds)
+	}
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("in use by Cargo", "cancelBooking", "B1", "SHIPPER", "Changed plans")
+
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("requestBooking", "B2", "SHIPPER", "CARRIER", "Mumbai", "Rotterdam", `{"22G1":1}`, "2020-03-02T00:00:00Z", "2020-03-20T00:00:00Z")
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("not participant CARRIER", "rejectBooking", "B2", "CARRIER", "No space")
+	stub.asParticipant(testMspId, "CARRIER").mustFail("not participant SHIPPER", "cancelBooking", "B2", "SHIPPER", "No space")
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("rejectBooking", "B2", "CARRIER", "No space")
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("Booking is already Rejected", "cancelBooking", "B2", "SHIPPER", "Changed plans")
+	stub.asParticipant(testMspId, "CARRIER").mustFail("Booking B2 is Rejected, not Confirmed", "createCargoLoadContainers", cargo("CG2", "C2", "B2")...)
+}
+
+func TestUpdateCargoKeepsToBooking(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(otherTestMspId, "OUTSIDER", "Exporter")
+	stub.seedTestRecord("Container", "C1", "CARRIER", Container{HashId: "C1", Owner: "CARRIER", Status: "InCargo", CargoId: "CG1", SizeTypeCode: "22G1", Vgm: Vgm{Weight: "24000"}})
+	stub.seedTestRecord("Container", "C2", "CARRIER", Container{HashId: "C2", Owner: "CARRIER", Status: "Loaded", SizeTypeCode: "22G1", Vgm: Vgm{Weight: "24000"}})
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", Status: "Ready", BookingId: "B1", ShippedFrom: "Mumbai", ShippedTo: "Rotterdam", AssociatedContainerHashIds: []string{"C1"}})
+
+	attributes := func(hashId string, shippedTo string, containers string, status string) []string {
+		return []string{hashId, "tx", "2020-03-01T09:00:00Z", "Mumbai", shippedTo, "Sea", "1", containers, status}
+	}
+	tests := []struct {
+		name     string
+		caller   string
+		function string
+		args     []string
+		reason   string
+	}{
+		{"outsider setting the status", "OUTSIDER", "updateCargoAttributes", attributes("CG1", "Rotterdam", "C1", "Arrived"), "not participant CARRIER"},
+		{"outsider moving the cargo", "OUTSIDER", "updateCargoCoordinates", []string{"CG1", "2020-03-01T09:00:00Z", "Colombo"}, "not participant CARRIER"},
+		{"outsider updating a container", "OUTSIDER", "updateContainerAttributes", []string{"C1", "2020-03-01T09:00:00Z", "Maersk", "InCargo", "", "Pending", "Mumbai", "Rotterdam", "Colombo"}, "not participant CARRIER"},
+		{"container past the booking", "CARRIER", "updateCargoAttributes", attributes("CG1", "Rotterdam", "C1,C2", "Ready"), "The containers of a Cargo are set by its booking"},
+		{"route off the booking", "CARRIER", "updateCargoAttributes", attributes("CG1", "Hamburg", "C1", "Ready"), "as booked in B1"},
+		{"cargo without a booking", "CARRIER", "updateCargoAttributes", attributes("CG2", "Rotterdam", "C2", "Ready"), "Cargo does not exist"},
+		{"owner", "CARRIER", "updateCargoAttributes", attributes("CG1", "Rotterdam", "C1", "Ready"), ""},
+		{"owner moving the cargo", "CARRIER", "updateCargoCoordinates", []string{"CG1", "2020-03-01T09:00:00Z", "Nhava Sheva"}, ""},
+	}
+	mspIds := map[string]string{"CARRIER": testMspId, "OUTSIDER": otherTestMspId}
+	for _, test := range tests {
+		stub.asParticipant(mspIds[test.caller], test.caller)
+		if test.reason != "" {
+			stub.mustFail(test.reason, test.function, test.args...)
+		} else {
+			stub.mustInvoke(test.function, test.args...)
+		}
+	}
+
+	var cargo Cargo
+	stub.readTestRecord("CG1", &cargo)
+	if cargo.Status != "Ready" || len(cargo.AssociatedContainerHashIds) != 1 || cargo.CargoLocation != "Nhava Sheva" {
+		t.Errorf("cargo is %s at %s with %v, want Ready at Nhava Sheva with C1 only", cargo.Status, cargo.CargoLocation, cargo.AssociatedContainerHashIds)
+	}
+}
@@ -1,9 +1,14 @@
 /*
  * The smart contract for Cargo and Containers:
  * Track & Trace of Cargo and Containers
- * Container States --> Available, Loaded, In-Cargo, In-Transit, Unloaded, Customs Pending.
- * Cargo States --> Ready, In-Transit, Arrived.
- * Participant Roles --> Container Supplier, Transporter, Exporter, Importer, Customs Officer
+ * Container States --> Available, Loaded, In-Cargo, In-Transit, Unloaded, Customs Pending, Empty Released, Returned.
+ * Cargo States --> Ready, In-Transit, Arrived, Archived.
+ * Participant Roles --> Container Supplier, Transporter, Exporter, Importer, Customs Officer, Arbiter
+ * Participant States --> Active, Suspended.
+ * Owner --> a Participant HashId or an OrganisationId; ownerOrganisation is the Organisation holding custody.
+ * Bill of Lading States --> Issued, Surrendered.
+ * Custody changes between participants of different organisations are two-step: changeXCustody, then acceptXCustody.
+ * Init args --> init or initLedger (also seeds a demo dataset), optionally with the ledger configuration as JSON.
  */
 
 package main
@@ -16,7 +21,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
 	"github.com/hyperledger/fabric/core/chaincode/shim"
 	sc "github.com/hyperledger/fabric/protos/peer"
 )
@@ -37,22 +44,44 @@ type Cargo struct {
 	TransportationType string `json:"transportationType"`
 	ContainerQty string `json:"containerQty"`
 	Owner string `json:"owner"`
+	OwnerOrganisation string `json:"ownerOrganisation"`
+	PendingOwner string `json:"pendingOwner"`
 	AssociatedContainerHashIds[] string `json:"associatedContainerHashIds"`
 	Status string `json:"status"`
+	BillOfLading string `json:"billOfLading"`
+	BookingId string `json:"bookingId"`
+	VoyageId string `json:"voyageId"`
+	Legs []Leg `json:"legs"`
+	PrivateHashes map[string]string `json:"privateHashes"`
+	Temperature string `json:"temperature"`
+	SchemaVersion int `json:"schemaVersion"`
 }
 
 type Container struct {
 	HashId string `json:"hashId"`
 	Timestamp string `json:"timestamp"`
 	Manufacturer string `json:"manufacturer"`
+	Supplier string `json:"supplier"`
+	ContainerNumber string `json:"containerNumber"`
+	SizeTypeCode string `json:"sizeTypeCode"`
+	TareWeight string `json:"tareWeight"`
+	MaxPayload string `json:"maxPayload"`
+	MaxGrossWeight string `json:"maxGrossWeight"`
 	Status string `json:"status"`
 	LoadedItems string `json:"loadedItems"`
 	Owner string `json:"owner"`
+	OwnerOrganisation string `json:"ownerOrganisation"`
+	PendingOwner string `json:"pendingOwner"`
 	CargoId string `json:"cargoId"`
 	CustomClearanceStatus string `json:"customClearanceStatus"`
 	ShippedFrom string `json:"shippedFrom"`
 	ShippedTo string `json:"shippedTo"`
 	ContainerLocation string `json:"containerLocation"`
+	PrivateHashes map[string]string `json:"privateHashes"`
+	Seal Seal `json:"seal"`
+	OpeningAuthorizedBy string `json:"openingAuthorizedBy"`
+	Vgm Vgm `json:"vgm"`
+	SchemaVersion int `json:"schemaVersion"`
 }
 
 type Participant struct {
@@ -60,15 +89,22 @@ type Participant struct {
 	Name string `json:"name"`
 	EmailId string `json:"emailId"`
 	Role string `json:"role"`
+	MspId string `json:"mspId"`
+	OrganisationId string `json:"organisationId"`
+	Status string `json:"status"`
+	SuspendedReason string `json:"suspendedReason"`
+	RoleHistory []RoleAssignment `json:"roleHistory"`
+	SchemaVersion int `json:"schemaVersion"`
 }
 
 
 /*
- * The Init method is called when the Smart Contract "fabcargo" is instantiated by the blockchain network
+ * The Init method is called when the Smart Contract "fabcargo" is instantiated or upgraded by the blockchain network
  * Best practice is to have any Ledger initialization in separate function -- see initLedger()
  */
 func (s *SmartContract) Init(APIstub shim.ChaincodeStubInterface) sc.Response {
-	return shim.Success(nil)
+	function, args := APIstub.GetFunctionAndParameters()
+	return s.initLedger(APIstub, function, args)
 }
 
 /*
@@ -79,6 +115,22 @@ func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response
 
 	// Retrieve the requested Smart Contract function and arguments
 	function, args := APIstub.GetFunctionAndParameters()
+
+	// Suspended participants cannot act, whichever function they call
+	if err := assertCallerNotSuspended(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Key history does not say who made a change or how, so record it with the transaction
+	if err := recordTxAudit(APIstub, function); err != nil {
+		return shim.Error("Failed to record transaction audit: "+err.Error())
+	}
+
+	// Business rules configured on the ledger apply on top of the checks each function makes
+	if err := assertRules(APIstub, function, args); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// Route to the appropriate handler function to interact with the ledger appropriately
 	if function == "registerParticipant" {  		        // Done - This is to add legitimate users with role in system.
 		return s.registerParticipant(APIstub, args)
@@ -114,15 +166,199 @@ func (s *SmartContract) Invoke(APIstub shim.ChaincodeStubInterface) sc.Response
 		return s.getLoadedContainers(APIstub)
 	} else if function == "getAvilableContainers" {			// Done - This is to get all Available state Containers
 		return s.getAvilableContainers(APIstub)
+	} else if function == "issueBillOfLading" {				// Done - This is for the carrier to issue an eBL for a Cargo.
+		return s.issueBillOfLading(APIstub, args)
+	} else if function == "endorseBillOfLading" {			// Done - This is for the eBL holder to endorse it to the next party.
+		return s.endorseBillOfLading(APIstub, args)
+	} else if function == "surrenderBillOfLading" {		// Done - This is to surrender the eBL at destination and release the containers.
+		return s.surrenderBillOfLading(APIstub, args)
+	} else if function == "getBillOfLading" {				// Done - This is to get an eBL with its endorsement chain.
+		return s.getBillOfLading(APIstub, args)
+	} else if function == "setPrivateDetails" {			// Done - This is to store declared values, pricing and consignee details privately.
+		return s.setPrivateDetails(APIstub, args)
+	} else if function == "getPrivateDetails" {			// Done - This is to read private details (collection members only).
+		return s.getPrivateDetails(APIstub, args)
+	} else if function == "verifyPrivateValue" {			// Done - This is to verify a disclosed value against its on-chain hash.
+		return s.verifyPrivateValue(APIstub, args)
+	} else if function == "acceptCargoCustody" {			// Done - This is for the new owner to accept a cross-organisation Cargo handover.
+		return s.acceptCargoCustody(APIstub, args)
+	} else if function == "acceptContainerCustody" {		// Done - This is for the new owner to accept a cross-organisation Container handover.
+		return s.acceptContainerCustody(APIstub, args)
+	} else if function == "releaseContainerFromCustoms" {	// Done - This is for Customs to clear a Container (customs organisation endorsement).
+		return s.releaseContainerFromCustoms(APIstub, args)
+	} else if function == "setRoleOrganisation" {			// Done - This is to assign the organisations that play a business role.
+		return s.setRoleOrganisation(APIstub, args)
+	} else if function == "getRoleOrganisations" {			// Done - This is to get the organisations assigned to each business role.
+		return s.getRoleOrganisations(APIstub)
+	} else if function == "updateParticipant" {			// Done - This is for an org admin to change a participant's details or role.
+		return s.updateParticipant(APIstub, args)
+	} else if function == "suspendParticipant" {			// Done - This is for an org admin to deactivate a participant.
+		return s.suspendParticipant(APIstub, args)
+	} else if function == "reinstateParticipant" {			// Done - This is for an org admin to reactivate a suspended participant.
+		return s.reinstateParticipant(APIstub, args)
+	} else if function == "getParticipantRoleAt" {			// Done - This is to get the role a participant held at a given time.
+		return s.getParticipantRoleAt(APIstub, args)
+	} else if function == "registerOrganisation" {			// Done - This is for an org admin to register their company.
+		return s.registerOrganisation(APIstub, args)
+	} else if function == "getOrganisation" {				// Done - This is to get an Organisation.
+		return s.getOrganisation(APIstub, args)
+	} else if function == "setParticipantOrganisation" {	// Done - This is for an org admin to move a participant into an Organisation.
+		return s.setParticipantOrganisation(APIstub, args)
+	} else if function == "getContainersByOrganisation" {	// Done - This is to get all Containers currently held by an Organisation.
+		return s.getContainersByOrganisation(APIstub, args)
+	} else if function == "getCargosByOrganisation" {		// Done - This is to get all Cargos currently held by an Organisation.
+		return s.getCargosByOrganisation(APIstub, args)
+	} else if function == "getParticipantsByOrganisation" {	// Done - This is to get all Participants of an Organisation.
+		return s.getParticipantsByOrganisation(APIstub, args)
+	} else if function == "setCargoSla" {					// Done - This is to attach an SLA to a Cargo before it departs.
+		return s.setCargoSla(APIstub, args)
+	} else if function == "acceptCargoSla" {				// Done - This is for the other party to accept a proposed SLA.
+		return s.acceptCargoSla(APIstub, args)
+	} else if function == "recordCargoTelemetry" {			// Done - This is to record IOT sensor telemetry (temperature) for a Cargo.
+		return s.recordCargoTelemetry(APIstub, args)
+	} else if function == "getSlaReport" {					// Done - This is to get a Cargo's SLA with its breaches and penalties.
+		return s.getSlaReport(APIstub, args)
+	} else if function == "depositFunds" {					// Done - This is to issue ledger units to an account.
+		return s.depositFunds(APIstub, args)
+	} else if function == "getAccount" {					// Done - This is to get an account balance.
+		return s.getAccount(APIstub, args)
+	} else if function == "lockFreightPayment" {			// Done - This is to lock the freight for a Cargo in escrow.
+		return s.lockFreightPayment(APIstub, args)
+	} else if function == "releaseMilestonePayment" {		// Done - This is to release the carrier's share for a milestone the Cargo has reached.
+		return s.releaseMilestonePayment(APIstub, args)
+	} else if function == "confirmDelivery" {				// Done - This is to confirm delivery and settle the escrow.
+		return s.confirmDelivery(APIstub, args)
+	} else if function == "refundFreightPayment" {			// Done - This is to refund the escrow to the shipper before departure.
+		return s.refundFreightPayment(APIstub, args)
+	} else if function == "getEscrow" {						// Done - This is to get the escrow for a Cargo.
+		return s.getEscrow(APIstub, args)
+	} else if function == "fileClaim" {						// Done - This is to file a claim for a damaged or missing Container.
+		return s.fileClaim(APIstub, args)
+	} else if function == "addClaimEvidence" {				// Done - This is to add evidence document hashes to an open claim.
+		return s.addClaimEvidence(APIstub, args)
+	} else if function == "reviewClaim" {					// Done - This is to take a claim under review by an arbiter.
+		return s.reviewClaim(APIstub, args)
+	} else if function == "decideClaim" {					// Done - This is to accept or reject a claim under review.
+		return s.decideClaim(APIstub, args)
+	} else if function == "settleClaim" {					// Done - This is to pay an accepted claim from the custodian to the claimant.
+		return s.settleClaim(APIstub, args)
+	} else if function == "getClaim" {						// Done - This is to get a claim with its history.
+		return s.getClaim(APIstub, args)
+	} else if function == "getOpenClaimsByOrganisation" {	// Done - This is to list an organisation's open claims.
+		return s.getOpenClaimsByOrganisation(APIstub, args)
+	} else if function == "applyContainerSeal" {			// Done - This is to reseal a Container whose seal was removed or broken.
+		return s.applyContainerSeal(APIstub, args)
+	} else if function == "authorizeContainerOpening" {		// Done - This is to authorize the next opening of a Container's doors.
+		return s.authorizeContainerOpening(APIstub, args)
+	} else if function == "recordContainerDoorEvent" {		// Done - This is to record an IOT door-open event for a Container.
+		return s.recordContainerDoorEvent(APIstub, args)
+	} else if function == "getSealIncidents" {				// Done - This is to get the seal incidents recorded for a Container.
+		return s.getSealIncidents(APIstub, args)
+	} else if function == "getContainerByNumber" {			// Done - This is to get a Container by its ISO 6346 container number.
+		return s.getContainerByNumber(APIstub, args)
+	} else if function == "declareVGM" {					// Done - This is to declare the verified gross mass of a packed Container.
+		return s.declareVGM(APIstub, args)
+	} else if function == "releaseEmptyContainer" {			// Done - This is to release an unloaded, stripped Container to a Transporter for return.
+		return s.releaseEmptyContainer(APIstub, args)
+	} else if function == "returnContainerToDepot" {		// Done - This is to return an empty Container to a depot for its supplier.
+		return s.returnContainerToDepot(APIstub, args)
+	} else if function == "acknowledgeContainerReturn" {	// Done - This is to acknowledge a returned Container and make it Available again.
+		return s.acknowledgeContainerReturn(APIstub, args)
+	} else if function == "getContainerMetrics" {			// Done - This is to get a Container's turnaround and utilization metrics.
+		return s.getContainerMetrics(APIstub, args)
+	} else if function == "setDemurrageTariff" {			// Done - This is to set a Container Supplier's detention and demurrage tariff.
+		return s.setDemurrageTariff(APIstub, args)
+	} else if function == "getDemurrage" {					// Done - This is to get the demurrage days and charges accrued by a Container.
+		return s.getDemurrage(APIstub, args)
+	} else if function == "requestBooking" {				// Done - This is to request container capacity from a Transporter for a route.
+		return s.requestBooking(APIstub, args)
+	} else if function == "confirmBooking" {				// Done - This is to confirm a booking with the capacity allocated.
+		return s.confirmBooking(APIstub, args)
+	} else if function == "rejectBooking" {					// Done - This is to reject a requested booking.
+		return s.rejectBooking(APIstub, args)
+	} else if function == "cancelBooking" {					// Done - This is to cancel a booking before any Cargo uses it.
+		return s.cancelBooking(APIstub, args)
+	} else if function == "getBooking" {					// Done - This is to get a booking with the capacity allocated and used.
+		return s.getBooking(APIstub, args)
+	} else if function == "createVoyage" {					// Done - This is to create a vessel, flight or truck trip with its port calls.
+		return s.createVoyage(APIstub, args)
+	} else if function == "assignCargoToVoyage" {			// Done - This is to assign a Cargo to a Voyage.
+		return s.assignCargoToVoyage(APIstub, args)
+	} else if function == "updatePortCallEta" {				// Done - This is to revise the ETA/ETD of a port call and notify subscribers.
+		return s.updatePortCallEta(APIstub, args)
+	} else if function == "recordPortCallDeparture" {		// Done - This is to record a departure and move Cargo loaded there In-Transit.
+		return s.recordPortCallDeparture(APIstub, args)
+	} else if function == "recordPortCallArrival" {			// Done - This is to record an arrival and move every Cargo on the Voyage.
+		return s.recordPortCallArrival(APIstub, args)
+	} else if function == "getVoyage" {						// Done - This is to get a Voyage with its port calls and Cargo.
+		return s.getVoyage(APIstub, args)
+	} else if function == "planCargoLegs" {					// Done - This is to plan a multimodal journey as an ordered list of legs.
+		return s.planCargoLegs(APIstub, args)
+	} else if function == "acceptCargoLeg" {				// Done - This is for a carrier to accept its legs of a planned journey.
+		return s.acceptCargoLeg(APIstub, args)
+	} else if function == "startCargoLeg" {					// Done - This is to start the next leg of a Cargo's journey.
+		return s.startCargoLeg(APIstub, args)
+	} else if function == "completeCargoLeg" {				// Done - This is to complete a leg and hand the Cargo to the next carrier.
+		return s.completeCargoLeg(APIstub, args)
+	} else if function == "getHistory" {					// Done - This is to get a record's history with the changes, time and submitter of each version.
+		return s.getHistory(APIstub, args)
+	} else if function == "getProvenance" {					// Done - This is to trace where a Container has been and who held it, as a graph.
+		return s.getProvenance(APIstub, args)
+	} else if function == "getContainerAsOf" {				// Done - This is to get a Container as it was recorded at a point in time.
+		return s.getContainerAsOf(APIstub, args)
+	} else if function == "getCargoAsOf" {					// Done - This is to get a Cargo as it was recorded at a point in time.
+		return s.getCargoAsOf(APIstub, args)
+	} else if function == "getCargoContainersAsOf" {		// Done - This is to get a Cargo and its Containers as recorded at a point in time.
+		return s.getCargoContainersAsOf(APIstub, args)
+	} else if function == "archiveCargo" {					// Done - This is to archive a completed Cargo out of the active listings.
+		return s.archiveCargo(APIstub, args)
+	} else if function == "deleteCargo" {					// Done - This is to delete an Archived Cargo, leaving a tombstone.
+		return s.deleteCargo(APIstub, args)
+	} else if function == "deleteContainer" {				// Done - This is to delete an idle Container, leaving a tombstone.
+		return s.deleteContainer(APIstub, args)
+	} else if function == "getTombstone" {					// Done - This is to get who deleted a Cargo or Container and why.
+		return s.getTombstone(APIstub, args)
+	} else if function == "addContainersBatch" {			// Done - This is to register many Containers in one transaction.
+		return s.addContainersBatch(APIstub, args)
+	} else if function == "updateContainersBatch" {			// Done - This is to update many Containers in one transaction.
+		return s.updateContainersBatch(APIstub, args)
+	} else if function == "changeContainerCustodyBatch" {	// Done - This is to hand over many Containers in one transaction.
+		return s.changeContainerCustodyBatch(APIstub, args)
+	} else if function == "setMaxBatchSize" {				// Done - This is to set the maximum number of items in a batch.
+		return s.setMaxBatchSize(APIstub, args)
+	} else if function == "getLedgerConfig" {				// Done - This is to get the ledger configuration set through Init.
+		return s.getLedgerConfig(APIstub)
+	} else if function == "migrateState" {					// Done - This is to upgrade stored records to the current schema version, a page at a time.
+		return s.migrateState(APIstub, args)
+	} else if function == "getMigrationStatus" {			// Done - This is to get the progress of migrateState and the schema versions stored.
+		return s.getMigrationStatus(APIstub)
+	} else if function == "setRules" {						// Done - This is to replace the business rules checked before each function.
+		return s.setRules(APIstub, args)
+	} else if function == "evaluateRules" {					// Done - This is to dry-run business rules against a payload.
+		return s.evaluateRules(APIstub, args)
+	} else if function == "proposeConfigChange" {			// Done - This is to propose a configuration change for the designated admins to vote on.
+		return s.proposeConfigChange(APIstub, args)
+	} else if function == "approveProposal" {				// Done - This is to approve a proposal, applying it once the quorum is reached.
+		return s.approveProposal(APIstub, args)
+	} else if function == "rejectProposal" {				// Done - This is to reject a proposal with a reason.
+		return s.rejectProposal(APIstub, args)
+	} else if function == "getProposal" {					// Done - This is to get a proposal with its votes.
+		return s.getProposal(APIstub, args)
+	} else if function == "getProposals" {					// Done - This is to list proposals, optionally by status.
+		return s.getProposals(APIstub, args)
+	} else if function == "getProposalHistory" {			// Done - This is to get every version of a proposal.
+		return s.getProposalHistory(APIstub, args)
 	}
 
 	return shim.Error("Invalid Smart Contract function name.")
 }
 
+// registerParticipant - args: hashId, name, emailId, role, and optionally organisationId. Only an org admin can register a participant,
+// and the participant belongs to the admin's organisation.
 func (s *SmartContract) registerParticipant(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting 4")
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 4 or 5")
 	}
 
 	participantAsBytes, errr := APIstub.GetState(args[0])
@@ -133,47 +369,120 @@ func (s *SmartContract) registerParticipant(APIstub shim.ChaincodeStubInterface,
 		return shim.Error("This User already exists. Name: "+args[1]+", EmailId: "+args[2])		
 	}
 
-	var participant = Participant{HashId: args[0], Name: args[1], EmailId: args[2], Role: args[3]}
+	// A participant always belongs to the organisation registering them.
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get caller organisation: "+err.Error())
+	}
+	if err := assertOrgAdmin(APIstub, mspId); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	participantNewAsBytes, _ := json.Marshal(participant)
-	APIstub.PutState(args[0], participantNewAsBytes)
+	organisationId := ""
+	if len(args) == 5 {
+		organisation, _, err := readOrganisation(APIstub, args[4])
+		if err != nil {
+			return shim.Error("Failed to get organisation: "+err.Error())
+		} else if organisation.OrganisationId == "" {
+			return shim.Error("Organisation does not exist. OrganisationId: "+args[4])
+		} else if organisation.MspId != mspId {
+			return shim.Error("Organisation "+args[4]+" does not belong to "+mspId)
+		} else if !contains(organisation.Roles, args[3]) {
+			return shim.Error("Organisation "+args[4]+" does not play the role "+args[3])
+		}
+		if err := moveHolding(APIstub, "Participant", args[0], "", args[4]); err != nil {
+			return shim.Error("Failed to update organisation index: "+err.Error())
+		}
+		organisationId = args[4]
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: "+err.Error())
+	}
+	registeredBy, _ := cid.GetID(APIstub)
+	roleHistory := []RoleAssignment{{Role: args[3], EffectiveFrom: now.UTC().Format(time.RFC3339), AssignedBy: registeredBy}}
+
+	var participant = Participant{HashId: args[0], Name: args[1], EmailId: args[2], Role: args[3], MspId: mspId, OrganisationId: organisationId, Status: participantActiveStatus, RoleHistory: roleHistory, SchemaVersion: currentSchemaVersion}
+
+	if err := putObject(APIstub, args[0], participant); err != nil {
+		return shim.Error("Failed to register participant: "+err.Error())
+	}
+
+	if err := setKeyEndorsementOrgs(APIstub, args[0], mspId); err != nil {
+		return shim.Error("Failed to set endorsement policy: "+err.Error())
+	}
 
 	return shim.Success(nil)
 }
 
+// addNewContainer - args: hashId, timestamp, manufacturer, status, loadedItems, owner, cargoId, customClearanceStatus, shippedFrom, shippedTo,
+// containerLocation, containerNumber (ISO 6346), sizeTypeCode, tareWeight (kg), maxPayload (kg), and optionally the Container Supplier.
+// The caller must act for the owner and for the supplier, if one is named: a supplier registers its own containers and then
+// hands them over to a Transporter.
 func (s *SmartContract) addNewContainer(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 11 {
-		return shim.Error("Incorrect number of arguments. Expecting 11")
+	if len(args) != 15 && len(args) != 16 {
+		return shim.Error("Incorrect number of arguments. Expecting 15 or 16")
 	}
 
-	//containerAsBytes, errr := APIstub.GetState(args[0])
-	
-	//ownerAsBytes, err := APIstub.GetState(args[6])
-	
-	//participant := Participant{}
-	
-	//json.Unmarshal(ownerAsBytes, &participant)
-	
+	containerAsBytes, errr := APIstub.GetState(args[0])
 
-	//if errr != nil {
-	//	return shim.Error("Failed to get container: "+errr.Error())	
-	//} else if containerAsBytes != nil {
-	//	return shim.Error("This Container record already exists. HashId: "+args[0])		
-	//} else if err != nil {
-	//	return shim.Error("Failed to get owner: "+err.Error())	
-	//} else if participant.Role != 'Transporter' {
-	//	return shim.Error("New Owner is not a Transporter")
-	//}
+	if errr != nil {
+		return shim.Error("Failed to get container: "+errr.Error())	
+	} else if containerAsBytes != nil {
+		return shim.Error("This Container record already exists. HashId: "+args[0])		
+	}
+
+	if err := assertCallerActsFor(APIstub, args[5]); err != nil {
+		return shim.Error(err.Error())
+	}
 	
-	if args[6] != "Transporter" {
-		return shim.Error("New Owner is not a Transporter")
+	if args[7] == customsClearedStatus {
+		return shim.Error("Only Customs can clear a Container. Use releaseContainerFromCustoms")
+	}
+
+	if err := assertNotSuspended(APIstub, args[5]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	ownerOrganisation, err := updateHolding(APIstub, "Container", args[0], "", args[5])
+	if err != nil {
+		return shim.Error("Failed to update organisation index: "+err.Error())
+	}
+
+	var container = Container{HashId: args[0], Timestamp: args[1], Manufacturer: args[2], Status: args[3], LoadedItems: args[4], Owner: args[5], OwnerOrganisation: ownerOrganisation, CargoId: args[6], CustomClearanceStatus: args[7], ShippedFrom: args[8], ShippedTo: args[9], ContainerLocation: args[10], SchemaVersion: currentSchemaVersion}
+
+	if err := setContainerMasterData(APIstub, &container, args[11:15]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if len(args) == 16 {
+		supplier, err := readParticipant(APIstub, args[15])
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if supplier.Role != "Container Supplier" {
+			return shim.Error("Participant "+args[15]+" is not a Container Supplier")
+		}
+		if err := assertCallerActsFor(APIstub, args[15]); err != nil {
+			return shim.Error(err.Error())
+		}
+		container.Supplier = args[15]
 	}
 
-	var container = Container{HashId: args[0], Timestamp: args[1], Manufacturer: args[2], Status: args[3], LoadedItems: args[4], Owner: args[5],CargoId: args[6], CustomClearanceStatus: args[7], ShippedFrom: args[8], ShippedTo: args[9], ContainerLocation: args[10]}
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to create Container: "+err.Error())
+	}
 
-	containerAsBytes, _ := json.Marshal(container)
-	APIstub.PutState(args[0], containerAsBytes)
+	if err := setKeyEndorsementOrgs(APIstub, args[0], ownerMspId(APIstub, args[5])); err != nil {
+		return shim.Error("Failed to set endorsement policy: "+err.Error())
+	}
+	if err := recordContainerMilestone(APIstub, args[0], "Available"); err != nil {
+		return shim.Error("Failed to update container metrics: "+err.Error())
+	}
+	if err := createCustomsClearance(APIstub, args[0], args[7], args[1]); err != nil {
+		return shim.Error("Failed to record customs clearance: "+err.Error())
+	}
 
 	return shim.Success(nil)
 }
@@ -183,24 +492,37 @@ func (s *SmartContract) getParticipant(APIstub shim.ChaincodeStubInterface, args
 	if len(args) != 1 {
 		return shim.Error("Incorrect number of arguments. Expecting 1")
 	}
-	containerAsBytes, _ := APIstub.GetState(args[0])
+	participantAsBytes, _ := APIstub.GetState(args[0])
+	participantAsBytes, err := upgradeRecordBytes("Participant", participantAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	
-	return shim.Success(containerAsBytes)
+	return shim.Success(participantAsBytes)
 }
 
+// loadContainerWithPackages - args: hashId, timestamp, status, loadedItems, customClearanceStatus, shippedFrom, shippedTo, containerLocation,
+// and optionally sealNumber, sealType, sealAppliedBy to seal the Container at containerLocation.
+// The caller must act for the Container's owner, and only the owner can seal it.
 func (s *SmartContract) loadContainerWithPackages(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 8 {
-		return shim.Error("Incorrect number of arguments. Expecting 8")
+	if len(args) != 8 && len(args) != 11 {
+		return shim.Error("Incorrect number of arguments. Expecting 8 or 11")
 	}
 
-	containerAsBytes, _ := APIstub.GetState(args[0])
-	container := Container{}
-
-	json.Unmarshal(containerAsBytes, &container)
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, container.Owner); err != nil {
+		return shim.Error(err.Error())
+	}
 	if container.Status != "Available" {
 		return shim.Error("Container is not Available for loading packages.")
 	}
+	if args[4] == customsClearedStatus && container.CustomClearanceStatus != customsClearedStatus {
+		return shim.Error("Only Customs can clear a Container. Use releaseContainerFromCustoms")
+	}
 	container.Timestamp = args[1]
 	container.Status = args[2]
 	container.LoadedItems = args[3]
@@ -208,17 +530,42 @@ func (s *SmartContract) loadContainerWithPackages(APIstub shim.ChaincodeStubInte
 	container.ShippedFrom = args[5]
 	container.ShippedTo = args[6]
 	container.ContainerLocation = args[7]
+	// New contents need a new VGM declaration.
+	container.Vgm = Vgm{}
 
-	containerAsBytes, _ = json.Marshal(container)
-	APIstub.PutState(args[0], containerAsBytes)
+	if len(args) == 11 {
+		if args[10] != container.Owner {
+			return shim.Error("Only the Container's owner can seal it")
+		}
+		if err := assertNotSuspended(APIstub, args[10]); err != nil {
+			return shim.Error(err.Error())
+		}
+		seal, err := newSeal(APIstub, args[8], args[9], args[10], args[7])
+		if err != nil {
+			return shim.Error("Failed to apply seal: "+err.Error())
+		}
+		container.Seal = seal
+		container.OpeningAuthorizedBy = ""
+	}
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: "+err.Error())
+	}
+
+	if err := recordContainerMilestone(APIstub, args[0], "Loaded"); err != nil {
+		return shim.Error("Failed to update container metrics: "+err.Error())
+	}
 	
 	return shim.Success(nil)
 }
 
+// createCargoLoadContainers - args: hashId, txnId, timestamp, cargoId, shippedFrom, shippedTo, cargoLocation, transportationType, containerQty,
+// owner, associatedContainerHashIds (comma separated), status, bookingId (a Confirmed booking with capacity left for the containers).
+// The caller must act for the booking's Transporter or Shipper.
 func (s *SmartContract) createCargoLoadContainers(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 12 {
-		return shim.Error("Incorrect number of arguments. Expecting 12")
+	if len(args) != 13 {
+		return shim.Error("Incorrect number of arguments. Expecting 13")
 	}
 	
 	// Check for Cargo In-Transit status
@@ -233,49 +580,108 @@ func (s *SmartContract) createCargoLoadContainers(APIstub shim.ChaincodeStubInte
 		////APIstub.PutState(args[0], cargoAsBytes)
 	////}
 
+	cargoCheckAsBytes, errr := APIstub.GetState(args[0])
+
+	if errr != nil {
+		return shim.Error("Failed to get Cargo: "+errr.Error())
+	} else if cargoCheckAsBytes != nil {
+		return shim.Error("This Cargo record already exists. HashId: "+args[0])
+	}
+
+	// Only the parties to the booking can use up its capacity.
+	booking, _, err := readBooking(APIstub, args[12])
+	if err != nil {
+		return shim.Error("Failed to get booking: "+err.Error())
+	} else if booking == nil {
+		return shim.Error("Booking does not exist. BookingId: "+args[12])
+	}
+	if err := assertCallerActsForAny(APIstub, booking.Transporter, booking.Shipper); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := assertNotSuspended(APIstub, args[9]); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	var ids []string = strings.Split(args[10],",")
+
+	// SOLAS: no container goes aboard without a verified gross mass.
+	if err := assertContainersHaveVgm(APIstub, ids); err != nil {
+		return shim.Error(err.Error())
+	}
 	
-	var cargo = Cargo{HashId: args[0], TxnId: args[1], Timestamp: args[2], CargoId: args[3], ShippedFrom: args[4], ShippedTo: args[5], CargoLocation: args[6], TransportationType: args[7], ContainerQty: args[8], Owner: args[9], AssociatedContainerHashIds: ids, Status: args[11]}
+	ownerOrganisation, err := updateHolding(APIstub, "Cargo", args[0], "", args[9])
+	if err != nil {
+		return shim.Error("Failed to update organisation index: "+err.Error())
+	}
+
+	var cargo = Cargo{HashId: args[0], TxnId: args[1], Timestamp: args[2], CargoId: args[3], ShippedFrom: args[4], ShippedTo: args[5], CargoLocation: args[6], TransportationType: args[7], ContainerQty: args[8], Owner: args[9], OwnerOrganisation: ownerOrganisation, AssociatedContainerHashIds: ids, Status: args[11], BookingId: args[12], SchemaVersion: currentSchemaVersion}
+
+	if err := useBookingCapacity(APIstub, args[12], cargo); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	cargoAsBytes, _ := json.Marshal(cargo)
-	APIstub.PutState(args[0], cargoAsBytes)
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to create Cargo: "+err.Error())
+	}
+
+	if err := setKeyEndorsementOrgs(APIstub, args[0], ownerMspId(APIstub, args[9])); err != nil {
+		return shim.Error("Failed to set endorsement policy: "+err.Error())
+	}
 	
-	for index, containerHashId := range ids {
+	for _, containerHashId := range ids {
 		
-		containerAsBytes, _ := APIstub.GetState(containerHashId)
-		container := Container{}
-
-		json.Unmarshal(containerAsBytes, &container)
+		container, err := readContainer(APIstub, containerHashId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 		container.CargoId = args[0]
 		container.Timestamp = args[2]
 		container.Status = "InCargo"
 		container.ContainerLocation = args[6]
 		
-		containerAsBytes, _ = json.Marshal(container)
-		
-		APIstub.PutState(containerHashId, containerAsBytes)
+		if err := putObject(APIstub, containerHashId, container); err != nil {
+			return shim.Error("Failed to update Container: "+err.Error())
+		}
 	}
 	
 	return shim.Success(nil)
 }
 
 
+// updateCargoAttributes - args: hashId, txnId, timestamp, shippedFrom, shippedTo, transportationType, containerQty, associatedContainerHashIds, status.
+// The caller must act for the owner. The containers and route were taken from the booking when the Cargo was created, so they cannot change here.
 func (s *SmartContract) updateCargoAttributes(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 	
 	if len(args) != 9 {
 		return shim.Error("Incorrect number of arguments. Expecting 9")
 	}
 
-	cargoAsBytes, err := APIstub.GetState(args[0])
-	cargo := Cargo{}
-
+	cargo, err := readCargo(APIstub, args[0])
 	if err != nil {
-		return shim.Error("Failed to get Cargo: "+err.Error())
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, cargo.Owner); err != nil {
+		return shim.Error(err.Error())
 	}
 
 	var ids []string = strings.Split(args[7],",")
 
-	json.Unmarshal(cargoAsBytes, &cargo)
+	if !sameHashIds(ids, cargo.AssociatedContainerHashIds) {
+		return shim.Error("The containers of a Cargo are set by its booking. Use unloadContainerFromCargo to remove one")
+	}
+	if cargo.BookingId != "" && (args[3] != cargo.ShippedFrom || args[4] != cargo.ShippedTo) {
+		return shim.Error("Cargo route must stay "+cargo.ShippedFrom+" to "+cargo.ShippedTo+" as booked in "+cargo.BookingId)
+	}
+
+	if err := assertStatusTransition(APIstub, "Cargo", cargo.Status, args[8]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if args[8] == "In-Transit" && cargo.Status != "In-Transit" {
+		if err := assertContainersHaveVgm(APIstub, ids); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
 	cargo.TxnId = args[1]
 	cargo.Timestamp = args[2]
 	cargo.ShippedFrom = args[3]
@@ -285,80 +691,137 @@ func (s *SmartContract) updateCargoAttributes(APIstub shim.ChaincodeStubInterfac
 	cargo.AssociatedContainerHashIds = ids
 	cargo.Status = args[8]
 
-	cargoAsBytes, _ = json.Marshal(cargo)
-	APIstub.PutState(args[0], cargoAsBytes)
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: "+err.Error())
+	}
+
+	if err := evaluateCargoSla(APIstub, cargo, nil); err != nil {
+		return shim.Error("Failed to evaluate SLA: "+err.Error())
+	}
 
 	return shim.Success(nil)
 }
 
+// updateCargoCoordinates - args: hashId, timestamp, cargoLocation. The caller must act for the owner.
 func (s *SmartContract) updateCargoCoordinates(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
 	if len(args) != 3 {
 		return shim.Error("Incorrect number of arguments. Expecting 3")
 	}
 
-	cargoAsBytes, err := APIstub.GetState(args[0])
-	cargo := Cargo{}
-
+	cargo, err := readCargo(APIstub, args[0])
 	if err != nil {
-		return shim.Error("Failed to get Cargo: "+err.Error())
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, cargo.Owner); err != nil {
+		return shim.Error(err.Error())
 	}
-
-	json.Unmarshal(cargoAsBytes, &cargo)
 	cargo.Timestamp = args[1]
 	cargo.CargoLocation = args[2]
 
-	cargoAsBytes, _ = json.Marshal(cargo)
-	APIstub.PutState(args[0], cargoAsBytes)
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: "+err.Error())
+	}
 
+	if err := evaluateCargoSla(APIstub, cargo, nil); err != nil {
+		return shim.Error("Failed to evaluate SLA: "+err.Error())
+	}
 
-	for index, containerHashId := range cargo.AssociatedContainerHashIds {
-		
-		containerAsBytes, _ := APIstub.GetState(containerHashId)
-		container := Container{}
 
-		json.Unmarshal(containerAsBytes, &container)
+	for _, containerHashId := range cargo.AssociatedContainerHashIds {
+		
+		container, err := readContainer(APIstub, containerHashId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
 		container.ContainerLocation = args[1]
 		container.ContainerLocation = args[2]
 		
-		containerAsBytes, _ = json.Marshal(container)
-		APIstub.PutState(containerHashId, containerAsBytes)
+		if err := putObject(APIstub, containerHashId, container); err != nil {
+			return shim.Error("Failed to update Container: "+err.Error())
+		}
 	}
 	return shim.Success(nil)
 }
 
+// changeCargoCustody - args: hashId, newOwner, and optionally the seals seen at handover (JSON object of container HashId to seal number).
 func (s *SmartContract) changeCargoCustody(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Only the current owner can hand the Cargo over.
+	if err := assertCallerActsFor(APIstub, cargo.Owner); err != nil {
+		return shim.Error(err.Error())
 	}
 
-	cargoAsBytes, _ := APIstub.GetState(args[0])
-	cargo := Cargo{}
+	if err := assertNotSuspended(APIstub, cargo.Owner, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	json.Unmarshal(cargoAsBytes, &cargo)
-	cargo.Owner = args[1]
+	// A handover between organisations needs both of them, so the new owner has to accept it.
+	crossOrg, oldOrg, newOrg := handoverRequiresBothOrgs(APIstub, cargo.Owner, args[1])
+	if crossOrg {
+		cargo.PendingOwner = args[1]
+	} else {
+		if err := verifyCargoSeals(APIstub, cargo, optionalArg(args, 2), args[1]); err != nil {
+			return shim.Error("Failed to verify seals: "+err.Error())
+		}
+		cargo.OwnerOrganisation, err = updateHolding(APIstub, "Cargo", args[0], cargo.OwnerOrganisation, args[1])
+		if err != nil {
+			return shim.Error("Failed to update organisation index: "+err.Error())
+		}
+		cargo.Owner = args[1]
+		cargo.PendingOwner = ""
+	}
 
-	cargoAsBytes, _ = json.Marshal(cargo)
-	APIstub.PutState(args[0], cargoAsBytes)
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: "+err.Error())
+	}
+
+	if crossOrg {
+		err = setKeyEndorsementOrgs(APIstub, args[0], oldOrg, newOrg)
+	} else {
+		err = setKeyEndorsementOrgs(APIstub, args[0], newOrg)
+	}
+	if err != nil {
+		return shim.Error("Failed to set endorsement policy: "+err.Error())
+	}
 
 	return shim.Success(nil)
 }
 
+// updateContainerAttributes - args: hashId, timestamp, manufacturer, status, loadedItems, customClearanceStatus, shippedFrom, shippedTo, containerLocation.
+// The caller must act for the owner.
 func (s *SmartContract) updateContainerAttributes(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
 	if len(args) != 9 {
 		return shim.Error("Incorrect number of arguments. Expecting 9")
 	}
 
-	containerAsBytes, err := APIstub.GetState(args[0])
-	container := Container{}
-
+	container, err := readContainer(APIstub, args[0])
 	if err != nil {
-		return shim.Error("Failed to get Container: "+err.Error())
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, container.Owner); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertStatusTransition(APIstub, "Container", container.Status, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if args[5] == customsClearedStatus && container.CustomClearanceStatus != customsClearedStatus {
+		return shim.Error("Only Customs can clear a Container. Use releaseContainerFromCustoms")
+	}
+	// New contents need a new VGM declaration.
+	if args[4] != container.LoadedItems {
+		container.Vgm = Vgm{}
 	}
-
-	json.Unmarshal(containerAsBytes, &container)
 	container.Timestamp = args[1]
 	container.Manufacturer = args[2]
 	container.Status = args[3]
@@ -368,42 +831,99 @@ func (s *SmartContract) updateContainerAttributes(APIstub shim.ChaincodeStubInte
 	container.ShippedTo = args[7]
 	container.ContainerLocation = args[8]
 
-	containerAsBytes, _ = json.Marshal(container)
-	APIstub.PutState(args[0], containerAsBytes)
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: "+err.Error())
+	}
 
 	return shim.Success(nil)
 }
 
+// changeContainerCustody - args: hashId, newOwner, and optionally the seal number seen at handover.
 func (s *SmartContract) changeContainerCustody(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
 
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
 	}
 
-	containerAsBytes, err := APIstub.GetState(args[0])
-	container := Container{}
-
+	container, err := readContainer(APIstub, args[0])
 	if err != nil {
-		return shim.Error("Failed to get Container: "+err.Error())
+		return shim.Error(err.Error())
 	}
 
-	json.Unmarshal(containerAsBytes, &container)
-	container.Owner = args[1]
+	// Only the current owner can hand the Container over.
+	if err := assertCallerActsFor(APIstub, container.Owner); err != nil {
+		return shim.Error(err.Error())
+	}
 
-	containerAsBytes, _ = json.Marshal(container)
-	APIstub.PutState(args[0], containerAsBytes)
+	if err := assertNotSuspended(APIstub, container.Owner, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// A handover between organisations needs both of them, so the new owner has to accept it.
+	crossOrg, oldOrg, newOrg := handoverRequiresBothOrgs(APIstub, container.Owner, args[1])
+	if crossOrg {
+		container.PendingOwner = args[1]
+	} else {
+		if err := verifySeal(APIstub, &container, optionalArg(args, 2), args[1]); err != nil {
+			return shim.Error("Failed to verify seal: "+err.Error())
+		}
+		container.OwnerOrganisation, err = updateHolding(APIstub, "Container", args[0], container.OwnerOrganisation, args[1])
+		if err != nil {
+			return shim.Error("Failed to update organisation index: "+err.Error())
+		}
+		container.Owner = args[1]
+		container.PendingOwner = ""
+	}
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: "+err.Error())
+	}
+
+	if crossOrg {
+		err = setKeyEndorsementOrgs(APIstub, args[0], oldOrg, newOrg)
+	} else {
+		err = setKeyEndorsementOrgs(APIstub, args[0], newOrg)
+	}
+	if err != nil {
+		return shim.Error("Failed to set endorsement policy: "+err.Error())
+	}
 
 	return shim.Success(nil)
 }
 
+// unloadContainerFromCargo - args: cargoHashId, containerHashId, and optionally the seal number seen on unloading.
+// The caller must act for the Cargo's owner or, when a Bill of Lading was issued for it, for the holder who surrendered it.
+// Whoever the caller acts for is recorded as having checked the seal.
 func (s *SmartContract) unloadContainerFromCargo(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
-	if len(args) != 2 {
-		return shim.Error("Incorrect number of arguments. Expecting 2")
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	container, err := readContainer(APIstub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if container.CargoId != args[0] {
+		return shim.Error("Container "+args[1]+" is not in Cargo "+args[0])
 	}
-	cargoAsBytes, _ := APIstub.GetState(args[0])
-	cargo := Cargo{}
 
-	json.Unmarshal(cargoAsBytes, &cargo)
+	// Containers covered by a Bill of Lading are only released to its holder, once it has been surrendered.
+	unloadedBy := cargo.Owner
+	if cargo.BillOfLading != "" {
+		bill, _, err := readBillOfLading(APIstub, cargo.BillOfLading)
+		if err != nil {
+			return shim.Error("Failed to get Bill of Lading: "+err.Error())
+		} else if bill.Status != "Surrendered" {
+			return shim.Error("Bill of Lading "+bill.BlNumber+" must be surrendered before unloading containers")
+		}
+		unloadedBy = bill.Holder
+	}
+	if err := assertCallerActsFor(APIstub, unloadedBy); err != nil {
+		return shim.Error(err.Error())
+	}
 	
 	for index, containerHashId := range cargo.AssociatedContainerHashIds {
 	
@@ -416,19 +936,25 @@ func (s *SmartContract) unloadContainerFromCargo(APIstub shim.ChaincodeStubInter
 		}
 	}
 	
-	cargoAsBytes, _ = json.Marshal(cargo)
-	APIstub.PutState(args[0], cargoAsBytes)
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: "+err.Error())
+	}
 	
 	// Update Container Status as 'Unloaded'
 	
-	containerAsBytes, _ := APIstub.GetState(args[1])
-	container := Container{}
-
-	json.Unmarshal(containerAsBytes, &container)
+	if err := verifySeal(APIstub, &container, optionalArg(args, 2), unloadedBy); err != nil {
+		return shim.Error("Failed to verify seal: "+err.Error())
+	}
 	container.Status = "Unloaded"
 	
-	containerAsBytes, _ = json.Marshal(container)
-	APIstub.PutState(args[1], containerAsBytes)
+	if err := putObject(APIstub, args[1], container); err != nil {
+		return shim.Error("Failed to update Container: "+err.Error())
+	}
+
+	// Free time for detention and demurrage starts at discharge.
+	if err := recordContainerMilestone(APIstub, args[1], "Discharged"); err != nil {
+		return shim.Error("Failed to update container metrics: "+err.Error())
+	}
 	
 	return shim.Success(nil)
 }
@@ -438,6 +964,7 @@ func (s *SmartContract) traceCargo(APIstub shim.ChaincodeStubInterface, args []s
 	type TraceCargo struct {
 		TxId    string   `json:"txId"`
 		Value   Cargo   `json:"value"`
+		Leg     string   `json:"leg,omitempty"`
 	}
 	var traceCargo []TraceCargo;
 	var cargo Cargo
@@ -469,12 +996,14 @@ func (s *SmartContract) traceCargo(APIstub shim.ChaincodeStubInterface, args []s
 			var emptyCargo Cargo
 			tx.Value = emptyCargo                 //copy nil cargo
 		} else {
+			cargo = Cargo{}
 			json.Unmarshal(traceCargoData.Value, &cargo) //un stringify it aka JSON.parse()
 			tx.Value = cargo                      //copy cargo over
+			tx.Leg = describeLegProgress(cargo)   //leg the cargo was on at this point
 		}
 		traceCargo = append(traceCargo, tx)              //add this tx to the list
 	}
-	fmt.Printf("- getTraceForCargo returning:\n%s", traceCargo)
+	fmt.Printf("- getTraceForCargo returning:\n%v", traceCargo)
 
 	//change to array of bytes
 	traceCargoAsBytes, _ := json.Marshal(traceCargo)     //convert to array of bytes
@@ -491,6 +1020,10 @@ func (s *SmartContract) trackCargoDetails(APIstub shim.ChaincodeStubInterface, a
 	if err != nil {
 		return shim.Error("Cargo doesn't exist. "+err.Error())
 	}
+	cargoAsBytes, err = upgradeRecordBytes("Cargo", cargoAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	return shim.Success(cargoAsBytes)
 }
@@ -531,12 +1064,13 @@ func (s *SmartContract) traceContainer(APIstub shim.ChaincodeStubInterface, args
 			var emptyContainer Container
 			tx.Value = emptyContainer                 //copy nil cargo
 		} else {
+			container = Container{}
 			json.Unmarshal(traceContainerData.Value, &container) //un stringify it aka JSON.parse()
 			tx.Value = container                      //copy ontainer over
 		}
 		traceContainer = append(traceContainer, tx)              //add this tx to the list
 	}
-	fmt.Printf("- getTraceForContainer returning:\n%s", traceContainer)
+	fmt.Printf("- getTraceForContainer returning:\n%v", traceContainer)
 
 	//change to array of bytes
 	traceContainerAsBytes, _ := json.Marshal(traceContainer)     //convert to array of bytes
@@ -553,6 +1087,10 @@ func (s *SmartContract) trackContainerDetails(APIstub shim.ChaincodeStubInterfac
 	if err != nil {
 		return shim.Error("Container doesn't exist. "+err.Error())
 	}
+	containerAsBytes, err = upgradeRecordBytes("Container", containerAsBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 
 	return shim.Success(containerAsBytes)
 }
@@ -580,7 +1118,7 @@ func (s *SmartContract) getLoadedContainers(APIstub shim.ChaincodeStubInterface)
 		queryValAsBytes := aKeyValue.Value
 		fmt.Println("on owner id - ", queryKeyAsStr)
 		var container Container
-		json.Unmarshal(queryValAsBytes, &container)                   //un stringify it aka JSON.parse()
+		unmarshalRecord("Container", queryValAsBytes, &container)                   //un stringify it aka JSON.parse()
 
 		if container.Status == "Loaded" {                                        //only return Loaded container
 			loadedContainers.Containers = append(loadedContainers.Containers, container)  //add this container to the list
@@ -615,7 +1153,7 @@ func (s *SmartContract) getAvilableContainers(APIstub shim.ChaincodeStubInterfac
 		queryValAsBytes := aKeyValue.Value
 		fmt.Println("on owner id - ", queryKeyAsStr)
 		var container Container
-		json.Unmarshal(queryValAsBytes, &container)                   //un stringify it aka JSON.parse()
+		unmarshalRecord("Container", queryValAsBytes, &container)                   //un stringify it aka JSON.parse()
 
 		if container.Status == "Available" {                                        //only return Loaded container
 			avilableContainers.Containers = append(avilableContainers.Containers, container)  //add this container to the list
@@ -0,0 +1,76 @@
+/*
+ * Ledger helpers shared by the Cargo and Container smart contract functions.
+ */
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// readParticipant loads a registered Participant by its HashId.
+func readParticipant(APIstub shim.ChaincodeStubInterface, hashId string) (Participant, error) {
+	participant := Participant{}
+
+	participantAsBytes, err := APIstub.GetState(hashId)
+	if err != nil {
+		return participant, fmt.Errorf("Failed to get participant: %s", err.Error())
+	} else if participantAsBytes == nil {
+		return participant, fmt.Errorf("Participant does not exist. HashId: %s", hashId)
+	}
+
+	err = unmarshalRecord("Participant", participantAsBytes, &participant)
+	return participant, err
+}
+
+// readCargo loads a Cargo by its HashId.
+func readCargo(APIstub shim.ChaincodeStubInterface, hashId string) (Cargo, error) {
+	cargo := Cargo{}
+
+	cargoAsBytes, err := APIstub.GetState(hashId)
+	if err != nil {
+		return cargo, fmt.Errorf("Failed to get Cargo: %s", err.Error())
+	} else if cargoAsBytes == nil {
+		return cargo, fmt.Errorf("Cargo does not exist. HashId: %s", hashId)
+	}
+
+	err = unmarshalRecord("Cargo", cargoAsBytes, &cargo)
+	return cargo, err
+}
+
+// readContainer loads a Container by its HashId.
+func readContainer(APIstub shim.ChaincodeStubInterface, hashId string) (Container, error) {
+	container := Container{}
+
+	containerAsBytes, err := APIstub.GetState(hashId)
+	if err != nil {
+		return container, fmt.Errorf("Failed to get Container: %s", err.Error())
+	} else if containerAsBytes == nil {
+		return container, fmt.Errorf("Container does not exist. HashId: %s", hashId)
+	}
+
+	err = unmarshalRecord("Container", containerAsBytes, &container)
+	return container, err
+}
+
+// putObject marshals value to JSON, at the current schema version, and writes it under key.
+func putObject(APIstub shim.ChaincodeStubInterface, key string, value interface{}) error {
+	valueAsBytes, err := marshalRecord(value)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutState(key, valueAsBytes)
+}
+
+// txTime returns the transaction timestamp, which is the same on every endorsing peer.
+func txTime(APIstub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := APIstub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ptypes.Timestamp(txTimestamp)
+}
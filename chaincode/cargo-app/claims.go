@@ -0,0 +1,457 @@
+/*
+ * Claims and disputes:
+ * A claim is filed against a damaged or missing Container, with the SHA-256 hashes of its
+ * evidence documents. The custodian is whoever held the Container when the incident happened,
+ * taken from its custody history. An Arbiter reviews the claim and decides it, and an accepted
+ * claim is settled by paying the award from the custodian's account to the claimant.
+ * Each step is taken by the party it names: the claimant files, the arbiter reviews and decides,
+ * and the custodian settles.
+ * Claim States --> Filed, Under Review, Accepted, Rejected, Settled.
+ */
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	claimObjectType = "Claim"
+	openClaimIndex  = "organisation~claimId"
+	arbiterRole     = "Arbiter"
+)
+
+type Claim struct {
+	ClaimId               string       `json:"claimId"`
+	ContainerId           string       `json:"containerId"`
+	CargoId               string       `json:"cargoId"`
+	Claimant              string       `json:"claimant"`
+	ClaimantOrganisation  string       `json:"claimantOrganisation"`
+	Custodian             string       `json:"custodian"`
+	CustodianOrganisation string       `json:"custodianOrganisation"`
+	Arbiter               string       `json:"arbiter"`
+	IncidentAt            string       `json:"incidentAt"`
+	Description           string       `json:"description"`
+	EvidenceHashes        []string     `json:"evidenceHashes"`
+	ClaimedAmount         int64        `json:"claimedAmount"`
+	AwardedAmount         int64        `json:"awardedAmount"`
+	Status                string       `json:"status"`
+	History               []ClaimEvent `json:"history"`
+	SchemaVersion         int          `json:"schemaVersion"`
+}
+
+// ClaimEvent is one step of a claim's workflow.
+type ClaimEvent struct {
+	Status    string `json:"status"`
+	By        string `json:"by"`
+	Note      string `json:"note"`
+	TxnId     string `json:"txnId"`
+	Timestamp string `json:"timestamp"`
+}
+
+func readClaim(APIstub shim.ChaincodeStubInterface, claimId string) (*Claim, string, error) {
+	claimKey, err := APIstub.CreateCompositeKey(claimObjectType, []string{claimId})
+	if err != nil {
+		return nil, "", err
+	}
+	claimAsBytes, err := APIstub.GetState(claimKey)
+	if err != nil || claimAsBytes == nil {
+		return nil, claimKey, err
+	}
+
+	claim := Claim{}
+	err = unmarshalRecord(claimObjectType, claimAsBytes, &claim)
+	return &claim, claimKey, err
+}
+
+// isOpen reports whether the claim still needs action from one of its parties.
+func (claim *Claim) isOpen() bool {
+	return claim.Status != "Rejected" && claim.Status != "Settled"
+}
+
+// record moves the claim to status and appends the step to its history.
+func (claim *Claim) record(APIstub shim.ChaincodeStubInterface, status string, by string, note string) error {
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	claim.Status = status
+	claim.History = append(claim.History, ClaimEvent{Status: status, By: by, Note: note, TxnId: APIstub.GetTxID(), Timestamp: now.UTC().Format(time.RFC3339)})
+	return nil
+}
+
+// indexOpenClaim adds (open == true) or removes the claim from the open claims of both parties' organisations.
+func indexOpenClaim(APIstub shim.ChaincodeStubInterface, claim *Claim, open bool) error {
+	for _, organisationId := range []string{claim.ClaimantOrganisation, claim.CustodianOrganisation} {
+		if organisationId == "" {
+			continue
+		}
+		indexKey, err := APIstub.CreateCompositeKey(openClaimIndex, []string{organisationId, claim.ClaimId})
+		if err != nil {
+			return err
+		}
+		if open {
+			err = APIstub.PutState(indexKey, []byte{0x00})
+		} else {
+			err = APIstub.DelState(indexKey)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containerAt returns the Container as it was recorded on the ledger at the given time.
+func containerAt(APIstub shim.ChaincodeStubInterface, containerId string, at time.Time) (Container, error) {
+	container := Container{}
+
+	version, err := versionAt(APIstub, containerId, at)
+	if err != nil {
+		return container, err
+	} else if version == nil {
+		return container, fmt.Errorf("Container %s was not on the ledger at %s", containerId, at.Format(time.RFC3339))
+	}
+
+	err = json.Unmarshal(version.Value, &container)
+	return container, err
+}
+
+// parseEvidenceHashes splits a comma separated list of hex encoded SHA-256 hashes.
+func parseEvidenceHashes(value string) ([]string, error) {
+	hashes := []string{}
+	if value == "" {
+		return hashes, nil
+	}
+	for _, hash := range strings.Split(value, ",") {
+		if err := validateSha256Hex(hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, strings.ToLower(hash))
+	}
+	return hashes, nil
+}
+
+// validateSha256Hex checks that hash is a hex encoded SHA-256 hash of a document.
+func validateSha256Hex(hash string) error {
+	decoded, err := hex.DecodeString(hash)
+	if err != nil || len(decoded) != 32 {
+		return fmt.Errorf("Document hash %s is not a hex encoded SHA-256 hash", hash)
+	}
+	return nil
+}
+
+// fileClaim - args: claimId, containerId, cargoId (may be empty), claimant, incidentAt (RFC3339), description, claimedAmount, evidenceHashes (comma separated)
+func (s *SmartContract) fileClaim(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 8 {
+		return shim.Error("Incorrect number of arguments. Expecting 8")
+	}
+
+	claim, claimKey, err := readClaim(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get claim: " + err.Error())
+	} else if claim != nil {
+		return shim.Error("This Claim already exists. ClaimId: " + args[0])
+	}
+
+	incidentAt, err := time.Parse(time.RFC3339, args[4])
+	if err != nil {
+		return shim.Error("incidentAt must be in RFC3339 format: " + err.Error())
+	}
+	claimedAmount, err := strconv.ParseInt(args[6], 10, 64)
+	if err != nil || claimedAmount < 0 {
+		return shim.Error("Claimed amount must be a whole number of ledger units")
+	}
+	evidenceHashes, err := parseEvidenceHashes(args[7])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if _, err := readParticipant(APIstub, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	container, err := containerAt(APIstub, args[1], incidentAt)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if args[2] != "" && container.CargoId != args[2] {
+		return shim.Error("Container " + args[1] + " was not part of Cargo " + args[2] + " at the time of the incident")
+	} else if container.Owner == args[3] {
+		return shim.Error("The claimant held the Container at the time of the incident")
+	}
+
+	claimantOrganisation, _ := resolveOwner(APIstub, args[3])
+	custodianOrganisation, _ := resolveOwner(APIstub, container.Owner)
+
+	claim = &Claim{ClaimId: args[0], ContainerId: args[1], CargoId: args[2], Claimant: args[3], ClaimantOrganisation: claimantOrganisation, Custodian: container.Owner, CustodianOrganisation: custodianOrganisation, IncidentAt: args[4], Description: args[5], EvidenceHashes: evidenceHashes, ClaimedAmount: claimedAmount, History: []ClaimEvent{}}
+	if err := claim.record(APIstub, "Filed", args[3], args[5]); err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+
+	if err := putObject(APIstub, claimKey, claim); err != nil {
+		return shim.Error("Failed to record claim: " + err.Error())
+	}
+	if err := indexOpenClaim(APIstub, claim, true); err != nil {
+		return shim.Error("Failed to update open claims index: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// addClaimEvidence - args: claimId, participant, evidenceHashes (comma separated). Any party to an open claim may add evidence.
+func (s *SmartContract) addClaimEvidence(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	claim, claimKey, err := readClaim(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get claim: " + err.Error())
+	} else if claim == nil {
+		return shim.Error("Claim does not exist. ClaimId: " + args[0])
+	} else if claim.Status != "Filed" && claim.Status != "Under Review" {
+		return shim.Error("Evidence cannot be added to a claim that is " + claim.Status)
+	} else if args[1] != claim.Claimant && args[1] != claim.Custodian && args[1] != claim.Arbiter {
+		return shim.Error("Only the claimant, custodian or arbiter can add evidence to a claim")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	evidenceHashes, err := parseEvidenceHashes(args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, hash := range evidenceHashes {
+		if !contains(claim.EvidenceHashes, hash) {
+			claim.EvidenceHashes = append(claim.EvidenceHashes, hash)
+		}
+	}
+
+	if err := putObject(APIstub, claimKey, claim); err != nil {
+		return shim.Error("Failed to update claim: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// reviewClaim - args: claimId, arbiter. The arbiter must hold the Arbiter role and be independent of both parties to the claim:
+// neither of them, nor in the organisation or MSP of either.
+func (s *SmartContract) reviewClaim(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	claim, claimKey, err := readClaim(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get claim: " + err.Error())
+	} else if claim == nil {
+		return shim.Error("Claim does not exist. ClaimId: " + args[0])
+	} else if claim.Status != "Filed" {
+		return shim.Error("Only Filed claims can be taken under review")
+	}
+
+	arbiter, err := readParticipant(APIstub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if arbiter.Role != arbiterRole {
+		return shim.Error("Participant " + args[1] + " is not an " + arbiterRole)
+	} else if args[1] == claim.Claimant || args[1] == claim.Custodian {
+		return shim.Error("A party to the claim cannot arbitrate it")
+	}
+	parties := []struct{ hashId, organisationId string }{{claim.Claimant, claim.ClaimantOrganisation}, {claim.Custodian, claim.CustodianOrganisation}}
+	for _, party := range parties {
+		organisationId, mspId := resolveOwner(APIstub, party.hashId)
+		if arbiter.OrganisationId != "" && (arbiter.OrganisationId == party.organisationId || arbiter.OrganisationId == organisationId) {
+			return shim.Error("Arbiter " + args[1] + " belongs to organisation " + arbiter.OrganisationId + " of party " + party.hashId)
+		} else if mspId != "" && arbiter.MspId == mspId {
+			return shim.Error("Arbiter " + args[1] + " belongs to " + mspId + ", the MSP of party " + party.hashId)
+		}
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	claim.Arbiter = args[1]
+	if err := claim.record(APIstub, "Under Review", args[1], ""); err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+
+	if err := putObject(APIstub, claimKey, claim); err != nil {
+		return shim.Error("Failed to update claim: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// decideClaim - args: claimId, arbiter, decision (Accepted or Rejected), awardedAmount, note
+func (s *SmartContract) decideClaim(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	claim, claimKey, err := readClaim(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get claim: " + err.Error())
+	} else if claim == nil {
+		return shim.Error("Claim does not exist. ClaimId: " + args[0])
+	} else if claim.Status != "Under Review" {
+		return shim.Error("Only claims Under Review can be decided")
+	} else if args[1] != claim.Arbiter {
+		return shim.Error("Only the claim's arbiter can decide it")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	switch args[2] {
+	case "Accepted":
+		awardedAmount, err := strconv.ParseInt(args[3], 10, 64)
+		if err != nil || awardedAmount < 0 || awardedAmount > claim.ClaimedAmount {
+			return shim.Error("Awarded amount must be a whole number of ledger units no greater than the amount claimed")
+		}
+		claim.AwardedAmount = awardedAmount
+	case "Rejected":
+		if err := indexOpenClaim(APIstub, claim, false); err != nil {
+			return shim.Error("Failed to update open claims index: " + err.Error())
+		}
+	default:
+		return shim.Error("Invalid decision " + args[2] + ". Expecting Accepted or Rejected")
+	}
+
+	if err := claim.record(APIstub, args[2], args[1], args[4]); err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+
+	if err := putObject(APIstub, claimKey, claim); err != nil {
+		return shim.Error("Failed to update claim: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// settleClaim - args: claimId. Pays the award from the custodian's account to the claimant, which the custodian's organisation must endorse.
+// The caller must act for the custodian, who pays the award.
+func (s *SmartContract) settleClaim(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	claim, claimKey, err := readClaim(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get claim: " + err.Error())
+	} else if claim == nil {
+		return shim.Error("Claim does not exist. ClaimId: " + args[0])
+	} else if claim.Status != "Accepted" {
+		return shim.Error("Only Accepted claims can be settled")
+	}
+	if err := assertCallerActsFor(APIstub, claim.Custodian); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if claim.AwardedAmount > 0 {
+		if err := creditAccount(APIstub, claim.Custodian, -claim.AwardedAmount); err != nil {
+			return shim.Error("Failed to settle claim: " + err.Error())
+		}
+		if err := creditAccount(APIstub, claim.Claimant, claim.AwardedAmount); err != nil {
+			return shim.Error("Failed to settle claim: " + err.Error())
+		}
+	}
+
+	if err := claim.record(APIstub, "Settled", claim.Custodian, ""); err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	if err := indexOpenClaim(APIstub, claim, false); err != nil {
+		return shim.Error("Failed to update open claims index: " + err.Error())
+	}
+
+	if err := putObject(APIstub, claimKey, claim); err != nil {
+		return shim.Error("Failed to update claim: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+func (s *SmartContract) getClaim(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	claim, _, err := readClaim(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get claim: " + err.Error())
+	} else if claim == nil {
+		return shim.Error("Claim does not exist. ClaimId: " + args[0])
+	}
+
+	claimAsBytes, _ := json.Marshal(claim)
+	return shim.Success(claimAsBytes)
+}
+
+// getOpenClaimsByOrganisation - args: organisationId. Returns the open claims the organisation is claimant or custodian in.
+func (s *SmartContract) getOpenClaimsByOrganisation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type OrganisationClaims struct {
+		Claims []Claim `json:"claims"`
+	}
+	var organisationClaims OrganisationClaims
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	claimsIterator, err := APIstub.GetStateByPartialCompositeKey(openClaimIndex, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer claimsIterator.Close()
+
+	for claimsIterator.HasNext() {
+		indexEntry, err := claimsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(indexEntry.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		claim, _, err := readClaim(APIstub, keyParts[1])
+		if err != nil {
+			return shim.Error("Failed to get claim: " + err.Error())
+		} else if claim != nil && claim.isOpen() {
+			organisationClaims.Claims = append(organisationClaims.Claims, *claim)
+		}
+	}
+
+	organisationClaimsAsBytes, _ := json.Marshal(organisationClaims)
+	return shim.Success(organisationClaimsAsBytes)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseEvidenceHashes(t *testing.T) {
+	hash := sha256.Sum256([]byte("survey report"))
+	valid := hex.EncodeToString(hash[:])
+
+	tests := []struct {
+		value   string
+		count   int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{valid, 1, false},
+		{strings.ToUpper(valid) + "," + valid, 2, false},
+		{valid[:62], 0, true},
+		{"not-a-hash", 0, true},
+		{valid + ",", 0, true},
+	}
+	for _, test := range tests {
+		hashes, err := parseEvidenceHashes(test.value)
+		if (err != nil) != test.wantErr || len(hashes) != test.count {
+			t.Errorf("parseEvidenceHashes(%q) = %v, %v; want %d hashes, wantErr %v", test.value, hashes, err, test.count, test.wantErr)
+		}
+	}
+}
+
+func TestClaimCallers(t *testing.T) {
+	stub := newTestStub(t)
+	for hashId, role := range map[string]string{"CLAIMANT": "Importer", "CUSTODIAN": "Transporter", "COLLEAGUE": arbiterRole} {
+		stub.registerTestParticipant(testMspId, hashId, role)
+	}
+	stub.registerTestParticipant(otherTestMspId, "ARBITER", arbiterRole)
+	stub.seedTestRecord("Container", "C1", "CUSTODIAN", Container{HashId: "C1", Owner: "CUSTODIAN", Status: "In-Transit"})
+	stub.asAdmin(testMspId).mustInvoke("depositFunds", "CUSTODIAN", "500")
+
+	incidentAt := stub.now.Add(time.Minute).Format(time.RFC3339)
+	file := []string{"CL1", "C1", "", "CLAIMANT", incidentAt, "Water damage", "300", ""}
+	stub.asParticipant(testMspId, "CUSTODIAN").mustFail("not participant CLAIMANT", "fileClaim", file...)
+	stub.asParticipant(testMspId, "CLAIMANT").mustInvoke("fileClaim", file...)
+
+	stub.asParticipant(testMspId, "CLAIMANT").mustFail("not participant ARBITER", "reviewClaim", "CL1", "ARBITER")
+	// An arbiter from the same organisation as a party is not independent of it.
+	stub.asParticipant(testMspId, "COLLEAGUE").mustFail("Arbiter COLLEAGUE belongs to Org1MSP, the MSP of party CLAIMANT", "reviewClaim", "CL1", "COLLEAGUE")
+	stub.asParticipant(otherTestMspId, "ARBITER").mustInvoke("reviewClaim", "CL1", "ARBITER")
+	stub.asParticipant(testMspId, "CLAIMANT").mustFail("not participant ARBITER", "decideClaim", "CL1", "ARBITER", "Accepted", "300", "Liable")
+	stub.asParticipant(otherTestMspId, "ARBITER").mustInvoke("decideClaim", "CL1", "ARBITER", "Accepted", "300", "Liable")
+
+	stub.asParticipant(testMspId, "CLAIMANT").mustFail("not participant CUSTODIAN", "settleClaim", "CL1")
+	stub.asParticipant(testMspId, "CUSTODIAN").mustInvoke("settleClaim", "CL1")
+
+	var claim Claim
+	if err := stub.run(func() error {
+		found, _, err := readClaim(stub, "CL1")
+		if found != nil {
+			claim = *found
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if claim.Status != "Settled" {
+		t.Errorf("claim status = %s, want Settled", claim.Status)
+	}
+}
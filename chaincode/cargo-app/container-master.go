@@ -0,0 +1,145 @@
+/*
+ * Container master data:
+ * Every Container is identified by its ISO 6346 container number (owner code, category,
+ * serial number and check digit), which can only be registered once whatever its HashId.
+ * Size/type codes follow ISO 6346 (22G1, 45R1, ...), and weights are whole kilograms.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const containerNumberIndex = "containerNumber~hashId"
+
+var (
+	containerNumberPattern = regexp.MustCompile(`^[A-Z]{3}[UJZ][0-9]{7}$`)
+	sizeTypeCodePattern    = regexp.MustCompile(`^[1-4B-HK-NP][0245689C-FL-NP][GVBSRHUPTAKN][0-9]$`)
+)
+
+// normaliseContainerNumber drops the spaces and dash often printed in container numbers ("MSKU 123456-7").
+func normaliseContainerNumber(containerNumber string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(containerNumber))
+}
+
+// isoCharValue is the ISO 6346 value of a container number character. Letters skip multiples of 11.
+func isoCharValue(c byte) int {
+	if c >= '0' && c <= '9' {
+		return int(c - '0')
+	}
+	value := 10
+	for letter := byte('A'); letter < c; letter++ {
+		value++
+		if value%11 == 0 {
+			value++
+		}
+	}
+	return value
+}
+
+// validateContainerNumber checks the format and check digit of a normalised ISO 6346 container number.
+func validateContainerNumber(containerNumber string) error {
+	if !containerNumberPattern.MatchString(containerNumber) {
+		return fmt.Errorf("Container number %s is not in ISO 6346 format (owner code, category U/J/Z, 6 digit serial, check digit)", containerNumber)
+	}
+
+	sum := 0
+	for i := 0; i < 10; i++ {
+		sum += isoCharValue(containerNumber[i]) << uint(i)
+	}
+	checkDigit := sum % 11 % 10
+	if int(containerNumber[10]-'0') != checkDigit {
+		return fmt.Errorf("Container number %s has an invalid check digit. Expecting %d", containerNumber, checkDigit)
+	}
+	return nil
+}
+
+// parseWeight parses a weight in whole kilograms.
+func parseWeight(name string, value string) (int64, error) {
+	weight, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || weight <= 0 {
+		return 0, fmt.Errorf("%s must be a positive whole number of kilograms", name)
+	}
+	return weight, nil
+}
+
+// setContainerMasterData validates the master data arguments and fills them in on container,
+// reserving the container number for it. args: containerNumber, sizeTypeCode, tareWeight, maxPayload
+func setContainerMasterData(APIstub shim.ChaincodeStubInterface, container *Container, args []string) error {
+	containerNumber := normaliseContainerNumber(args[0])
+	if err := validateContainerNumber(containerNumber); err != nil {
+		return err
+	}
+
+	sizeTypeCode := strings.ToUpper(args[1])
+	if !sizeTypeCodePattern.MatchString(sizeTypeCode) {
+		return fmt.Errorf("Size/type code %s is not an ISO 6346 code such as 22G1 or 45R1", args[1])
+	}
+
+	tareWeight, err := parseWeight("Tare weight", args[2])
+	if err != nil {
+		return err
+	}
+	maxPayload, err := parseWeight("Max payload", args[3])
+	if err != nil {
+		return err
+	}
+
+	registeredHashId, numberKey, err := readContainerNumber(APIstub, containerNumber)
+	if err != nil {
+		return err
+	} else if registeredHashId != "" {
+		return fmt.Errorf("Container number %s is already registered. HashId: %s", containerNumber, registeredHashId)
+	}
+	if err := APIstub.PutState(numberKey, []byte(container.HashId)); err != nil {
+		return err
+	}
+
+	container.ContainerNumber = containerNumber
+	container.SizeTypeCode = sizeTypeCode
+	container.TareWeight = strconv.FormatInt(tareWeight, 10)
+	container.MaxPayload = strconv.FormatInt(maxPayload, 10)
+	container.MaxGrossWeight = strconv.FormatInt(tareWeight+maxPayload, 10)
+	return nil
+}
+
+// readContainerNumber returns the HashId a container number is registered under, or "" if it is free.
+func readContainerNumber(APIstub shim.ChaincodeStubInterface, containerNumber string) (string, string, error) {
+	numberKey, err := APIstub.CreateCompositeKey(containerNumberIndex, []string{containerNumber})
+	if err != nil {
+		return "", "", err
+	}
+	hashIdAsBytes, err := APIstub.GetState(numberKey)
+	return string(hashIdAsBytes), numberKey, err
+}
+
+// getContainerByNumber - args: containerNumber (ISO 6346)
+func (s *SmartContract) getContainerByNumber(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	hashId, _, err := readContainerNumber(APIstub, normaliseContainerNumber(args[0]))
+	if err != nil {
+		return shim.Error("Failed to get container number: " + err.Error())
+	} else if hashId == "" {
+		return shim.Error("Container number is not registered: " + args[0])
+	}
+
+	container, err := readContainer(APIstub, hashId)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	containerAsBytes, _ := json.Marshal(container)
+	return shim.Success(containerAsBytes)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIsoCharValue(t *testing.T) {
+	tests := []struct {
+		c     byte
+		value int
+	}{
+		{'0', 0}, {'9', 9}, {'A', 10}, {'B', 12}, {'K', 21}, {'L', 23}, {'U', 32}, {'V', 34}, {'Z', 38},
+	}
+	for _, test := range tests {
+		if value := isoCharValue(test.c); value != test.value {
+			t.Errorf("isoCharValue(%c) = %d, want %d", test.c, value, test.value)
+		}
+	}
+}
+
+func TestValidateContainerNumber(t *testing.T) {
+	tests := []struct {
+		containerNumber string
+		wantErr         bool
+	}{
+		{"CSQU3054383", false},
+		{"MSCU6639870", false},
+		{"CSQU3054384", true},
+		{"CSQX3054383", true},
+		{"CSQU305438", true},
+		{"csqu3054383", true},
+		{normaliseContainerNumber("csqu 305438-3"), false},
+	}
+	for _, test := range tests {
+		if err := validateContainerNumber(test.containerNumber); (err != nil) != test.wantErr {
+			t.Errorf("validateContainerNumber(%s) = %v, wantErr %v", test.containerNumber, err, test.wantErr)
+		}
+	}
+}
+
+func TestContainerMasterData(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+
+	container := func(hashId string, containerNumber string, sizeTypeCode string, tareWeight string) []string {
+		return []string{hashId, "2020-03-01T08:00:00Z", "Maersk", "Available", "", "CARRIER", "", "Pending", "Mumbai", "Rotterdam", "Mumbai", containerNumber, sizeTypeCode, tareWeight, "28280"}
+	}
+
+	stub.asParticipant(testMspId, "CARRIER")
+	stub.mustFail("invalid check digit", "addNewContainer", container("C1", "CSQU3054384", "22G1", "2200")...)
+	stub.mustFail("is not an ISO 6346 code", "addNewContainer", container("C1", "CSQU3054383", "22X1", "2200")...)
+	stub.mustFail("Tare weight must be a positive whole number", "addNewContainer", container("C1", "CSQU3054383", "22G1", "-1")...)
+	stub.mustInvoke("addNewContainer", container("C1", "csqu 305438-3", "22g1", "2200")...)
+	stub.mustFail("is already registered. HashId: C1", "addNewContainer", container("C2", "CSQU3054383", "22G1", "2200")...)
+	// Registering the HashId again would wipe the live Container.
+	stub.mustFail("This Container record already exists. HashId: C1", "addNewContainer", container("C1", "MSCU6639870", "22G1", "2200")...)
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant CARRIER", "addNewContainer", container("C2", "MSCU6639870", "22G1", "2200")...)
+	stub.asParticipant(testMspId, "CARRIER")
+
+	var registered Container
+	if err := json.Unmarshal(stub.mustInvoke("getContainerByNumber", "CSQU 305438-3"), &registered); err != nil {
+		t.Fatal(err)
+	}
+	if registered.HashId != "C1" || registered.ContainerNumber != "CSQU3054383" || registered.SizeTypeCode != "22G1" || registered.MaxGrossWeight != "30480" {
+		t.Errorf("getContainerByNumber() = %s %s %s max gross %s, want C1 CSQU3054383 22G1 max gross 30480", registered.HashId, registered.ContainerNumber, registered.SizeTypeCode, registered.MaxGrossWeight)
+	}
+}
+
+func TestAddNewContainerSupplier(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(otherTestMspId, "SUPPLIER", "Container Supplier")
+
+	container := func(hashId string, owner string, containerNumber string) []string {
+		return []string{hashId, "2020-03-01T08:00:00Z", "Maersk", "Available", "", owner, "", "Pending", "Mumbai", "Rotterdam", "Mumbai", containerNumber, "22G1", "2200", "28280", "SUPPLIER"}
+	}
+
+	// An owner cannot put its container on a supplier's books, and so under its demurrage tariff.
+	stub.asParticipant(testMspId, "CARRIER").mustFail("Caller is not participant SUPPLIER", "addNewContainer", container("C1", "CARRIER", "CSQU3054383")...)
+	stub.asParticipant(otherTestMspId, "SUPPLIER").mustFail("Caller is not participant CARRIER", "addNewContainer", container("C1", "CARRIER", "CSQU3054383")...)
+	stub.asParticipant(otherTestMspId, "SUPPLIER").mustInvoke("addNewContainer", container("C1", "SUPPLIER", "CSQU3054383")...)
+
+	var registered Container
+	stub.readTestRecord("C1", &registered)
+	if registered.Supplier != "SUPPLIER" || registered.Owner != "SUPPLIER" {
+		t.Errorf("C1 is held by %s for supplier %s, want SUPPLIER for SUPPLIER", registered.Owner, registered.Supplier)
+	}
+}
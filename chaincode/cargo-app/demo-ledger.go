@@ -0,0 +1,160 @@
+/*
+ * Demo dataset:
+ * initLedger seeds a small, consistent dataset to try the network out with: an Organisation of the
+ * instantiating MSP with one participant per role, and three Containers of which two are packed,
+ * weighed and sealed in a Cargo sailing from Shanghai to Rotterdam under a confirmed booking.
+ * Each record is only written if its key is free, so calling initLedger again on upgrade leaves
+ * the dataset, and anything done with it since, as it is.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+const (
+	demoOrganisationId = "DEMO-ORG"
+	demoSupplierId     = "DEMO-SUPPLIER"
+	demoTransporterId  = "DEMO-TRANSPORTER"
+	demoExporterId     = "DEMO-EXPORTER"
+	demoBookingId      = "DEMO-BKG-1"
+	demoCargoId        = "DEMO-CARGO-1"
+)
+
+// seedObject writes value under key, endorsed by mspId, unless the key is already in use.
+// It reports whether the value was written.
+func seedObject(APIstub shim.ChaincodeStubInterface, key string, value interface{}, mspId string) (bool, error) {
+	existingAsBytes, err := APIstub.GetState(key)
+	if err != nil {
+		return false, err
+	} else if existingAsBytes != nil {
+		return false, nil
+	}
+
+	if err := putObject(APIstub, key, value); err != nil {
+		return false, err
+	}
+	return true, setKeyEndorsementOrgs(APIstub, key, mspId)
+}
+
+// seedDemoLedger writes the demo dataset. Writes in a transaction are not visible to its own reads,
+// so the records are built here rather than through the functions that would normally create them.
+func seedDemoLedger(APIstub shim.ChaincodeStubInterface) error {
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	stamp := now.UTC().Format(time.RFC3339)
+
+	organisationKey, err := APIstub.CreateCompositeKey(organisationObjectType, []string{demoOrganisationId})
+	if err != nil {
+		return err
+	}
+	organisation := Organisation{OrganisationId: demoOrganisationId, LegalName: "Demo Shipping Ltd", MspId: mspId, Country: "NL", Roles: []string{"Container Supplier", "Transporter", "Exporter", "Importer", customsOfficerRole}, RegistrationNumbers: map[string]string{"EORI": "NL000000001"}}
+	if _, err := seedObject(APIstub, organisationKey, organisation, mspId); err != nil {
+		return err
+	}
+
+	participants := []Participant{
+		{HashId: demoSupplierId, Name: "Demo Container Leasing", EmailId: "depot@supplier.demo", Role: "Container Supplier"},
+		{HashId: demoTransporterId, Name: "Demo Ocean Lines", EmailId: "ops@transporter.demo", Role: "Transporter"},
+		{HashId: demoExporterId, Name: "Demo Exports Co", EmailId: "shipping@exporter.demo", Role: "Exporter"},
+		{HashId: "DEMO-IMPORTER", Name: "Demo Imports BV", EmailId: "receiving@importer.demo", Role: "Importer"},
+		{HashId: "DEMO-CUSTOMS", Name: "Demo Customs Office", EmailId: "officer@customs.demo", Role: customsOfficerRole},
+	}
+	for _, participant := range participants {
+		participant.MspId = mspId
+		participant.OrganisationId = demoOrganisationId
+		participant.Status = participantActiveStatus
+		participant.RoleHistory = []RoleAssignment{{Role: participant.Role, EffectiveFrom: stamp, AssignedBy: "initLedger"}}
+
+		seeded, err := seedObject(APIstub, participant.HashId, participant, mspId)
+		if err != nil {
+			return err
+		} else if seeded {
+			if err := moveHolding(APIstub, "Participant", participant.HashId, "", demoOrganisationId); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Container HashIds fall in the range scanned by getLoadedContainers and getAvilableContainers.
+	var packedContainerIds []string
+	for i, containerNumber := range []string{"DEMU1000010", "DEMU1000026", "DEMU1000031"} {
+		hashId := strconv.Itoa(9000001 + i)
+		packed := i < 2
+		if packed {
+			packedContainerIds = append(packedContainerIds, hashId)
+		}
+
+		containerAsBytes, err := APIstub.GetState(hashId)
+		if err != nil {
+			return err
+		} else if containerAsBytes != nil {
+			continue
+		}
+
+		container := Container{HashId: hashId, Timestamp: stamp, Manufacturer: "CIMC", Supplier: demoSupplierId, Status: "Available", Owner: demoTransporterId, OwnerOrganisation: demoOrganisationId, CustomClearanceStatus: "Pending", ShippedFrom: "Shanghai", ShippedTo: "Rotterdam", ContainerLocation: "Shanghai"}
+		if err := setContainerMasterData(APIstub, &container, []string{containerNumber, "22G1", "2200", "28280"}); err != nil {
+			return err
+		}
+		milestone := "Available"
+		if packed {
+			weight := strconv.Itoa(14000 + 2500*i)
+			signatureHash := fmt.Sprintf("%x", sha256.Sum256([]byte("VGM "+containerNumber+" "+weight)))
+			container.Status = "InCargo"
+			container.CargoId = demoCargoId
+			container.LoadedItems = "Machine parts, " + strconv.Itoa(18+i*4) + " pallets"
+			container.ContainerLocation = "East China Sea"
+			container.Seal = Seal{SealNumber: "DEMO" + strconv.Itoa(700001+i), Type: "Bolt", AppliedBy: demoExporterId, AppliedAt: "Shanghai", Timestamp: stamp, Status: sealIntactStatus}
+			container.Vgm = Vgm{Method: "Method 1", Weight: weight, ResponsibleParty: demoExporterId, SignatureHash: signatureHash, DeclaredAt: stamp, TxnId: APIstub.GetTxID()}
+			milestone = "Loaded"
+		}
+
+		if err := putObject(APIstub, hashId, container); err != nil {
+			return err
+		}
+		if err := setKeyEndorsementOrgs(APIstub, hashId, mspId); err != nil {
+			return err
+		}
+		if err := moveHolding(APIstub, "Container", hashId, "", demoOrganisationId); err != nil {
+			return err
+		}
+		if err := recordContainerMilestone(APIstub, hashId, milestone); err != nil {
+			return err
+		}
+		if err := createCustomsClearance(APIstub, hashId, container.CustomClearanceStatus, stamp); err != nil {
+			return err
+		}
+	}
+
+	booking, bookingKey, err := readBooking(APIstub, demoBookingId)
+	if err != nil {
+		return err
+	} else if booking == nil {
+		containers := map[string]int{"22G1": len(packedContainerIds)}
+		booking = &Booking{BookingId: demoBookingId, Shipper: demoExporterId, Transporter: demoTransporterId, ShippedFrom: "Shanghai", ShippedTo: "Rotterdam", RequestedContainers: containers, RequestedDeparture: now.Add(-48 * time.Hour).UTC().Format(time.RFC3339), RequestedArrival: now.Add(28 * 24 * time.Hour).UTC().Format(time.RFC3339), AllocatedContainers: containers, UsedContainers: containers, CargoIds: []string{demoCargoId}, Status: "Confirmed"}
+		if _, err := seedObject(APIstub, bookingKey, booking, mspId); err != nil {
+			return err
+		}
+	}
+
+	cargo := Cargo{HashId: demoCargoId, TxnId: APIstub.GetTxID(), Timestamp: stamp, CargoId: "CGO-0001", ShippedFrom: "Shanghai", ShippedTo: "Rotterdam", CargoLocation: "East China Sea", TransportationType: "Sea", ContainerQty: strconv.Itoa(len(packedContainerIds)), Owner: demoTransporterId, OwnerOrganisation: demoOrganisationId, AssociatedContainerHashIds: packedContainerIds, Status: "In-Transit", BookingId: demoBookingId}
+	seeded, err := seedObject(APIstub, demoCargoId, cargo, mspId)
+	if err != nil {
+		return err
+	} else if seeded {
+		return moveHolding(APIstub, "Cargo", demoCargoId, "", demoOrganisationId)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+/*
+ * Detention and demurrage:
+ * The free-time clock of a Container starts when it is discharged (unloaded from its Cargo)
+ * and stops when it is returned empty to a depot. Each Container Supplier keeps a tariff on the
+ * ledger: a number of free days, then daily rates in tiers counted from the first chargeable day.
+ * Charges are in the same ledger units as the freight escrow. Suppliers without a tariff are
+ * charged the default tariff of the ledger configuration, if there is one.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const demurrageTariffObjectType = "DemurrageTariff"
+
+// DemurrageTariff is a supplier's detention and demurrage tariff.
+type DemurrageTariff struct {
+	SupplierId    string          `json:"supplierId"`
+	Currency      string          `json:"currency"`
+	FreeDays      int64           `json:"freeDays"`
+	Tiers         []DemurrageTier `json:"tiers"`
+	SchemaVersion int             `json:"schemaVersion"`
+}
+
+// DemurrageTier charges DailyRate from chargeable day FromDay (1 is the first day after free time) until the next tier.
+type DemurrageTier struct {
+	FromDay   int64 `json:"fromDay"`
+	DailyRate int64 `json:"dailyRate"`
+}
+
+func readDemurrageTariff(APIstub shim.ChaincodeStubInterface, supplierId string) (*DemurrageTariff, string, error) {
+	tariffKey, err := APIstub.CreateCompositeKey(demurrageTariffObjectType, []string{supplierId})
+	if err != nil {
+		return nil, "", err
+	}
+	tariffAsBytes, err := APIstub.GetState(tariffKey)
+	if err != nil || tariffAsBytes == nil {
+		return nil, tariffKey, err
+	}
+
+	tariff := DemurrageTariff{}
+	err = unmarshalRecord(demurrageTariffObjectType, tariffAsBytes, &tariff)
+	return &tariff, tariffKey, err
+}
+
+// demurrageTariffFor returns the tariff in force for the Containers of a supplier: its own, or else the default
+// tariff of the ledger configuration. It returns nil when there is neither.
+func demurrageTariffFor(APIstub shim.ChaincodeStubInterface, supplierId string) (*DemurrageTariff, error) {
+	tariff, _, err := readDemurrageTariff(APIstub, supplierId)
+	if err != nil || tariff != nil {
+		return tariff, err
+	}
+
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return nil, err
+	}
+	return config.DefaultTariff, nil
+}
+
+// charge returns the charge for a number of chargeable days.
+func (tariff *DemurrageTariff) charge(chargeableDays int64) int64 {
+	var charges int64
+	for i, tier := range tariff.Tiers {
+		lastDay := chargeableDays
+		if i+1 < len(tariff.Tiers) && tariff.Tiers[i+1].FromDay-1 < lastDay {
+			lastDay = tariff.Tiers[i+1].FromDay - 1
+		}
+		if lastDay >= tier.FromDay {
+			charges += (lastDay - tier.FromDay + 1) * tier.DailyRate
+		}
+	}
+	return charges
+}
+
+// validate checks a tariff's free days and tiers, sorting the tiers by fromDay.
+func (tariff *DemurrageTariff) validate() error {
+	if tariff.FreeDays < 0 {
+		return fmt.Errorf("Free days cannot be negative")
+	} else if len(tariff.Tiers) == 0 {
+		return fmt.Errorf("Tariff needs at least one tier")
+	}
+	sort.Slice(tariff.Tiers, func(i, j int) bool { return tariff.Tiers[i].FromDay < tariff.Tiers[j].FromDay })
+	for i, tier := range tariff.Tiers {
+		if tier.FromDay < 1 || tier.DailyRate < 0 || (i > 0 && tier.FromDay == tariff.Tiers[i-1].FromDay) {
+			return fmt.Errorf("Tiers need distinct fromDay values of 1 or more and daily rates of 0 or more")
+		}
+	}
+	if tariff.Tiers[0].FromDay != 1 {
+		return fmt.Errorf("The first tier must start on chargeable day 1")
+	}
+	return nil
+}
+
+// parseSupplierTariff checks that supplierId is a Container Supplier and decodes and validates its tariff.
+func parseSupplierTariff(APIstub shim.ChaincodeStubInterface, supplierId string, tariffAsBytes []byte) (Participant, DemurrageTariff, error) {
+	tariff := DemurrageTariff{}
+
+	supplier, err := readParticipant(APIstub, supplierId)
+	if err != nil {
+		return supplier, tariff, err
+	} else if supplier.Role != "Container Supplier" {
+		return supplier, tariff, fmt.Errorf("Participant %s is not a Container Supplier", supplierId)
+	}
+
+	if err := json.Unmarshal(tariffAsBytes, &tariff); err != nil {
+		return supplier, tariff, fmt.Errorf("Failed to decode tariff: %s", err.Error())
+	}
+	if err := tariff.validate(); err != nil {
+		return supplier, tariff, err
+	}
+	tariff.SupplierId = supplierId
+	return supplier, tariff, nil
+}
+
+// writeSupplierTariff records a supplier's tariff, endorsed by the supplier's organisation.
+func writeSupplierTariff(APIstub shim.ChaincodeStubInterface, supplier Participant, tariff DemurrageTariff) error {
+	_, tariffKey, err := readDemurrageTariff(APIstub, tariff.SupplierId)
+	if err != nil {
+		return fmt.Errorf("Failed to get tariff: %s", err.Error())
+	}
+	if err := putObject(APIstub, tariffKey, tariff); err != nil {
+		return fmt.Errorf("Failed to record tariff: %s", err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, tariffKey, supplier.MspId); err != nil {
+		return fmt.Errorf("Failed to set endorsement policy: %s", err.Error())
+	}
+	return nil
+}
+
+// setDemurrageTariff - args: supplierId, tariff (JSON, e.g. {"currency":"USD","freeDays":5,"tiers":[{"fromDay":1,"dailyRate":50},{"fromDay":8,"dailyRate":100}]})
+// Only an admin of the supplier's organisation can set its tariff, and only while governance is not configured;
+// under governance a tariff is a supplierTariff proposal.
+func (s *SmartContract) setDemurrageTariff(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	supplier, tariff, err := parseSupplierTariff(APIstub, args[0], []byte(args[1]))
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertOrgAdmin(APIstub, supplier.MspId); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertUngoverned(APIstub, supplierTariffChangeType); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := writeSupplierTariff(APIstub, supplier, tariff); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getDemurrage - args: containerHashId. Returns the days accrued since discharge and the charges under the tariff in force at discharge.
+// While the Container has not been returned, the clock runs until the time of the query.
+func (s *SmartContract) getDemurrage(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type Demurrage struct {
+		ContainerId     string `json:"containerId"`
+		Supplier        string `json:"supplier"`
+		DischargedAt    string `json:"dischargedAt"`
+		EmptyReturnedAt string `json:"emptyReturnedAt"`
+		ClockRunning    bool   `json:"clockRunning"`
+		FreeDays        int64  `json:"freeDays"`
+		AccruedDays     int64  `json:"accruedDays"`
+		ChargeableDays  int64  `json:"chargeableDays"`
+		Charges         int64  `json:"charges"`
+		Currency        string `json:"currency"`
+	}
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if container.Supplier == "" {
+		return shim.Error("Container " + args[0] + " has no Container Supplier")
+	}
+
+	metrics, _, err := readContainerMetrics(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get container metrics: " + err.Error())
+	}
+
+	// A tariff change does not reprice a trip already discharged. Containers discharged without a tariff
+	// in force are charged under the current one.
+	tariff := metrics.DischargeTariff
+	if tariff == nil {
+		if tariff, err = demurrageTariffFor(APIstub, container.Supplier); err != nil {
+			return shim.Error("Failed to get tariff: " + err.Error())
+		} else if tariff == nil {
+			return shim.Error("Container Supplier " + container.Supplier + " has no demurrage tariff")
+		}
+	}
+
+	demurrage := Demurrage{ContainerId: args[0], Supplier: container.Supplier, DischargedAt: metrics.DischargedAt, EmptyReturnedAt: metrics.EmptyReturnedAt, FreeDays: tariff.FreeDays, Currency: tariff.Currency}
+
+	if metrics.DischargedAt != "" {
+		dischargedAt, err := time.Parse(time.RFC3339, metrics.DischargedAt)
+		if err != nil {
+			return shim.Error("Invalid discharge time: " + err.Error())
+		}
+
+		stoppedAt, err := time.Parse(time.RFC3339, metrics.EmptyReturnedAt)
+		if err != nil {
+			demurrage.ClockRunning = true
+			if stoppedAt, err = txTime(APIstub); err != nil {
+				return shim.Error("Failed to get transaction timestamp: " + err.Error())
+			}
+		}
+
+		// Any part of a day counts as a day.
+		demurrage.AccruedDays = int64(math.Ceil(stoppedAt.Sub(dischargedAt).Hours() / 24))
+		if demurrage.AccruedDays > tariff.FreeDays {
+			demurrage.ChargeableDays = demurrage.AccruedDays - tariff.FreeDays
+		}
+		demurrage.Charges = tariff.charge(demurrage.ChargeableDays)
+	}
+
+	demurrageAsBytes, _ := json.Marshal(demurrage)
+	return shim.Success(demurrageAsBytes)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestDemurrageTariffCharge(t *testing.T) {
+	tariff := DemurrageTariff{FreeDays: 5, Tiers: []DemurrageTier{{FromDay: 1, DailyRate: 50}, {FromDay: 8, DailyRate: 100}}}
+
+	tests := []struct {
+		chargeableDays int64
+		charges        int64
+	}{
+		{0, 0},
+		{1, 50},
+		{7, 350},
+		{8, 450},
+		{11, 750},
+	}
+	for _, test := range tests {
+		if charges := tariff.charge(test.chargeableDays); charges != test.charges {
+			t.Errorf("charge(%d) = %d, want %d", test.chargeableDays, charges, test.charges)
+		}
+	}
+}
+
+func TestDemurrageTariffValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tariff  DemurrageTariff
+		wantErr bool
+	}{
+		{"tiers out of order", DemurrageTariff{FreeDays: 5, Tiers: []DemurrageTier{{FromDay: 8, DailyRate: 100}, {FromDay: 1, DailyRate: 50}}}, false},
+		{"negative free days", DemurrageTariff{FreeDays: -1, Tiers: []DemurrageTier{{FromDay: 1, DailyRate: 50}}}, true},
+		{"no tiers", DemurrageTariff{FreeDays: 5}, true},
+		{"first tier after day 1", DemurrageTariff{Tiers: []DemurrageTier{{FromDay: 3, DailyRate: 50}}}, true},
+		{"repeated fromDay", DemurrageTariff{Tiers: []DemurrageTier{{FromDay: 1, DailyRate: 50}, {FromDay: 1, DailyRate: 100}}}, true},
+		{"negative rate", DemurrageTariff{Tiers: []DemurrageTier{{FromDay: 1, DailyRate: -50}}}, true},
+	}
+	for _, test := range tests {
+		if err := test.tariff.validate(); (err != nil) != test.wantErr {
+			t.Errorf("%s: validate() = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestGetDemurrage(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "SUPPLIER", "Container Supplier")
+	stub.registerTestParticipant(testMspId, "OTHER", "Container Supplier")
+	stub.registerTestParticipant(testMspId, "IMPORTER", "Importer")
+
+	tariff := `{"currency":"USD","freeDays":5,"tiers":[{"fromDay":1,"dailyRate":50},{"fromDay":8,"dailyRate":100}]}`
+	stub.asAdmin(otherTestMspId).mustFail("Caller is not a member of organisation Org1MSP", "setDemurrageTariff", "SUPPLIER", tariff)
+	stub.asAdmin(testMspId).mustFail("is not a Container Supplier", "setDemurrageTariff", "IMPORTER", tariff)
+	stub.asAdmin(testMspId).mustInvoke("setDemurrageTariff", "SUPPLIER", tariff)
+
+	seedMetrics := func(metrics ContainerMetrics) {
+		t.Helper()
+		err := stub.run(func() error {
+			_, metricsKey, err := readContainerMetrics(stub, metrics.ContainerId)
+			if err != nil {
+				return err
+			}
+			return putObject(stub, metricsKey, metrics)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	stub.seedTestRecord("Container", "C1", "IMPORTER", Container{HashId: "C1", Owner: "IMPORTER", Supplier: "SUPPLIER", Status: "Available"})
+	seedMetrics(ContainerMetrics{ContainerId: "C1", DischargedAt: "2020-02-10T08:00:00Z", EmptyReturnedAt: "2020-02-25T10:00:00Z"})
+	stub.seedTestRecord("Container", "C2", "IMPORTER", Container{HashId: "C2", Owner: "IMPORTER", Supplier: "SUPPLIER", Status: "Unloaded"})
+	seedMetrics(ContainerMetrics{ContainerId: "C2", DischargedAt: "2020-02-28T08:00:00Z"})
+	stub.seedTestRecord("Container", "C3", "IMPORTER", Container{HashId: "C3", Owner: "IMPORTER", Supplier: "OTHER", Status: "Unloaded"})
+
+	tests := []struct {
+		containerId    string
+		clockRunning   bool
+		accruedDays    int64
+		chargeableDays int64
+		charges        int64
+	}{
+		// Part of a sixteenth day counts as a day.
+		{"C1", false, 16, 11, 750},
+		// The clock runs until the query, a little over two days after discharge.
+		{"C2", true, 3, 0, 0},
+	}
+	stub.asParticipant(testMspId, "IMPORTER")
+	for _, test := range tests {
+		var demurrage struct {
+			ClockRunning   bool  `json:"clockRunning"`
+			AccruedDays    int64 `json:"accruedDays"`
+			ChargeableDays int64 `json:"chargeableDays"`
+			Charges        int64 `json:"charges"`
+		}
+		if err := json.Unmarshal(stub.mustInvoke("getDemurrage", test.containerId), &demurrage); err != nil {
+			t.Fatal(err)
+		}
+		if demurrage.ClockRunning != test.clockRunning || demurrage.AccruedDays != test.accruedDays || demurrage.ChargeableDays != test.chargeableDays || demurrage.Charges != test.charges {
+			t.Errorf("getDemurrage(%s) = %+v, want running %v, %d accrued, %d chargeable, %d charged", test.containerId, demurrage, test.clockRunning, test.accruedDays, test.chargeableDays, test.charges)
+		}
+	}
+
+	stub.mustFail("Container Supplier OTHER has no demurrage tariff", "getDemurrage", "C3")
+}
+
+func TestDemurrageKeepsDischargeTariff(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "SUPPLIER", "Container Supplier")
+	stub.registerTestParticipant(testMspId, "IMPORTER", "Importer")
+	stub.seedTestRecord("Container", "C1", "IMPORTER", Container{HashId: "C1", Owner: "IMPORTER", Supplier: "SUPPLIER", Status: "Unloaded"})
+
+	stub.asAdmin(testMspId).mustInvoke("setDemurrageTariff", "SUPPLIER", `{"currency":"USD","freeDays":0,"tiers":[{"fromDay":1,"dailyRate":50}]}`)
+	milestone := func(milestone string) {
+		t.Helper()
+		if err := stub.run(func() error { return recordContainerMilestone(stub, "C1", milestone) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	milestone("Discharged")
+	// Raising the rate after discharge does not reprice the trip.
+	stub.mustInvoke("setDemurrageTariff", "SUPPLIER", `{"currency":"USD","freeDays":0,"tiers":[{"fromDay":1,"dailyRate":500}]}`)
+	stub.now = stub.now.Add(71 * time.Hour)
+	milestone("Returned")
+
+	var demurrage struct {
+		AccruedDays int64 `json:"accruedDays"`
+		Charges     int64 `json:"charges"`
+	}
+	if err := json.Unmarshal(stub.asParticipant(testMspId, "IMPORTER").mustInvoke("getDemurrage", "C1"), &demurrage); err != nil {
+		t.Fatal(err)
+	}
+	if demurrage.AccruedDays != 3 || demurrage.Charges != 150 {
+		t.Errorf("getDemurrage(C1) = %+v, want 3 days charged 150 at the rate in force at discharge", demurrage)
+	}
+}
@@ -0,0 +1,297 @@
+/*
+ * Empty return and repositioning:
+ * Once an unloaded Container has been stripped, the consignee releases it empty to a Transporter,
+ * the Transporter returns it to a depot for the Container Supplier, and the supplier's
+ * acknowledgement makes it Available again for the next trip.
+ * Each trip's turnaround (loading to return) and utilization (time loaded over the whole cycle)
+ * are kept per Container.
+ * Empty Return States --> Unloaded, Empty Released, Returned, Available.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const containerMetricsObjectType = "ContainerMetrics"
+
+// ContainerMetrics tracks the current trip of a Container and totals over its completed trips. Durations are in hours.
+// DischargeTariff is the demurrage tariff in force at discharge; the trip is charged under it.
+type ContainerMetrics struct {
+	ContainerId          string           `json:"containerId"`
+	Trips                int              `json:"trips"`
+	AvailableSince       string           `json:"availableSince"`
+	LoadedAt             string           `json:"loadedAt"`
+	EmptyAt              string           `json:"emptyAt"`
+	DischargedAt         string           `json:"dischargedAt"`
+	EmptyReturnedAt      string           `json:"emptyReturnedAt"`
+	LastTurnaroundHours  float64          `json:"lastTurnaroundHours"`
+	TotalTurnaroundHours float64          `json:"totalTurnaroundHours"`
+	TotalLoadedHours     float64          `json:"totalLoadedHours"`
+	TotalCycleHours      float64          `json:"totalCycleHours"`
+	Utilization          float64          `json:"utilization"`
+	DischargeTariff      *DemurrageTariff `json:"dischargeTariff,omitempty"`
+	SchemaVersion        int              `json:"schemaVersion"`
+}
+
+func readContainerMetrics(APIstub shim.ChaincodeStubInterface, containerHashId string) (ContainerMetrics, string, error) {
+	metrics := ContainerMetrics{ContainerId: containerHashId}
+
+	metricsKey, err := APIstub.CreateCompositeKey(containerMetricsObjectType, []string{containerHashId})
+	if err != nil {
+		return metrics, "", err
+	}
+	metricsAsBytes, err := APIstub.GetState(metricsKey)
+	if err != nil || metricsAsBytes == nil {
+		return metrics, metricsKey, err
+	}
+
+	err = unmarshalRecord(containerMetricsObjectType, metricsAsBytes, &metrics)
+	return metrics, metricsKey, err
+}
+
+// recordContainerMilestone stamps the transaction time on the current trip of a Container.
+// milestone is Available, Loaded, Discharged, Empty or Returned; reaching Available again completes the trip.
+// The demurrage clock (Discharged to Returned) is kept until the next discharge so the last trip can still be charged.
+func recordContainerMilestone(APIstub shim.ChaincodeStubInterface, containerHashId string, milestone string) error {
+	metrics, metricsKey, err := readContainerMetrics(APIstub, containerHashId)
+	if err != nil {
+		return err
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	stamp := now.UTC().Format(time.RFC3339)
+
+	switch milestone {
+	case "Loaded":
+		metrics.LoadedAt = stamp
+	case "Discharged":
+		container, err := readContainer(APIstub, containerHashId)
+		if err != nil {
+			return err
+		}
+		metrics.DischargeTariff = nil
+		if container.Supplier != "" {
+			if metrics.DischargeTariff, err = demurrageTariffFor(APIstub, container.Supplier); err != nil {
+				return err
+			}
+		}
+		metrics.DischargedAt = stamp
+		metrics.EmptyReturnedAt = ""
+	case "Empty":
+		metrics.EmptyAt = stamp
+	case "Returned":
+		metrics.EmptyReturnedAt = stamp
+	case "Available":
+		if metrics.AvailableSince != "" && metrics.LoadedAt != "" {
+			metrics.completeTrip(now)
+		}
+		metrics.AvailableSince = stamp
+		metrics.LoadedAt = ""
+		metrics.EmptyAt = ""
+	}
+
+	return putObject(APIstub, metricsKey, metrics)
+}
+
+// completeTrip adds the trip that ends at returnedAt to the totals.
+func (metrics *ContainerMetrics) completeTrip(returnedAt time.Time) {
+	availableSince, _ := time.Parse(time.RFC3339, metrics.AvailableSince)
+	loadedAt, _ := time.Parse(time.RFC3339, metrics.LoadedAt)
+	emptyAt, err := time.Parse(time.RFC3339, metrics.EmptyAt)
+	if err != nil {
+		emptyAt = returnedAt
+	}
+
+	metrics.Trips++
+	metrics.LastTurnaroundHours = hours(returnedAt.Sub(loadedAt))
+	metrics.TotalTurnaroundHours += metrics.LastTurnaroundHours
+	metrics.TotalLoadedHours += hours(emptyAt.Sub(loadedAt))
+	metrics.TotalCycleHours += hours(returnedAt.Sub(availableSince))
+	if metrics.TotalCycleHours > 0 {
+		metrics.Utilization = math.Round(metrics.TotalLoadedHours/metrics.TotalCycleHours*10000) / 100
+	}
+}
+
+// hours converts a duration to hours, rounded to two decimals.
+func hours(duration time.Duration) float64 {
+	return math.Round(duration.Hours()*100) / 100
+}
+
+// releaseEmptyContainer - args: containerHashId, consignee, transporter. The consignee hands the stripped Container to a Transporter for return.
+// The caller must act for the consignee.
+func (s *SmartContract) releaseEmptyContainer(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if container.Status != "Unloaded" {
+		return shim.Error("Only Unloaded Containers can be released empty. Container status is " + container.Status)
+	} else if container.Owner != args[1] {
+		return shim.Error("Only the Container's current owner can release it")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	transporter, err := readParticipant(APIstub, args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if transporter.Role != "Transporter" {
+		return shim.Error("Participant " + args[2] + " is not a Transporter")
+	}
+	if err := assertNotSuspended(APIstub, args[1], args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	container.OwnerOrganisation, err = updateHolding(APIstub, "Container", args[0], container.OwnerOrganisation, args[2])
+	if err != nil {
+		return shim.Error("Failed to update organisation index: " + err.Error())
+	}
+	container.Owner = args[2]
+	container.PendingOwner = ""
+	container.LoadedItems = ""
+	container.Status = "Empty Released"
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, args[0], transporter.MspId); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+	if err := recordContainerMilestone(APIstub, args[0], "Empty"); err != nil {
+		return shim.Error("Failed to update container metrics: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// returnContainerToDepot - args: containerHashId, transporter, depot, supplier. The supplier has to acknowledge the return.
+// The caller must act for the transporter.
+func (s *SmartContract) returnContainerToDepot(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if container.Status != "Empty Released" {
+		return shim.Error("Only Containers released empty can be returned. Container status is " + container.Status)
+	} else if container.Owner != args[1] {
+		return shim.Error("Only the Transporter holding the Container can return it")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	supplier, err := readParticipant(APIstub, args[3])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if supplier.Role != "Container Supplier" {
+		return shim.Error("Participant " + args[3] + " is not a Container Supplier")
+	} else if container.Supplier != "" && container.Supplier != args[3] {
+		return shim.Error("Container belongs to Container Supplier " + container.Supplier)
+	}
+	if err := assertNotSuspended(APIstub, args[1], args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	container.Status = "Returned"
+	container.ContainerLocation = args[2]
+	container.PendingOwner = args[3]
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, args[0], ownerMspId(APIstub, args[1]), supplier.MspId); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+	if err := recordContainerMilestone(APIstub, args[0], "Returned"); err != nil {
+		return shim.Error("Failed to update container metrics: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// acknowledgeContainerReturn - args: containerHashId, supplier. Takes the Container back and makes it Available for its next trip,
+// clearing everything left over from the last one. The caller must act for the supplier.
+func (s *SmartContract) acknowledgeContainerReturn(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if container.Status != "Returned" || container.PendingOwner != args[1] {
+		return shim.Error("No return to " + args[1] + " is pending for this Container")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	container.OwnerOrganisation, err = updateHolding(APIstub, "Container", args[0], container.OwnerOrganisation, args[1])
+	if err != nil {
+		return shim.Error("Failed to update organisation index: " + err.Error())
+	}
+	container.Owner = args[1]
+	container.Supplier = args[1]
+	container.PendingOwner = ""
+	container.Status = "Available"
+	container.LoadedItems = ""
+	container.CargoId = ""
+	container.ShippedFrom = ""
+	container.ShippedTo = ""
+	container.Vgm = Vgm{}
+	container.Seal = Seal{}
+	container.OpeningAuthorizedBy = ""
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, args[0], ownerMspId(APIstub, args[1])); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+	if err := recordContainerMilestone(APIstub, args[0], "Available"); err != nil {
+		return shim.Error("Failed to update container metrics: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getContainerMetrics - args: containerHashId
+func (s *SmartContract) getContainerMetrics(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	if _, err := readContainer(APIstub, args[0]); err != nil {
+		return shim.Error(err.Error())
+	}
+	metrics, _, err := readContainerMetrics(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get container metrics: " + err.Error())
+	}
+
+	metricsAsBytes, _ := json.Marshal(metrics)
+	return shim.Success(metricsAsBytes)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompleteTrip(t *testing.T) {
+	returnedAt := time.Date(2020, 3, 11, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		metrics     ContainerMetrics
+		turnaround  float64
+		loaded      float64
+		cycle       float64
+		utilization float64
+	}{
+		{"stripped before return", ContainerMetrics{AvailableSince: "2020-03-01T00:00:00Z", LoadedAt: "2020-03-03T00:00:00Z", EmptyAt: "2020-03-09T00:00:00Z"}, 192, 144, 240, 60},
+		{"never stripped", ContainerMetrics{AvailableSince: "2020-03-01T00:00:00Z", LoadedAt: "2020-03-06T00:00:00Z"}, 120, 120, 240, 50},
+		{"adds to earlier trips", ContainerMetrics{Trips: 1, TotalLoadedHours: 60, TotalCycleHours: 240, AvailableSince: "2020-03-01T00:00:00Z", LoadedAt: "2020-03-06T00:00:00Z", EmptyAt: "2020-03-08T12:00:00Z"}, 120, 120, 480, 25},
+	}
+	for _, test := range tests {
+		metrics := test.metrics
+		trips := metrics.Trips
+		metrics.completeTrip(returnedAt)
+		if metrics.Trips != trips+1 || metrics.LastTurnaroundHours != test.turnaround || metrics.TotalLoadedHours != test.loaded || metrics.TotalCycleHours != test.cycle || metrics.Utilization != test.utilization {
+			t.Errorf("%s: completeTrip() = %+v; want turnaround %g, loaded %g, cycle %g, utilization %g", test.name, metrics, test.turnaround, test.loaded, test.cycle, test.utilization)
+		}
+	}
+}
+
+func TestAcknowledgeContainerReturnClearsTrip(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "SUPPLIER", "Container Supplier")
+	stub.registerTestParticipant(testMspId, "TRANSPORTER", "Transporter")
+	stub.seedTestRecord("Container", "C1", "TRANSPORTER", Container{HashId: "C1", Owner: "TRANSPORTER", PendingOwner: "SUPPLIER", Supplier: "SUPPLIER", Status: "Returned", CargoId: "CG1",
+		Vgm: Vgm{Method: "1", Weight: "24000"}, Seal: Seal{SealNumber: "S1", Status: sealIntactStatus}, OpeningAuthorizedBy: "TRANSPORTER"})
+
+	stub.asParticipant(testMspId, "TRANSPORTER").mustFail("not participant SUPPLIER", "acknowledgeContainerReturn", "C1", "SUPPLIER")
+	stub.asParticipant(testMspId, "SUPPLIER").mustInvoke("acknowledgeContainerReturn", "C1", "SUPPLIER")
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.Status != "Available" || container.Owner != "SUPPLIER" || container.CargoId != "" {
+		t.Errorf("container = %s owned by %s in %q, want Available owned by SUPPLIER in no cargo", container.Status, container.Owner, container.CargoId)
+	}
+	if container.Vgm != (Vgm{}) || container.Seal != (Seal{}) || container.OpeningAuthorizedBy != "" {
+		t.Errorf("container kept VGM %+v, seal %+v, opening authorized by %q from its last trip", container.Vgm, container.Seal, container.OpeningAuthorizedBy)
+	}
+}
+
+func TestEmptyReturnCallers(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CONSIGNEE", "Importer")
+	stub.registerTestParticipant(testMspId, "TRANSPORTER", "Transporter")
+	stub.registerTestParticipant(testMspId, "SUPPLIER", "Container Supplier")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+	stub.seedTestRecord("Container", "C1", "CONSIGNEE", Container{HashId: "C1", Owner: "CONSIGNEE", Supplier: "SUPPLIER", Status: "Unloaded"})
+
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant CONSIGNEE", "releaseEmptyContainer", "C1", "CONSIGNEE", "OUTSIDER")
+	stub.asParticipant(testMspId, "CONSIGNEE").mustInvoke("releaseEmptyContainer", "C1", "CONSIGNEE", "TRANSPORTER")
+
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant TRANSPORTER", "returnContainerToDepot", "C1", "TRANSPORTER", "Anywhere", "SUPPLIER")
+	stub.asParticipant(testMspId, "TRANSPORTER").mustInvoke("returnContainerToDepot", "C1", "TRANSPORTER", "Nhava Sheva Depot", "SUPPLIER")
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.Status != "Returned" || container.ContainerLocation != "Nhava Sheva Depot" || container.PendingOwner != "SUPPLIER" {
+		t.Errorf("container = %s at %s pending %s, want Returned at Nhava Sheva Depot pending SUPPLIER", container.Status, container.ContainerLocation, container.PendingOwner)
+	}
+}
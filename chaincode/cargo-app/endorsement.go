@@ -0,0 +1,333 @@
+/*
+ * State-based (key-level) endorsement:
+ * Every Participant, Container, Cargo and Bill of Lading key carries an endorsement policy naming the
+ * organisation(s) that must endorse changes to it, so each business role's organisation
+ * controls its own records regardless of the chaincode-level policy.
+ * Container / Cargo keys --> owner's organisation; during a custody handover, old and new owner organisations.
+ * Bill of Lading keys --> current holder's organisation.
+ * Customs Clearance keys --> organisation(s) registered for the Customs Officer role.
+ */
+
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	roleOrganisationsKey       = "RoleOrganisations"
+	customsClearanceObjectType = "CustomsClearance"
+	customsOfficerRole         = "Customs Officer"
+	customsClearedStatus       = "Cleared"
+)
+
+// CustomsClearance is the customs-owned record of a Container's clearance, endorsed by the customs organisation(s).
+type CustomsClearance struct {
+	ContainerId   string `json:"containerId"`
+	Status        string `json:"status"`
+	Officer       string `json:"officer"`
+	Timestamp     string `json:"timestamp"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// setKeyEndorsementOrgs requires every one of mspIds to endorse future changes to key. Empty ids are ignored and,
+// if none remain, the key is left to the chaincode-level endorsement policy.
+func setKeyEndorsementOrgs(APIstub shim.ChaincodeStubInterface, key string, mspIds ...string) error {
+	var orgs []string
+	seen := map[string]bool{}
+	for _, mspId := range mspIds {
+		if mspId != "" && !seen[mspId] {
+			seen[mspId] = true
+			orgs = append(orgs, mspId)
+		}
+	}
+	if len(orgs) == 0 {
+		return nil
+	}
+
+	endorsementPolicy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+	if err := endorsementPolicy.AddOrgs(statebased.RoleTypeMember, orgs...); err != nil {
+		return err
+	}
+	policy, err := endorsementPolicy.Policy()
+	if err != nil {
+		return err
+	}
+	return APIstub.SetStateValidationParameter(key, policy)
+}
+
+func readRoleOrganisations(APIstub shim.ChaincodeStubInterface) (map[string][]string, error) {
+	roleOrganisations := map[string][]string{}
+
+	roleOrganisationsAsBytes, err := APIstub.GetState(roleOrganisationsKey)
+	if err != nil {
+		return nil, err
+	} else if roleOrganisationsAsBytes != nil {
+		err = json.Unmarshal(roleOrganisationsAsBytes, &roleOrganisations)
+	}
+	return roleOrganisations, err
+}
+
+// setRoleOrganisation - args: role, mspId [, mspId...]. Assigns the organisations that play a business role.
+// Only an org admin can assign roles and, once any are assigned, only an admin of an organisation that plays one.
+// Under governance the assignments change through proposals instead.
+func (s *SmartContract) setRoleOrganisation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) < 2 {
+		return shim.Error("Incorrect number of arguments. Expecting at least 2")
+	}
+	if err := assertUngoverned(APIstub, "roleOrganisations"); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get caller organisation: " + err.Error())
+	}
+	if err := assertOrgAdmin(APIstub, mspId); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	roleOrganisations, err := readRoleOrganisations(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get role organisations: " + err.Error())
+	}
+	if len(roleOrganisations) > 0 && !playsRole(roleOrganisations, mspId) {
+		return shim.Error("Only an organisation that plays a business role can change role assignments")
+	}
+	roleOrganisations[args[0]] = args[1:]
+
+	if err := writeRoleOrganisations(APIstub, roleOrganisations); err != nil {
+		return shim.Error("Failed to record role organisations: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// playsRole reports whether mspId is assigned to any business role.
+func playsRole(roleOrganisations map[string][]string, mspId string) bool {
+	for _, mspIds := range roleOrganisations {
+		if contains(mspIds, mspId) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeRoleOrganisations stores the role assignments. Once assigned, every organisation with a role
+// must agree to any change of the assignments.
+func writeRoleOrganisations(APIstub shim.ChaincodeStubInterface, roleOrganisations map[string][]string) error {
+	if err := putObject(APIstub, roleOrganisationsKey, roleOrganisations); err != nil {
+		return err
+	}
+
+	return setKeyEndorsementOrgs(APIstub, roleOrganisationsKey, roleMspIds(roleOrganisations)...)
+}
+
+// roleMspIds returns every organisation assigned to a business role.
+func roleMspIds(roleOrganisations map[string][]string) []string {
+	var allOrgs []string
+	for _, mspIds := range roleOrganisations {
+		allOrgs = append(allOrgs, mspIds...)
+	}
+	return allOrgs
+}
+
+func (s *SmartContract) getRoleOrganisations(APIstub shim.ChaincodeStubInterface) sc.Response {
+
+	roleOrganisations, err := readRoleOrganisations(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get role organisations: " + err.Error())
+	}
+
+	roleOrganisationsAsBytes, _ := json.Marshal(roleOrganisations)
+	return shim.Success(roleOrganisationsAsBytes)
+}
+
+// createCustomsClearance records the initial clearance status of a new Container under the customs organisations' policy.
+func createCustomsClearance(APIstub shim.ChaincodeStubInterface, containerHashId string, status string, timestamp string) error {
+
+	clearanceKey, err := APIstub.CreateCompositeKey(customsClearanceObjectType, []string{containerHashId})
+	if err != nil {
+		return err
+	}
+
+	roleOrganisations, err := readRoleOrganisations(APIstub)
+	if err != nil {
+		return err
+	}
+
+	if err := putObject(APIstub, clearanceKey, CustomsClearance{ContainerId: containerHashId, Status: status, Timestamp: timestamp}); err != nil {
+		return err
+	}
+	return setKeyEndorsementOrgs(APIstub, clearanceKey, roleOrganisations[customsOfficerRole]...)
+}
+
+// releaseContainerFromCustoms - args: containerHashId, customsOfficer, clearanceStatus, timestamp. The caller must be the Customs Officer.
+func (s *SmartContract) releaseContainerFromCustoms(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	officer, err := readParticipant(APIstub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if officer.Role != customsOfficerRole {
+		return shim.Error("Customs clearance can only be given by a Customs Officer")
+	} else if officer.isSuspended() {
+		return shim.Error("Customs Officer " + args[1] + " is suspended")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	roleOrganisations, err := readRoleOrganisations(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get role organisations: " + err.Error())
+	}
+	if customsOrgs := roleOrganisations[customsOfficerRole]; len(customsOrgs) > 0 && !contains(customsOrgs, officer.MspId) {
+		return shim.Error("Customs Officer does not belong to a customs organisation")
+	}
+
+	clearanceKey, err := APIstub.CreateCompositeKey(customsClearanceObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	clearance := CustomsClearance{ContainerId: args[0], Status: args[2], Officer: args[1], Timestamp: args[3]}
+	if err := putObject(APIstub, clearanceKey, clearance); err != nil {
+		return shim.Error("Failed to record customs clearance: " + err.Error())
+	}
+	// Containers registered before a customs organisation was assigned get their policy on first release.
+	if err := setKeyEndorsementOrgs(APIstub, clearanceKey, roleOrganisations[customsOfficerRole]...); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	container.CustomClearanceStatus = args[2]
+	container.Timestamp = args[3]
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// acceptCargoCustody - args: cargoHashId, newOwner, and optionally the seals seen at handover (JSON object of container HashId to seal number). Completes a cross-organisation handover started by changeCargoCustody.
+// The caller must be the new owner or, for an Organisation, act for it.
+func (s *SmartContract) acceptCargoCustody(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.PendingOwner == "" || cargo.PendingOwner != args[1] {
+		return shim.Error("No custody handover to " + args[1] + " is pending for this Cargo")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := verifyCargoSeals(APIstub, cargo, optionalArg(args, 2), args[1]); err != nil {
+		return shim.Error("Failed to verify seals: " + err.Error())
+	}
+
+	cargo.OwnerOrganisation, err = updateHolding(APIstub, "Cargo", args[0], cargo.OwnerOrganisation, cargo.PendingOwner)
+	if err != nil {
+		return shim.Error("Failed to update organisation index: " + err.Error())
+	}
+	cargo.Owner = cargo.PendingOwner
+	cargo.PendingOwner = ""
+
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, args[0], ownerMspId(APIstub, cargo.Owner)); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// acceptContainerCustody - args: containerHashId, newOwner, and optionally the seal number seen at handover. Completes a cross-organisation handover started by changeContainerCustody.
+// The caller must be the new owner or, for an Organisation, act for it.
+func (s *SmartContract) acceptContainerCustody(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if container.PendingOwner == "" || container.PendingOwner != args[1] {
+		return shim.Error("No custody handover to " + args[1] + " is pending for this Container")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := verifySeal(APIstub, &container, optionalArg(args, 2), args[1]); err != nil {
+		return shim.Error("Failed to verify seal: " + err.Error())
+	}
+
+	container.OwnerOrganisation, err = updateHolding(APIstub, "Container", args[0], container.OwnerOrganisation, container.PendingOwner)
+	if err != nil {
+		return shim.Error("Failed to update organisation index: " + err.Error())
+	}
+	container.Owner = container.PendingOwner
+	container.PendingOwner = ""
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, args[0], ownerMspId(APIstub, container.Owner)); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// handoverRequiresBothOrgs reports whether a custody change from oldOwner to newOwner crosses organisations,
+// in which case it has to be accepted by the new owner under a policy requiring both organisations.
+func handoverRequiresBothOrgs(APIstub shim.ChaincodeStubInterface, oldOwner string, newOwner string) (bool, string, string) {
+	oldOrg := ownerMspId(APIstub, oldOwner)
+	newOrg := ownerMspId(APIstub, newOwner)
+	return oldOrg != "" && newOrg != "" && oldOrg != newOrg, oldOrg, newOrg
+}
+
+// callerOrg returns the MSP ID of the identity submitting the transaction.
+func callerOrg(APIstub shim.ChaincodeStubInterface) (string, error) {
+	return cid.GetMSPID(APIstub)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
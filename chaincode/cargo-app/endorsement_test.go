@@ -0,0 +1,101 @@
+package main
+
+import "testing"
+
+func TestSetRoleOrganisationAuthorisation(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "MEMBER", "Transporter")
+
+	stub.asParticipant(testMspId, "MEMBER").mustFail("not an org admin", "setRoleOrganisation", "Transporter", testMspId)
+	stub.asAdmin(testMspId).mustInvoke("setRoleOrganisation", "Transporter", testMspId)
+
+	// Once roles are assigned, an organisation without one cannot take them over.
+	stub.asAdmin(otherTestMspId).mustFail("plays a business role", "setRoleOrganisation", "Transporter", otherTestMspId)
+	stub.asAdmin(testMspId).mustInvoke("setRoleOrganisation", "Importer", otherTestMspId)
+	stub.asAdmin(otherTestMspId).mustInvoke("setRoleOrganisation", "Importer", otherTestMspId, testMspId)
+}
+
+func TestRegisterParticipantTakesCallerMsp(t *testing.T) {
+	stub := newTestStub(t)
+	stub.asAdmin(otherTestMspId).mustInvoke("registerOrganisation", "ORG-2", "Org Two", otherTestMspId, "DE", "Importer", "")
+
+	stub.asAdmin(testMspId).mustFail("Expecting 4 or 5", "registerParticipant", "P1", "P1", "p1@example.com", "Importer", otherTestMspId, "ORG-2")
+	stub.asAdmin(testMspId).mustFail("does not belong to "+testMspId, "registerParticipant", "P1", "P1", "p1@example.com", "Importer", "ORG-2")
+	stub.asAdmin(otherTestMspId).mustInvoke("registerParticipant", "P1", "P1", "p1@example.com", "Importer", "ORG-2")
+
+	var participant Participant
+	stub.readTestRecord("P1", &participant)
+	if participant.MspId != otherTestMspId || participant.OrganisationId != "ORG-2" {
+		t.Errorf("participant registered as %s/%s", participant.MspId, participant.OrganisationId)
+	}
+}
+
+func TestReleaseContainerFromCustomsRequiresOfficer(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "OFFICER", customsOfficerRole)
+	stub.registerTestParticipant(testMspId, "TRANSPORTER", "Transporter")
+	stub.seedTestRecord("Container", "C1", "TRANSPORTER", Container{HashId: "C1", Owner: "TRANSPORTER", Status: "Unloaded", CustomClearanceStatus: "Pending"})
+
+	stub.asParticipant(testMspId, "TRANSPORTER").mustFail("not participant OFFICER", "releaseContainerFromCustoms", "C1", "OFFICER", customsClearedStatus, "2020-03-01T10:00:00Z")
+	stub.asParticipant(testMspId, "OFFICER").mustInvoke("releaseContainerFromCustoms", "C1", "OFFICER", customsClearedStatus, "2020-03-01T10:00:00Z")
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.CustomClearanceStatus != customsClearedStatus {
+		t.Errorf("clearance status = %s", container.CustomClearanceStatus)
+	}
+}
+
+func TestAcceptCustodyRequiresNewOwner(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "OLD", "Transporter")
+	stub.registerTestParticipant(otherTestMspId, "NEW", "Transporter")
+	stub.seedTestRecord("Container", "C1", "OLD", Container{HashId: "C1", Owner: "OLD", PendingOwner: "NEW", Status: "InCargo"})
+	stub.seedTestRecord("Cargo", "CG1", "OLD", Cargo{HashId: "CG1", Owner: "OLD", PendingOwner: "NEW", Status: "In-Transit", AssociatedContainerHashIds: []string{}})
+
+	tests := []struct {
+		function string
+		hashId   string
+	}{
+		{"acceptContainerCustody", "C1"},
+		{"acceptCargoCustody", "CG1"},
+	}
+	for _, test := range tests {
+		stub.asParticipant(testMspId, "OLD").mustFail("not participant NEW", test.function, test.hashId, "NEW")
+		stub.asParticipant(otherTestMspId, "NEW").mustInvoke(test.function, test.hashId, "NEW")
+	}
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.Owner != "NEW" || container.PendingOwner != "" {
+		t.Errorf("container owner = %s, pending %s", container.Owner, container.PendingOwner)
+	}
+}
+
+func TestChangeCustodyRequiresOwner(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "OLD", "Transporter")
+	stub.registerTestParticipant(otherTestMspId, "NEW", "Transporter")
+	stub.registerTestParticipant(otherTestMspId, "THIEF", "Transporter")
+	stub.seedTestRecord("Container", "C1", "OLD", Container{HashId: "C1", Owner: "OLD", Status: "InCargo"})
+	stub.seedTestRecord("Cargo", "CG1", "OLD", Cargo{HashId: "CG1", Owner: "OLD", Status: "In-Transit", AssociatedContainerHashIds: []string{}})
+
+	tests := []struct {
+		function string
+		hashId   string
+	}{
+		{"changeContainerCustody", "C1"},
+		{"changeCargoCustody", "CG1"},
+	}
+	for _, test := range tests {
+		// Anyone else could otherwise name a participant they control as the new owner and accept the handover.
+		stub.asParticipant(otherTestMspId, "THIEF").mustFail("not participant OLD", test.function, test.hashId, "THIEF")
+		stub.asParticipant(testMspId, "OLD").mustInvoke(test.function, test.hashId, "NEW")
+	}
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.Owner != "OLD" || container.PendingOwner != "NEW" {
+		t.Errorf("container owner = %s, pending %s; want OLD pending NEW", container.Owner, container.PendingOwner)
+	}
+}
@@ -0,0 +1,424 @@
+/*
+ * Escrowed freight payment:
+ * Balances are internal ledger units held in accounts per participant or organisation.
+ * The shipper locks the freight amount for a Cargo in escrow, agreed percentages are
+ * released to the carrier as the Cargo reaches each milestone, and the remainder is settled
+ * when the consignee confirms receipt, less any SLA penalties which are refunded to the shipper.
+ * Only the payer locks or refunds, only the payee releases milestones, and only the consignee confirms delivery.
+ * The payer is the shipper on the Cargo's booking, and the consignee is named when the freight is locked.
+ * Milestones --> Loaded, Departed, Arrived.
+ * Escrow States --> Locked, Settled, Refunded.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	accountObjectType = "Account"
+	escrowObjectType  = "Escrow"
+)
+
+type Account struct {
+	AccountId     string `json:"accountId"`
+	Balance       int64  `json:"balance"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// Escrow holds the freight for one Cargo. Schedule maps each milestone to the percentage of Amount released on reaching it.
+type Escrow struct {
+	CargoId       string           `json:"cargoId"`
+	Payer         string           `json:"payer"`
+	Payee         string           `json:"payee"`
+	Consignee     string           `json:"consignee"`
+	Amount        int64            `json:"amount"`
+	Schedule      map[string]int64 `json:"schedule"`
+	Held          int64            `json:"held"`
+	Released      int64            `json:"released"`
+	Refunded      int64            `json:"refunded"`
+	Status        string           `json:"status"`
+	Movements     []EscrowMovement `json:"movements"`
+	SchemaVersion int              `json:"schemaVersion"`
+}
+
+// EscrowMovement is one payment out of escrow.
+type EscrowMovement struct {
+	Reason string `json:"reason"`
+	To     string `json:"to"`
+	Amount int64  `json:"amount"`
+	TxnId  string `json:"txnId"`
+}
+
+// readAccount loads an account. Accounts that have never been credited read as empty and report exists == false.
+func readAccount(APIstub shim.ChaincodeStubInterface, accountId string) (Account, string, bool, error) {
+	account := Account{AccountId: accountId}
+
+	accountKey, err := APIstub.CreateCompositeKey(accountObjectType, []string{accountId})
+	if err != nil {
+		return account, "", false, err
+	}
+	accountAsBytes, err := APIstub.GetState(accountKey)
+	if err != nil || accountAsBytes == nil {
+		return account, accountKey, false, err
+	}
+
+	err = unmarshalRecord(accountObjectType, accountAsBytes, &account)
+	return account, accountKey, true, err
+}
+
+// creditAccount adds amount (negative to debit) to an account, opening it under its owner's organisation policy if needed.
+func creditAccount(APIstub shim.ChaincodeStubInterface, accountId string, amount int64) error {
+	account, accountKey, exists, err := readAccount(APIstub, accountId)
+	if err != nil {
+		return err
+	} else if account.Balance+amount < 0 {
+		return fmt.Errorf("Insufficient funds in account %s", accountId)
+	}
+	account.Balance += amount
+
+	if err := putObject(APIstub, accountKey, account); err != nil {
+		return err
+	}
+	if !exists {
+		return setKeyEndorsementOrgs(APIstub, accountKey, ownerMspId(APIstub, accountId))
+	}
+	return nil
+}
+
+func readEscrow(APIstub shim.ChaincodeStubInterface, cargoHashId string) (*Escrow, string, error) {
+	escrowKey, err := APIstub.CreateCompositeKey(escrowObjectType, []string{cargoHashId})
+	if err != nil {
+		return nil, "", err
+	}
+	escrowAsBytes, err := APIstub.GetState(escrowKey)
+	if err != nil || escrowAsBytes == nil {
+		return nil, escrowKey, err
+	}
+
+	escrow := Escrow{}
+	err = unmarshalRecord(escrowObjectType, escrowAsBytes, &escrow)
+	return &escrow, escrowKey, err
+}
+
+// pay moves amount out of escrow to an account and records the movement.
+func (escrow *Escrow) pay(APIstub shim.ChaincodeStubInterface, reason string, to string, amount int64) error {
+	if amount <= 0 {
+		return nil
+	}
+	if err := creditAccount(APIstub, to, amount); err != nil {
+		return err
+	}
+	escrow.Held -= amount
+	if to == escrow.Payer {
+		escrow.Refunded += amount
+	} else {
+		escrow.Released += amount
+	}
+	escrow.Movements = append(escrow.Movements, EscrowMovement{Reason: reason, To: to, Amount: amount, TxnId: APIstub.GetTxID()})
+	return nil
+}
+
+// depositFunds - args: accountId, amount. Issues ledger units to an account; only an admin of the owner's organisation may do this.
+func (s *SmartContract) depositFunds(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	amount, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || amount <= 0 {
+		return shim.Error("Amount must be a positive whole number of ledger units")
+	}
+
+	mspId := ownerMspId(APIstub, args[0])
+	if mspId == "" {
+		return shim.Error("Account owner is not a registered Participant or Organisation: " + args[0])
+	}
+	if err := assertOrgAdmin(APIstub, mspId); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := creditAccount(APIstub, args[0], amount); err != nil {
+		return shim.Error("Failed to deposit funds: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+func (s *SmartContract) getAccount(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	account, _, _, err := readAccount(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get account: " + err.Error())
+	}
+
+	accountAsBytes, _ := json.Marshal(account)
+	return shim.Success(accountAsBytes)
+}
+
+// lockFreightPayment - args: cargoHashId, payer, payee, amount, schedule (JSON, e.g. {"Loaded":10,"Departed":30,"Arrived":30}), consignee
+// Whatever the schedule does not release is paid on delivery confirmation by the consignee. The caller must act for the payer,
+// who must be the shipper on the Cargo's booking, or its owner if it was created without one.
+func (s *SmartContract) lockFreightPayment(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting 6")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	amount, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil || amount <= 0 {
+		return shim.Error("Amount must be a positive whole number of ledger units")
+	}
+
+	schedule := map[string]int64{}
+	if err := json.Unmarshal([]byte(args[4]), &schedule); err != nil {
+		return shim.Error("Failed to decode schedule: " + err.Error())
+	}
+	var scheduled int64
+	for milestone, percentage := range schedule {
+		if milestone != "Loaded" && milestone != "Departed" && milestone != "Arrived" {
+			return shim.Error("Invalid milestone " + milestone + ". Expecting Loaded, Departed or Arrived")
+		} else if percentage < 0 {
+			return shim.Error("Milestone percentages cannot be negative")
+		}
+		scheduled += percentage
+	}
+	if scheduled > 100 {
+		return shim.Error("Milestone percentages add up to more than 100")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	shipper := cargo.Owner
+	if cargo.BookingId != "" {
+		booking, _, err := readBooking(APIstub, cargo.BookingId)
+		if err != nil {
+			return shim.Error("Failed to get booking: " + err.Error())
+		} else if booking == nil {
+			return shim.Error("Booking does not exist. BookingId: " + cargo.BookingId)
+		}
+		shipper = booking.Shipper
+	}
+	if args[1] != shipper {
+		return shim.Error("Only the shipper " + shipper + " can pay the freight for Cargo " + args[0])
+	}
+
+	// The payee would otherwise be able to confirm its own delivery.
+	if _, err := readParticipant(APIstub, args[5]); err != nil {
+		return shim.Error(err.Error())
+	} else if args[5] == args[2] {
+		return shim.Error("The consignee cannot be the payee")
+	}
+
+	escrow, escrowKey, err := readEscrow(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get escrow: " + err.Error())
+	} else if escrow != nil {
+		return shim.Error("Freight payment is already in escrow for Cargo " + args[0])
+	}
+
+	if err := assertNotSuspended(APIstub, args[1], args[2], args[5]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := creditAccount(APIstub, args[1], -amount); err != nil {
+		return shim.Error("Failed to lock freight payment: " + err.Error())
+	}
+
+	escrow = &Escrow{CargoId: args[0], Payer: args[1], Payee: args[2], Consignee: args[5], Amount: amount, Schedule: schedule, Held: amount, Status: "Locked", Movements: []EscrowMovement{}}
+	if err := putObject(APIstub, escrowKey, escrow); err != nil {
+		return shim.Error("Failed to record escrow: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// releaseMilestonePayment - args: cargoHashId, milestone. Pays the carrier the milestone's share once the Cargo has reached it.
+// The caller must act for the payee.
+func (s *SmartContract) releaseMilestonePayment(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	escrow, escrowKey, err := readEscrow(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get escrow: " + err.Error())
+	} else if escrow == nil {
+		return shim.Error("No freight payment in escrow for Cargo " + args[0])
+	} else if escrow.Status != "Locked" {
+		return shim.Error("Escrow is already " + escrow.Status)
+	}
+	if err := assertCallerActsFor(APIstub, escrow.Payee); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	percentage, ok := escrow.Schedule[args[1]]
+	if !ok {
+		return shim.Error("Milestone " + args[1] + " is not in the payment schedule")
+	}
+	for _, movement := range escrow.Movements {
+		if movement.Reason == args[1] {
+			return shim.Error("Milestone " + args[1] + " has already been paid")
+		}
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !milestoneReached(cargo, args[1]) {
+		return shim.Error("Cargo has not reached milestone " + args[1])
+	}
+
+	if err := escrow.pay(APIstub, args[1], escrow.Payee, escrow.Amount*percentage/100); err != nil {
+		return shim.Error("Failed to release payment: " + err.Error())
+	}
+	if err := putObject(APIstub, escrowKey, escrow); err != nil {
+		return shim.Error("Failed to update escrow: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// confirmDelivery - args: cargoHashId, consignee. Settles the escrow: SLA penalties go back to the shipper, the rest to the carrier.
+// The caller must act for the consignee named when the freight was locked.
+func (s *SmartContract) confirmDelivery(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	escrow, escrowKey, err := readEscrow(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get escrow: " + err.Error())
+	} else if escrow == nil {
+		return shim.Error("No freight payment in escrow for Cargo " + args[0])
+	} else if escrow.Status != "Locked" {
+		return shim.Error("Escrow is already " + escrow.Status)
+	} else if escrow.Consignee != args[1] {
+		return shim.Error("Only the consignee named in the escrow can confirm delivery")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Arrived" {
+		return shim.Error("Delivery can only be confirmed once the Cargo has Arrived")
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var penalty int64
+	sla, _, err := readSla(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get SLA: " + err.Error())
+	} else if sla != nil {
+		penalty = sla.TotalPenalty
+	}
+	if penalty > escrow.Held {
+		penalty = escrow.Held
+	}
+
+	if err := escrow.pay(APIstub, "SLA Penalty", escrow.Payer, penalty); err != nil {
+		return shim.Error("Failed to refund penalty: " + err.Error())
+	}
+	if err := escrow.pay(APIstub, "Delivery", escrow.Payee, escrow.Held); err != nil {
+		return shim.Error("Failed to release payment: " + err.Error())
+	}
+	escrow.Status = "Settled"
+
+	if err := putObject(APIstub, escrowKey, escrow); err != nil {
+		return shim.Error("Failed to update escrow: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// refundFreightPayment - args: cargoHashId. Returns everything still held to the shipper while the Cargo is still Ready,
+// since it never departed. The caller must act for the payer.
+func (s *SmartContract) refundFreightPayment(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	escrow, escrowKey, err := readEscrow(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get escrow: " + err.Error())
+	} else if escrow == nil {
+		return shim.Error("No freight payment in escrow for Cargo " + args[0])
+	} else if escrow.Status != "Locked" {
+		return shim.Error("Escrow is already " + escrow.Status)
+	}
+	if err := assertCallerActsFor(APIstub, escrow.Payer); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Ready" {
+		return shim.Error("Freight can only be refunded while the Cargo is Ready. Cargo status is " + cargo.Status)
+	}
+
+	if err := escrow.pay(APIstub, "Refund", escrow.Payer, escrow.Held); err != nil {
+		return shim.Error("Failed to refund payment: " + err.Error())
+	}
+	escrow.Status = "Refunded"
+
+	if err := putObject(APIstub, escrowKey, escrow); err != nil {
+		return shim.Error("Failed to update escrow: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+func (s *SmartContract) getEscrow(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	escrow, _, err := readEscrow(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get escrow: " + err.Error())
+	} else if escrow == nil {
+		return shim.Error("No freight payment in escrow for Cargo " + args[0])
+	}
+
+	escrowAsBytes, _ := json.Marshal(escrow)
+	return shim.Success(escrowAsBytes)
+}
+
+// milestoneReached maps payment milestones onto Cargo states. A Cargo is loaded once it has containers stuffed into it.
+func milestoneReached(cargo Cargo, milestone string) bool {
+	switch milestone {
+	case "Loaded":
+		return len(cargo.AssociatedContainerHashIds) > 0 && cargo.AssociatedContainerHashIds[0] != ""
+	case "Departed":
+		return cargo.Status == "In-Transit" || cargo.Status == "Arrived"
+	case "Arrived":
+		return cargo.Status == "Arrived"
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMilestoneReached(t *testing.T) {
+	loaded := []string{"C1", "C2"}
+
+	tests := []struct {
+		status     string
+		containers []string
+		milestone  string
+		reached    bool
+	}{
+		{"Ready", nil, "Loaded", false},
+		{"Ready", []string{""}, "Loaded", false},
+		{"Ready", loaded, "Loaded", true},
+		{"Ready", loaded, "Departed", false},
+		{"In-Transit", loaded, "Departed", true},
+		{"In-Transit", loaded, "Arrived", false},
+		{"Arrived", loaded, "Departed", true},
+		{"Arrived", loaded, "Arrived", true},
+		{"Arrived", loaded, "Delivered", false},
+	}
+	for _, test := range tests {
+		cargo := Cargo{Status: test.status, AssociatedContainerHashIds: test.containers}
+		if reached := milestoneReached(cargo, test.milestone); reached != test.reached {
+			t.Errorf("milestoneReached(%s, %v, %s) = %v, want %v", test.status, test.containers, test.milestone, reached, test.reached)
+		}
+	}
+}
+
+func TestFreightPaymentCallers(t *testing.T) {
+	stub := newTestStub(t)
+	for hashId, role := range map[string]string{"SHIPPER": "Exporter", "CARRIER": "Transporter", "CONSIGNEE": "Importer", "OUTSIDER": "Exporter"} {
+		stub.registerTestParticipant(testMspId, hashId, role)
+	}
+	err := stub.run(func() error {
+		bookingKey, _ := stub.CreateCompositeKey(bookingObjectType, []string{"B1"})
+		return putObject(stub, bookingKey, Booking{BookingId: "B1", Shipper: "SHIPPER", Transporter: "CARRIER", Status: "Confirmed"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", Status: "Ready", BookingId: "B1", AssociatedContainerHashIds: []string{"C1"}})
+	stub.asAdmin(testMspId).mustInvoke("depositFunds", "SHIPPER", "1000")
+	stub.asAdmin(testMspId).mustInvoke("depositFunds", "OUTSIDER", "1000")
+
+	schedule := `{"Loaded":10,"Departed":30}`
+	stub.asParticipant(testMspId, "CARRIER").mustFail("not participant SHIPPER", "lockFreightPayment", "CG1", "SHIPPER", "CARRIER", "1000", schedule, "CONSIGNEE")
+	// Someone else locking an escrow first would block the real shipper.
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("Only the shipper SHIPPER", "lockFreightPayment", "CG1", "OUTSIDER", "CARRIER", "1000", schedule, "CONSIGNEE")
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("consignee cannot be the payee", "lockFreightPayment", "CG1", "SHIPPER", "CARRIER", "1000", schedule, "CARRIER")
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("lockFreightPayment", "CG1", "SHIPPER", "CARRIER", "1000", schedule, "CONSIGNEE")
+
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("not participant CARRIER", "releaseMilestonePayment", "CG1", "Loaded")
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("releaseMilestonePayment", "CG1", "Loaded")
+	stub.asParticipant(testMspId, "CARRIER").mustFail("has not reached milestone", "releaseMilestonePayment", "CG1", "Departed")
+	stub.asParticipant(testMspId, "CARRIER").mustFail("not participant SHIPPER", "refundFreightPayment", "CG1")
+
+	// At arrival the carrier still holds the Cargo, but holding it does not make it the consignee.
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", Status: "Arrived", BookingId: "B1", AssociatedContainerHashIds: []string{"C1"}})
+	stub.asParticipant(testMspId, "CARRIER").mustFail("Only the consignee named in the escrow", "confirmDelivery", "CG1", "CARRIER")
+	stub.asParticipant(testMspId, "CARRIER").mustFail("not participant CONSIGNEE", "confirmDelivery", "CG1", "CONSIGNEE")
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("only be refunded while the Cargo is Ready", "refundFreightPayment", "CG1")
+	stub.asParticipant(testMspId, "CONSIGNEE").mustInvoke("confirmDelivery", "CG1", "CONSIGNEE")
+
+	tests := []struct {
+		accountId string
+		balance   int64
+	}{
+		{"SHIPPER", 0},
+		{"CARRIER", 1000},
+	}
+	for _, test := range tests {
+		var account Account
+		if err := json.Unmarshal(stub.mustInvoke("getAccount", test.accountId), &account); err != nil {
+			t.Fatal(err)
+		}
+		if account.Balance != test.balance {
+			t.Errorf("balance of %s = %d, want %d", test.accountId, account.Balance, test.balance)
+		}
+	}
+}
+
+func TestRefundFreightPaymentAfterDelivery(t *testing.T) {
+	stub := newTestStub(t)
+	for hashId, role := range map[string]string{"SHIPPER": "Exporter", "CARRIER": "Transporter", "CONSIGNEE": "Importer"} {
+		stub.registerTestParticipant(testMspId, hashId, role)
+	}
+	err := stub.run(func() error {
+		bookingKey, _ := stub.CreateCompositeKey(bookingObjectType, []string{"B1"})
+		return putObject(stub, bookingKey, Booking{BookingId: "B1", Shipper: "SHIPPER", Transporter: "CARRIER", Status: "Confirmed"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", Status: "Ready", BookingId: "B1", AssociatedContainerHashIds: []string{"C1"}})
+	stub.asAdmin(testMspId).mustInvoke("depositFunds", "SHIPPER", "1000")
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("lockFreightPayment", "CG1", "SHIPPER", "CARRIER", "1000", `{"Arrived":100}`, "CONSIGNEE")
+
+	// However far past Ready the Cargo has gone, the carrier has done the work.
+	for _, status := range []string{"In-Transit", "Arrived", "Archived"} {
+		stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", Status: status, BookingId: "B1", AssociatedContainerHashIds: []string{"C1"}})
+		stub.asParticipant(testMspId, "SHIPPER").mustFail("Cargo status is "+status, "refundFreightPayment", "CG1")
+	}
+}
@@ -0,0 +1,471 @@
+/*
+ * Governance:
+ * Once the ledger configuration has a governance section, admin-level configuration is no longer
+ * changed by a single admin. An admin named in the configuration proposes a change, the other
+ * designated organisations approve or reject it, and the change is applied by the approval that
+ * reaches the quorum, as long as that comes before the voting deadline. Each organisation votes once,
+ * through any of its designated admins, and the proposer's organisation counts as the first approval.
+ * Each proposal keeps its votes, and getProposalHistory returns every version of it.
+ * Governed changes --> rules, defaultTariff, roleOrganisations, statusTransitions, admins, maxBatchSize, governance,
+ * supplierTariff (one Container Supplier's demurrage tariff, as {"supplierId":...,"tariff":{...}}).
+ * Proposal States --> Open, Applied, Rejected, Expired (an Open proposal past its deadline).
+ * Init still sets the whole configuration, since a chaincode upgrade already needs the channel's agreement.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	proposalObjectType       = "Proposal"
+	defaultVotingPeriodHours = 72
+	proposalOpenStatus       = "Open"
+	proposalAppliedStatus    = "Applied"
+	proposalRejectedStatus   = "Rejected"
+	proposalExpiredStatus    = "Expired"
+	supplierTariffChangeType = "supplierTariff"
+)
+
+// governedChanges are the configuration sections a proposal can change, by their field in LedgerConfig,
+// and the supplier tariffs kept outside it.
+var governedChanges = []string{"rules", "defaultTariff", "roleOrganisations", "statusTransitions", "admins", "maxBatchSize", "governance", supplierTariffChangeType}
+
+// GovernanceConfig puts configuration changes to a vote of the organisations named in LedgerConfig.Admins.
+// Quorum is the number of distinct organisations whose admins must approve a change.
+type GovernanceConfig struct {
+	Quorum            int `json:"quorum"`
+	VotingPeriodHours int `json:"votingPeriodHours"`
+}
+
+// ProposalVote is one organisation's approval or rejection of a proposal, cast by one of its admins.
+type ProposalVote struct {
+	MspId     string `json:"mspId"`
+	AdminId   string `json:"adminId"`
+	Reason    string `json:"reason"`
+	Timestamp string `json:"timestamp"`
+	TxId      string `json:"txId"`
+}
+
+// Proposal is a configuration change put to a vote. Quorum and Deadline are fixed when it is proposed.
+type Proposal struct {
+	ProposalId    string          `json:"proposalId"`
+	ChangeType    string          `json:"changeType"`
+	Change        json.RawMessage `json:"change"`
+	Description   string          `json:"description"`
+	ProposedBy    string          `json:"proposedBy"`
+	ProposerMspId string          `json:"proposerMspId"`
+	ProposedAt    string          `json:"proposedAt"`
+	Deadline      string          `json:"deadline"`
+	Quorum        int             `json:"quorum"`
+	Approvals     []ProposalVote  `json:"approvals"`
+	Rejections    []ProposalVote  `json:"rejections"`
+	Status        string          `json:"status"`
+	ResolvedAt    string          `json:"resolvedAt"`
+	ResolvedTxId  string          `json:"resolvedTxId"`
+	SchemaVersion int             `json:"schemaVersion"`
+}
+
+func readProposal(APIstub shim.ChaincodeStubInterface, proposalId string) (*Proposal, string, error) {
+	proposalKey, err := APIstub.CreateCompositeKey(proposalObjectType, []string{proposalId})
+	if err != nil {
+		return nil, "", err
+	}
+	proposalAsBytes, err := APIstub.GetState(proposalKey)
+	if err != nil || proposalAsBytes == nil {
+		return nil, proposalKey, err
+	}
+
+	proposal := Proposal{}
+	err = unmarshalRecord(proposalObjectType, proposalAsBytes, &proposal)
+	return &proposal, proposalKey, err
+}
+
+// validateGovernance checks that the quorum can be reached by the organisations the configuration names admins for.
+func (config LedgerConfig) validateGovernance() error {
+	if config.Governance == nil {
+		return nil
+	}
+	if config.Governance.Quorum < 1 {
+		return fmt.Errorf("Governance quorum must be at least 1")
+	} else if config.Governance.VotingPeriodHours < 0 {
+		return fmt.Errorf("Governance voting period cannot be negative")
+	}
+	if organisations := config.adminOrgCount(); config.Governance.Quorum > organisations {
+		return fmt.Errorf("Governance quorum of %d cannot be reached by the %d organisations with admins configured", config.Governance.Quorum, organisations)
+	}
+	return nil
+}
+
+// adminOrgCount returns the number of organisations with at least one admin in the configuration.
+// Listing more admins for one organisation does not give it more votes.
+func (config LedgerConfig) adminOrgCount() int {
+	organisations := 0
+	for _, identities := range config.Admins {
+		if len(identities) > 0 {
+			organisations++
+		}
+	}
+	return organisations
+}
+
+// SupplierTariffChange is the change of a supplierTariff proposal.
+type SupplierTariffChange struct {
+	SupplierId string          `json:"supplierId"`
+	Tariff     json.RawMessage `json:"tariff"`
+}
+
+// parseSupplierTariffChange checks a supplierTariff change against the supplier on the ledger.
+func parseSupplierTariffChange(APIstub shim.ChaincodeStubInterface, change json.RawMessage) (Participant, DemurrageTariff, error) {
+	tariffChange := SupplierTariffChange{}
+	if err := json.Unmarshal(change, &tariffChange); err != nil {
+		return Participant{}, DemurrageTariff{}, fmt.Errorf("Failed to decode supplier tariff change: %s", err.Error())
+	}
+	return parseSupplierTariff(APIstub, tariffChange.SupplierId, tariffChange.Tariff)
+}
+
+// assertUngoverned rejects a direct change of a configuration section while governance is configured.
+func assertUngoverned(APIstub shim.ChaincodeStubInterface, changeType string) error {
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return fmt.Errorf("Failed to get ledger configuration: %s", err.Error())
+	} else if config.Governance != nil {
+		return fmt.Errorf("Changes to %s need an approved proposal; use proposeConfigChange", changeType)
+	}
+	return nil
+}
+
+// designatedAdmin returns the MSP ID and identity of the caller if it is an admin named in the configuration.
+func designatedAdmin(APIstub shim.ChaincodeStubInterface, config LedgerConfig) (string, string, error) {
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get caller organisation: %s", err.Error())
+	}
+	adminId, err := callerIdentity(APIstub)
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get caller identity: %s", err.Error())
+	}
+	if !contains(config.Admins[mspId], adminId) {
+		return "", "", fmt.Errorf("Caller is not a designated admin of %s", mspId)
+	}
+	return mspId, adminId, nil
+}
+
+// mergeConfigChange validates change as the changeType section of the configuration and returns the
+// configuration with that section replaced.
+func mergeConfigChange(config LedgerConfig, changeType string, change json.RawMessage) (LedgerConfig, error) {
+	if !contains(governedChanges, changeType) {
+		return config, fmt.Errorf("Change type must be one of %v", governedChanges)
+	}
+
+	// Parsing the section on its own applies the same checks Init does; the quorum is checked against the merged configuration.
+	sectionAsBytes, _ := json.Marshal(map[string]json.RawMessage{changeType: change})
+	section, err := parseLedgerConfig(string(sectionAsBytes))
+	if err != nil {
+		return config, err
+	}
+
+	switch changeType {
+	case "rules":
+		config.Rules = section.Rules
+	case "defaultTariff":
+		config.DefaultTariff = section.DefaultTariff
+	case "roleOrganisations":
+		config.RoleOrganisations = section.RoleOrganisations
+	case "statusTransitions":
+		config.StatusTransitions = section.StatusTransitions
+	case "admins":
+		config.Admins = section.Admins
+	case "maxBatchSize":
+		if section.MaxBatchSize < 1 {
+			return config, fmt.Errorf("Max batch size must be a whole number of at least 1")
+		}
+		config.MaxBatchSize = section.MaxBatchSize
+	case "governance":
+		config.Governance = section.Governance
+	}
+
+	if err := config.validateGovernance(); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// applyConfigChange writes an approved change along with the state kept outside the configuration record.
+func applyConfigChange(APIstub shim.ChaincodeStubInterface, proposal *Proposal) error {
+	if proposal.ChangeType == supplierTariffChangeType {
+		supplier, tariff, err := parseSupplierTariffChange(APIstub, proposal.Change)
+		if err != nil {
+			return err
+		}
+		return writeSupplierTariff(APIstub, supplier, tariff)
+	}
+
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return err
+	}
+	// The rest of the configuration may have changed since the proposal, so it is merged again.
+	config, err = mergeConfigChange(config, proposal.ChangeType, proposal.Change)
+	if err != nil {
+		return err
+	}
+
+	if err := putLedgerConfig(APIstub, config); err != nil {
+		return err
+	}
+	switch proposal.ChangeType {
+	case "roleOrganisations":
+		return writeRoleOrganisations(APIstub, config.RoleOrganisations)
+	case "maxBatchSize":
+		return writeMaxBatchSize(APIstub, config.MaxBatchSize)
+	}
+	return nil
+}
+
+// expire marks an Open proposal past its deadline as Expired. Expiry is not written; it follows from the deadline.
+func (proposal *Proposal) expire(now time.Time) {
+	if proposal.Status != proposalOpenStatus {
+		return
+	}
+	if deadline, err := time.Parse(time.RFC3339, proposal.Deadline); err == nil && now.After(deadline) {
+		proposal.Status = proposalExpiredStatus
+	}
+}
+
+// hasVoted reports whether an admin of mspId has already approved or rejected the proposal.
+func (proposal *Proposal) hasVoted(mspId string) bool {
+	for _, vote := range append(append([]ProposalVote{}, proposal.Approvals...), proposal.Rejections...) {
+		if vote.MspId == mspId {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve applies the proposal once it has its quorum of approvals, and rejects it once too few organisations
+// are left to reach the quorum. Each vote is a distinct organisation's, so the votes are counted as they are.
+func (proposal *Proposal) resolve(APIstub shim.ChaincodeStubInterface, config LedgerConfig, now time.Time) error {
+	if len(proposal.Approvals) >= proposal.Quorum {
+		if err := applyConfigChange(APIstub, proposal); err != nil {
+			return fmt.Errorf("Failed to apply %s change: %s", proposal.ChangeType, err.Error())
+		}
+		proposal.Status = proposalAppliedStatus
+	} else if config.adminOrgCount()-len(proposal.Rejections) < proposal.Quorum {
+		proposal.Status = proposalRejectedStatus
+	} else {
+		return nil
+	}
+	proposal.ResolvedAt = now.UTC().Format(time.RFC3339)
+	proposal.ResolvedTxId = APIstub.GetTxID()
+	return nil
+}
+
+// proposeConfigChange - args: proposalId, changeType, change (JSON of the configuration section, e.g. a rules
+// array for rules), description. Only a designated admin can propose; the proposal counts as their organisation's approval.
+func (s *SmartContract) proposeConfigChange(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get ledger configuration: " + err.Error())
+	} else if config.Governance == nil {
+		return shim.Error("Governance is not configured; configuration is changed directly")
+	}
+	mspId, adminId, err := designatedAdmin(APIstub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	existing, proposalKey, err := readProposal(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get proposal: " + err.Error())
+	} else if existing != nil {
+		return shim.Error("Proposal " + args[0] + " already exists")
+	}
+	if args[1] == supplierTariffChangeType {
+		_, _, err = parseSupplierTariffChange(APIstub, json.RawMessage(args[2]))
+	} else {
+		_, err = mergeConfigChange(config, args[1], json.RawMessage(args[2]))
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	votingPeriod := config.Governance.VotingPeriodHours
+	if votingPeriod == 0 {
+		votingPeriod = defaultVotingPeriodHours
+	}
+	stamp := now.UTC().Format(time.RFC3339)
+
+	proposal := Proposal{ProposalId: args[0], ChangeType: args[1], Change: json.RawMessage(args[2]), Description: args[3], ProposedBy: adminId, ProposerMspId: mspId, ProposedAt: stamp, Deadline: now.Add(time.Duration(votingPeriod) * time.Hour).UTC().Format(time.RFC3339), Quorum: config.Governance.Quorum, Approvals: []ProposalVote{{MspId: mspId, AdminId: adminId, Timestamp: stamp, TxId: APIstub.GetTxID()}}, Rejections: []ProposalVote{}, Status: proposalOpenStatus, SchemaVersion: currentSchemaVersion}
+	if err := proposal.resolve(APIstub, config, now); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := putObject(APIstub, proposalKey, proposal); err != nil {
+		return shim.Error("Failed to record proposal: " + err.Error())
+	}
+
+	proposalAsBytes, _ := json.Marshal(proposal)
+	return shim.Success(proposalAsBytes)
+}
+
+// voteOnProposal records a designated admin's approval or rejection of an Open proposal before its deadline,
+// on behalf of their organisation.
+func voteOnProposal(APIstub shim.ChaincodeStubInterface, proposalId string, approve bool, reason string) sc.Response {
+
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get ledger configuration: " + err.Error())
+	}
+	mspId, adminId, err := designatedAdmin(APIstub, config)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposal, proposalKey, err := readProposal(APIstub, proposalId)
+	if err != nil {
+		return shim.Error("Failed to get proposal: " + err.Error())
+	} else if proposal == nil {
+		return shim.Error("Proposal " + proposalId + " does not exist")
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	proposal.expire(now)
+	if proposal.Status == proposalExpiredStatus {
+		return shim.Error("Proposal " + proposalId + " expired at " + proposal.Deadline)
+	} else if proposal.Status != proposalOpenStatus {
+		return shim.Error("Proposal " + proposalId + " is already " + proposal.Status)
+	} else if proposal.hasVoted(mspId) {
+		return shim.Error("Organisation " + mspId + " has already voted on proposal " + proposalId)
+	}
+
+	vote := ProposalVote{MspId: mspId, AdminId: adminId, Reason: reason, Timestamp: now.UTC().Format(time.RFC3339), TxId: APIstub.GetTxID()}
+	if approve {
+		proposal.Approvals = append(proposal.Approvals, vote)
+	} else {
+		proposal.Rejections = append(proposal.Rejections, vote)
+	}
+	if err := proposal.resolve(APIstub, config, now); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := putObject(APIstub, proposalKey, proposal); err != nil {
+		return shim.Error("Failed to record proposal: " + err.Error())
+	}
+
+	proposalAsBytes, _ := json.Marshal(proposal)
+	return shim.Success(proposalAsBytes)
+}
+
+// approveProposal - args: proposalId. The approval that reaches the quorum applies the change.
+func (s *SmartContract) approveProposal(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	return voteOnProposal(APIstub, args[0], true, "")
+}
+
+// rejectProposal - args: proposalId, reason. The proposal is Rejected once too few organisations are left to reach the quorum.
+func (s *SmartContract) rejectProposal(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	return voteOnProposal(APIstub, args[0], false, args[1])
+}
+
+// getProposal - args: proposalId.
+func (s *SmartContract) getProposal(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	proposal, _, err := readProposal(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get proposal: " + err.Error())
+	} else if proposal == nil {
+		return shim.Error("Proposal " + args[0] + " does not exist")
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	proposal.expire(now)
+
+	proposalAsBytes, _ := json.Marshal(proposal)
+	return shim.Success(proposalAsBytes)
+}
+
+// getProposals - args: status ("" for all). Lists proposals, oldest proposal ID first.
+func (s *SmartContract) getProposals(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+
+	proposalsIterator, err := APIstub.GetStateByPartialCompositeKey(proposalObjectType, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer proposalsIterator.Close()
+
+	proposals := []Proposal{}
+	for proposalsIterator.HasNext() {
+		proposalAsKV, err := proposalsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		proposal := Proposal{}
+		if err := unmarshalRecord(proposalObjectType, proposalAsKV.Value, &proposal); err != nil {
+			return shim.Error("Failed to decode proposal: " + err.Error())
+		}
+		proposal.expire(now)
+		if args[0] == "" || proposal.Status == args[0] {
+			proposals = append(proposals, proposal)
+		}
+	}
+
+	proposalsAsBytes, _ := json.Marshal(proposals)
+	return shim.Success(proposalsAsBytes)
+}
+
+// getProposalHistory - args: proposalId. Returns every version of the proposal with the transaction that wrote it.
+func (s *SmartContract) getProposalHistory(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	proposalKey, err := APIstub.CreateCompositeKey(proposalObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return s.getHistory(APIstub, []string{proposalKey})
+}
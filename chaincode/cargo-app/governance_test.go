@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestValidateGovernance(t *testing.T) {
+	admins := map[string][]string{"Org1MSP": {"A1", "A2", "A3"}, "Org2MSP": {"B1"}, "Org3MSP": {}}
+
+	tests := []struct {
+		name       string
+		governance *GovernanceConfig
+		wantErr    bool
+	}{
+		{"no governance", nil, false},
+		{"one organisation", &GovernanceConfig{Quorum: 1}, false},
+		{"every organisation", &GovernanceConfig{Quorum: 2}, false},
+		// Org1MSP's three admins are still one organisation, and Org3MSP has none.
+		{"more organisations than have admins", &GovernanceConfig{Quorum: 3}, true},
+		{"no quorum", &GovernanceConfig{Quorum: 0}, true},
+		{"negative voting period", &GovernanceConfig{Quorum: 1, VotingPeriodHours: -1}, true},
+	}
+	for _, test := range tests {
+		config := LedgerConfig{Admins: admins, Governance: test.governance}
+		if err := config.validateGovernance(); (err != nil) != test.wantErr {
+			t.Errorf("%s: validateGovernance() = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+// governedTestStub configures two admins for Org1MSP and one each for Org2MSP and Org3MSP, with a quorum of two organisations.
+func governedTestStub(t *testing.T) (*testStub, map[string]func() *testStub) {
+	stub := newTestStub(t)
+
+	admins := map[string]func() *testStub{}
+	config := LedgerConfig{Admins: map[string][]string{}, Governance: &GovernanceConfig{Quorum: 2}}
+	for _, admin := range []struct{ name, mspId string }{{"A1", testMspId}, {"A2", testMspId}, {"B1", otherTestMspId}, {"C1", "Org3MSP"}} {
+		admin := admin
+		admins[admin.name] = func() *testStub { return stub.as(admin.mspId, map[string]string{"name": admin.name}) }
+
+		var identity string
+		admins[admin.name]()
+		if err := stub.run(func() (err error) { identity, err = callerIdentity(stub); return err }); err != nil {
+			t.Fatal(err)
+		}
+		config.Admins[admin.mspId] = append(config.Admins[admin.mspId], identity)
+	}
+
+	configAsBytes, _ := json.Marshal(config)
+	if response := stub.init("init", string(configAsBytes)); response.Status != 200 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+	return stub, admins
+}
+
+func TestProposalQuorumCountsOrganisations(t *testing.T) {
+	stub, admins := governedTestStub(t)
+
+	var proposal Proposal
+	json.Unmarshal(admins["A1"]().mustInvoke("proposeConfigChange", "P1", "maxBatchSize", "5", "Smaller batches"), &proposal)
+	if proposal.Status != proposalOpenStatus {
+		t.Fatalf("proposal is %s after the proposer's approval, want Open", proposal.Status)
+	}
+	// A second admin of the proposer's organisation does not make a second organisation.
+	admins["A2"]().mustFail("Organisation Org1MSP has already voted", "approveProposal", "P1")
+
+	json.Unmarshal(admins["B1"]().mustInvoke("approveProposal", "P1"), &proposal)
+	if proposal.Status != proposalAppliedStatus {
+		t.Errorf("proposal is %s after approvals from two organisations, want Applied", proposal.Status)
+	}
+	if maxBatchSize, err := readMaxBatchSize(stub); err != nil || maxBatchSize != 5 {
+		t.Errorf("max batch size = %d (%v), want 5", maxBatchSize, err)
+	}
+
+	admins["A1"]().mustInvoke("proposeConfigChange", "P2", "maxBatchSize", "50", "Larger batches")
+	admins["B1"]().mustInvoke("rejectProposal", "P2", "Too large")
+	json.Unmarshal(admins["C1"]().mustInvoke("rejectProposal", "P2", "Too large"), &proposal)
+	if proposal.Status != proposalRejectedStatus {
+		t.Errorf("proposal is %s once only one organisation can still approve, want Rejected", proposal.Status)
+	}
+}
+
+func TestSupplierTariffIsGoverned(t *testing.T) {
+	stub, admins := governedTestStub(t)
+	stub.registerTestParticipant(otherTestMspId, "SUPPLIER", "Container Supplier")
+	stub.registerTestParticipant(otherTestMspId, "BUYER", "Importer")
+
+	tariff := `{"currency":"USD","freeDays":5,"tiers":[{"fromDay":1,"dailyRate":50}]}`
+	admins["B1"]().mustFail("need an approved proposal", "setDemurrageTariff", "SUPPLIER", tariff)
+	admins["B1"]().mustFail("is not a Container Supplier", "proposeConfigChange", "P1", supplierTariffChangeType, `{"supplierId":"BUYER","tariff":`+tariff+`}`, "")
+	admins["B1"]().mustFail("Free days cannot be negative", "proposeConfigChange", "P1", supplierTariffChangeType, `{"supplierId":"SUPPLIER","tariff":{"currency":"USD","freeDays":-1}}`, "")
+
+	readTariff := func() *DemurrageTariff {
+		t.Helper()
+		var recorded *DemurrageTariff
+		if err := stub.run(func() (err error) { recorded, _, err = readDemurrageTariff(stub, "SUPPLIER"); return err }); err != nil {
+			t.Fatal(err)
+		}
+		return recorded
+	}
+
+	admins["B1"]().mustInvoke("proposeConfigChange", "P1", supplierTariffChangeType, `{"supplierId":"SUPPLIER","tariff":`+tariff+`}`, "Supplier tariff")
+	if recorded := readTariff(); recorded != nil {
+		t.Fatalf("tariff %+v recorded before the quorum was reached", recorded)
+	}
+	admins["C1"]().mustInvoke("approveProposal", "P1")
+
+	if recorded := readTariff(); recorded == nil || recorded.SupplierId != "SUPPLIER" || recorded.FreeDays != 5 {
+		t.Errorf("recorded tariff = %+v, want SUPPLIER's with 5 free days", recorded)
+	}
+}
+
+func TestAdminChangeMovesConfigEndorsement(t *testing.T) {
+	stub, admins := governedTestStub(t)
+
+	var config LedgerConfig
+	json.Unmarshal(admins["A1"]().mustInvoke("getLedgerConfig"), &config)
+	delete(config.Admins, "Org3MSP")
+	change, _ := json.Marshal(config.Admins)
+
+	admins["A1"]().mustInvoke("proposeConfigChange", "P1", "admins", string(change), "Org3MSP leaves the network")
+	admins["B1"]().mustInvoke("approveProposal", "P1")
+
+	if orgs, want := stub.endorsingOrgs(ledgerConfigKey), []string{testMspId, otherTestMspId}; !reflect.DeepEqual(orgs, want) {
+		t.Errorf("ledger configuration endorsed by %v, want %v", orgs, want)
+	}
+}
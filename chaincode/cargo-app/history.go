@@ -0,0 +1,245 @@
+/*
+ * History:
+ * Key history only keeps the values written, so every submitted transaction also records a TxAudit
+ * with the function invoked and the identity that submitted it. getHistory joins the two, ordering
+ * a record's versions by transaction time and listing the fields each version changed.
+ * Changed fields are JSON paths such as status or seal.status; arrays are compared as a whole.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const txAuditObjectType = "TxAudit"
+
+// TxAudit records who submitted a transaction and which function it invoked.
+type TxAudit struct {
+	TxId           string `json:"txId"`
+	Function       string `json:"function"`
+	SubmitterMspId string `json:"submitterMspId"`
+	SubmitterId    string `json:"submitterId"`
+	ParticipantId  string `json:"participantId"`
+	Timestamp      string `json:"timestamp"`
+	SchemaVersion  int    `json:"schemaVersion"`
+}
+
+// FieldChange is one field that differs from the previous version of a record.
+type FieldChange struct {
+	Field    string      `json:"field"`
+	Previous interface{} `json:"previous"`
+	Current  interface{} `json:"current"`
+}
+
+// HistoryEntry is one version of a record with the transaction that wrote it.
+type HistoryEntry struct {
+	TxId           string          `json:"txId"`
+	Timestamp      string          `json:"timestamp"`
+	IsDelete       bool            `json:"isDelete"`
+	Function       string          `json:"function"`
+	SubmitterMspId string          `json:"submitterMspId"`
+	SubmitterId    string          `json:"submitterId"`
+	ParticipantId  string          `json:"participantId"`
+	Changes        []FieldChange   `json:"changes"`
+	Value          json.RawMessage `json:"value"`
+}
+
+// isQueryFunction reports whether function only reads the ledger, in which case no audit record is written.
+func isQueryFunction(function string) bool {
+	for _, prefix := range []string{"get", "trace", "track", "verify", "evaluate"} {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordTxAudit writes the TxAudit of the current transaction.
+func recordTxAudit(APIstub shim.ChaincodeStubInterface, function string) error {
+	if isQueryFunction(function) {
+		return nil
+	}
+
+	audit := TxAudit{TxId: APIstub.GetTxID(), Function: function}
+	var err error
+	if audit.SubmitterMspId, err = cid.GetMSPID(APIstub); err != nil {
+		return err
+	}
+	if audit.SubmitterId, err = cid.GetID(APIstub); err != nil {
+		return err
+	}
+	if audit.ParticipantId, _, err = cid.GetAttributeValue(APIstub, participantIdAttribute); err != nil {
+		return err
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	audit.Timestamp = now.UTC().Format(time.RFC3339)
+
+	auditKey, err := APIstub.CreateCompositeKey(txAuditObjectType, []string{audit.TxId})
+	if err != nil {
+		return err
+	}
+	return putObject(APIstub, auditKey, audit)
+}
+
+// historyVersion is one version of a key, as written by transaction TxId at At.
+type historyVersion struct {
+	TxId     string
+	At       time.Time
+	IsDelete bool
+	Value    []byte
+}
+
+// readHistory returns every version of a key in the order the versions were committed, oldest first.
+// It is not sorted by timestamp: a transaction's timestamp is set by its client, so a later version can carry
+// an earlier time than the version before it.
+func readHistory(APIstub shim.ChaincodeStubInterface, key string) ([]historyVersion, error) {
+	historyIterator, err := APIstub.GetHistoryForKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer historyIterator.Close()
+
+	var versions []historyVersion
+	for historyIterator.HasNext() {
+		modification, err := historyIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		at, err := ptypes.Timestamp(modification.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, historyVersion{TxId: modification.TxId, At: at, IsDelete: modification.IsDelete, Value: modification.Value})
+	}
+
+	return versions, nil
+}
+
+func readTxAudit(APIstub shim.ChaincodeStubInterface, txId string) (*TxAudit, error) {
+	auditKey, err := APIstub.CreateCompositeKey(txAuditObjectType, []string{txId})
+	if err != nil {
+		return nil, err
+	}
+	auditAsBytes, err := APIstub.GetState(auditKey)
+	if err != nil || auditAsBytes == nil {
+		return nil, err
+	}
+
+	audit := TxAudit{}
+	err = unmarshalRecord(txAuditObjectType, auditAsBytes, &audit)
+	return &audit, err
+}
+
+// diffFields appends the changes between two decoded JSON values, descending into objects.
+// At the top level a missing version counts as an empty object, so creation and deletion list every field.
+func diffFields(path string, previous interface{}, current interface{}, changes []FieldChange) []FieldChange {
+	if path == "" {
+		if previous == nil {
+			previous = map[string]interface{}{}
+		}
+		if current == nil {
+			current = map[string]interface{}{}
+		}
+	}
+	previousObject, previousIsObject := previous.(map[string]interface{})
+	currentObject, currentIsObject := current.(map[string]interface{})
+	if !previousIsObject || !currentIsObject {
+		if !reflect.DeepEqual(previous, current) {
+			changes = append(changes, FieldChange{Field: path, Previous: previous, Current: current})
+		}
+		return changes
+	}
+
+	var fields []string
+	for field := range previousObject {
+		fields = append(fields, field)
+	}
+	for field := range currentObject {
+		if _, found := previousObject[field]; !found {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		fieldPath := field
+		if path != "" {
+			fieldPath = path + "." + field
+		}
+		changes = diffFields(fieldPath, previousObject[field], currentObject[field], changes)
+	}
+	return changes
+}
+
+// getHistory - args: key, and optionally fromTime and toTime (RFC3339; empty for no bound).
+// Works for any record stored under a plain key, such as a Cargo, Container or Participant HashId.
+// Changes are against the previous version even when that version is outside the time range.
+func (s *SmartContract) getHistory(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 3")
+	}
+
+	from, err := parseOptionalTime(optionalArg(args, 1))
+	if err != nil {
+		return shim.Error("fromTime must be in RFC3339 format: " + err.Error())
+	}
+	to, err := parseOptionalTime(optionalArg(args, 2))
+	if err != nil {
+		return shim.Error("toTime must be in RFC3339 format: " + err.Error())
+	}
+
+	versions, err := readHistory(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get history: " + err.Error())
+	}
+
+	history := []HistoryEntry{}
+	var previous interface{}
+	for _, version := range versions {
+		var current interface{}
+		if !version.IsDelete {
+			if err := json.Unmarshal(version.Value, &current); err != nil {
+				return shim.Error("Failed to decode version " + version.TxId + ": " + err.Error())
+			}
+		}
+		changes := diffFields("", previous, current, []FieldChange{})
+		previous = current
+
+		if (!from.IsZero() && version.At.Before(from)) || (!to.IsZero() && version.At.After(to)) {
+			continue
+		}
+
+		entry := HistoryEntry{TxId: version.TxId, Timestamp: version.At.UTC().Format(time.RFC3339Nano), IsDelete: version.IsDelete, Changes: changes}
+		if !version.IsDelete {
+			entry.Value = json.RawMessage(version.Value)
+		}
+		audit, err := readTxAudit(APIstub, version.TxId)
+		if err != nil {
+			return shim.Error("Failed to get transaction audit: " + err.Error())
+		}
+		if audit != nil {
+			entry.Function = audit.Function
+			entry.SubmitterMspId = audit.SubmitterMspId
+			entry.SubmitterId = audit.SubmitterId
+			entry.ParticipantId = audit.ParticipantId
+		}
+		history = append(history, entry)
+	}
+
+	historyAsBytes, _ := json.Marshal(history)
+	return shim.Success(historyAsBytes)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsQueryFunction(t *testing.T) {
+	tests := []struct {
+		function string
+		query    bool
+	}{
+		{"getHistory", true},
+		{"traceCargo", true},
+		{"trackCargoDetails", true},
+		{"verifyBillOfLading", true},
+		{"evaluateRules", true},
+		{"addNewContainer", false},
+		{"updateParticipant", false},
+	}
+	for _, test := range tests {
+		if query := isQueryFunction(test.function); query != test.query {
+			t.Errorf("isQueryFunction(%s) = %v, want %v", test.function, query, test.query)
+		}
+	}
+}
+
+func TestDiffFields(t *testing.T) {
+	decode := func(value string) interface{} {
+		var decoded interface{}
+		if value != "" {
+			if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return decoded
+	}
+
+	tests := []struct {
+		name     string
+		previous string
+		current  string
+		fields   []string
+	}{
+		{"unchanged", `{"status":"Ready"}`, `{"status":"Ready"}`, []string{}},
+		{"changed field", `{"status":"Ready","owner":"P1"}`, `{"status":"In-Transit","owner":"P1"}`, []string{"status"}},
+		{"nested field", `{"seal":{"status":"Intact","sealNumber":"S1"}}`, `{"seal":{"status":"Broken","sealNumber":"S1"}}`, []string{"seal.status"}},
+		{"array as a whole", `{"ids":["C1"]}`, `{"ids":["C1","C2"]}`, []string{"ids"}},
+		{"added and removed fields", `{"a":1}`, `{"b":2}`, []string{"a", "b"}},
+		{"created", "", `{"status":"Ready","owner":"P1"}`, []string{"owner", "status"}},
+		{"deleted", `{"status":"Ready"}`, "", []string{"status"}},
+	}
+	for _, test := range tests {
+		fields := []string{}
+		for _, change := range diffFields("", decode(test.previous), decode(test.current), []FieldChange{}) {
+			fields = append(fields, change.Field)
+		}
+		if !reflect.DeepEqual(fields, test.fields) {
+			t.Errorf("%s: diffFields() changed %v, want %v", test.name, fields, test.fields)
+		}
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	stub := newTestStub(t)
+	// tx1 at 08:00 registers, tx2 at 08:01 renames and tx3 at 08:02 suspends.
+	stub.registerTestParticipant(testMspId, "P1", "Exporter")
+	stub.asAdmin(testMspId).mustInvoke("updateParticipant", "P1", "P1 Exports", "p1@example.com", "Exporter")
+	stub.asAdmin(testMspId).mustInvoke("suspendParticipant", "P1", "Unpaid fees")
+
+	tests := []struct {
+		name      string
+		args      []string
+		txIds     []string
+		functions []string
+	}{
+		{"whole history", []string{"P1"}, []string{"tx1", "tx2", "tx3"}, []string{"registerParticipant", "updateParticipant", "suspendParticipant"}},
+		{"from a time", []string{"P1", "2020-03-01T08:01:00Z", ""}, []string{"tx2", "tx3"}, []string{"updateParticipant", "suspendParticipant"}},
+		{"up to a time", []string{"P1", "", "2020-03-01T08:01:00Z"}, []string{"tx1", "tx2"}, []string{"registerParticipant", "updateParticipant"}},
+	}
+	for _, test := range tests {
+		var history []HistoryEntry
+		if err := json.Unmarshal(stub.mustInvoke("getHistory", test.args...), &history); err != nil {
+			t.Fatal(err)
+		}
+		txIds, functions := []string{}, []string{}
+		for _, entry := range history {
+			txIds = append(txIds, entry.TxId)
+			functions = append(functions, entry.Function)
+			if entry.SubmitterMspId != testMspId {
+				t.Errorf("%s: %s submitted by %s, want %s", test.name, entry.TxId, entry.SubmitterMspId, testMspId)
+			}
+		}
+		if !reflect.DeepEqual(txIds, test.txIds) || !reflect.DeepEqual(functions, test.functions) {
+			t.Errorf("%s: getHistory() = %v %v, want %v %v", test.name, txIds, functions, test.txIds, test.functions)
+		}
+		// Changes are against the previous version even when it is outside the range.
+		if len(history) > 0 && history[0].TxId == "tx2" && (len(history[0].Changes) != 1 || history[0].Changes[0].Field != "name") {
+			t.Errorf("%s: tx2 changed %+v, want only name", test.name, history[0].Changes)
+		}
+	}
+
+	stub.mustFail("fromTime must be in RFC3339 format", "getHistory", "P1", "yesterday", "")
+}
+
+func TestHistoryKeepsCommitOrder(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "VIEWER", "Importer")
+	put := func(record Container) {
+		t.Helper()
+		if err := stub.run(func() error { return putObject(stub, "C1", record) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// tx2 is written at 08:01; tx3 is committed after it but its client stamps it an hour earlier.
+	put(Container{HashId: "C1", Status: "Available"})
+	stub.now = stub.now.Add(-time.Hour)
+	put(Container{HashId: "C1", Status: "Loaded"})
+	stub.now = stub.now.Add(time.Hour)
+
+	var history []HistoryEntry
+	if err := json.Unmarshal(stub.asParticipant(testMspId, "VIEWER").mustInvoke("getHistory", "C1"), &history); err != nil {
+		t.Fatal(err)
+	}
+	txIds := []string{}
+	for _, entry := range history {
+		txIds = append(txIds, entry.TxId)
+	}
+	if !reflect.DeepEqual(txIds, []string{"tx2", "tx3"}) {
+		t.Errorf("getHistory() = %v, want [tx2 tx3] in commit order", txIds)
+	}
+
+	// The backdated version is the current one, so it is what the ledger says afterwards.
+	var asOf VersionAsOf
+	if err := json.Unmarshal(stub.mustInvoke("getContainerAsOf", "C1", "2020-03-01T09:00:00Z"), &asOf); err != nil {
+		t.Fatal(err)
+	}
+	if asOf.TxId != "tx3" {
+		t.Errorf("getContainerAsOf(C1, 09:00) = %s, want tx3", asOf.TxId)
+	}
+}
+
+func TestTraceCargoDecodesEachVersionAfresh(t *testing.T) {
+	stub := newTestStub(t)
+	put := func(value string) {
+		t.Helper()
+		if err := stub.run(func() error { return stub.PutState("CG1", []byte(value)) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put(`{"hashId":"CG1","status":"Ready","bookingId":"B1","legs":[{"mode":"Road","carrier":"P1","origin":"Pune","destination":"Delhi","status":"Planned"}]}`)
+	// A version written without the legs or booking must not show those of the version before it.
+	put(`{"hashId":"CG1","status":"Ready"}`)
+	stub.registerTestParticipant(testMspId, "VIEWER", "Importer")
+
+	var trace []struct {
+		TxId  string `json:"txId"`
+		Value Cargo  `json:"value"`
+		Leg   string `json:"leg"`
+	}
+	if err := json.Unmarshal(stub.asParticipant(testMspId, "VIEWER").mustInvoke("traceCargo", "CG1"), &trace); err != nil {
+		t.Fatal(err)
+	}
+	if len(trace) != 2 {
+		t.Fatalf("traceCargo() returned %d versions, want 2", len(trace))
+	}
+	if trace[0].Leg != "Leg 1 of 1 (Road, Pune to Delhi): Planned" {
+		t.Errorf("first version is on %q, want leg 1", trace[0].Leg)
+	}
+	if trace[1].Leg != "" || len(trace[1].Value.Legs) != 0 || trace[1].Value.BookingId != "" {
+		t.Errorf("second version kept leg %q, legs %v and booking %q from the first", trace[1].Leg, trace[1].Value.Legs, trace[1].Value.BookingId)
+	}
+}
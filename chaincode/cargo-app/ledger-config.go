@@ -0,0 +1,216 @@
+/*
+ * Ledger configuration:
+ * Init takes the network configuration as JSON when the chaincode is instantiated or upgraded:
+ * the admin identities of each organisation, the organisations playing each business role, the
+ * status transitions allowed for Containers and Cargo, the default demurrage tariff, the
+ * maximum batch size, the business rules (see rules.go) and the quorum for configuration changes
+ * (see governance.go). Init without a configuration keeps the one already on the ledger.
+ * Init functions --> init (configuration only), initLedger (configuration and demo dataset).
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const ledgerConfigKey = "LedgerConfig"
+
+// LedgerConfig is the network configuration set through Init.
+// Admins maps an MSP ID to the identities (x509::subject::issuer, as in cid.GetID) that act as its org admins.
+// StatusTransitions maps Container or Cargo to the statuses each status may change to; object types
+// without transitions accept any status change.
+type LedgerConfig struct {
+	Admins            map[string][]string            `json:"admins"`
+	RoleOrganisations map[string][]string            `json:"roleOrganisations"`
+	StatusTransitions map[string]map[string][]string `json:"statusTransitions"`
+	DefaultTariff     *DemurrageTariff               `json:"defaultTariff"`
+	MaxBatchSize      int                            `json:"maxBatchSize"`
+	Rules             []Rule                         `json:"rules"`
+	Governance        *GovernanceConfig              `json:"governance"`
+	SchemaVersion     int                            `json:"schemaVersion"`
+}
+
+func readLedgerConfig(APIstub shim.ChaincodeStubInterface) (LedgerConfig, error) {
+	config := LedgerConfig{}
+
+	configAsBytes, err := APIstub.GetState(ledgerConfigKey)
+	if err != nil || configAsBytes == nil {
+		return config, err
+	}
+
+	err = json.Unmarshal(configAsBytes, &config)
+	return config, err
+}
+
+// parseLedgerConfig decodes and validates a configuration, rejecting fields LedgerConfig does not have.
+func parseLedgerConfig(value string) (LedgerConfig, error) {
+	config := LedgerConfig{}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return config, fmt.Errorf("Failed to decode ledger configuration: %s", err.Error())
+	}
+
+	for mspId, identities := range config.Admins {
+		for _, identity := range identities {
+			if identity == "" {
+				return config, fmt.Errorf("Admin identities of %s cannot be empty", mspId)
+			}
+		}
+	}
+	for objectType := range config.StatusTransitions {
+		if objectType != "Container" && objectType != "Cargo" {
+			return config, fmt.Errorf("Status transitions can only be configured for Container and Cargo, not %s", objectType)
+		}
+	}
+	if config.DefaultTariff != nil {
+		if err := config.DefaultTariff.validate(); err != nil {
+			return config, fmt.Errorf("Invalid default tariff: %s", err.Error())
+		}
+		config.DefaultTariff.SupplierId = ""
+	}
+	if config.MaxBatchSize < 0 {
+		return config, fmt.Errorf("Max batch size cannot be negative")
+	}
+	if err := validateRules(config.Rules); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// putLedgerConfig stores a configuration so that from then on it only changes with the endorsement of
+// every organisation that has admins configured.
+func putLedgerConfig(APIstub shim.ChaincodeStubInterface, config LedgerConfig) error {
+	if err := putObject(APIstub, ledgerConfigKey, config); err != nil {
+		return err
+	}
+
+	var mspIds []string
+	for mspId := range config.Admins {
+		mspIds = append(mspIds, mspId)
+	}
+	sort.Strings(mspIds)
+	return setKeyEndorsementOrgs(APIstub, ledgerConfigKey, mspIds...)
+}
+
+// applyLedgerConfig stores a configuration along with the role assignments and batch size it sets.
+func applyLedgerConfig(APIstub shim.ChaincodeStubInterface, config LedgerConfig) error {
+	if err := putLedgerConfig(APIstub, config); err != nil {
+		return err
+	}
+	if config.RoleOrganisations != nil {
+		if err := writeRoleOrganisations(APIstub, config.RoleOrganisations); err != nil {
+			return err
+		}
+	}
+	if config.MaxBatchSize > 0 {
+		if err := writeMaxBatchSize(APIstub, config.MaxBatchSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initLedger - Init function (init or initLedger), args: optionally the ledger configuration (JSON LedgerConfig).
+// initLedger also seeds the demo dataset, leaving any demo records that already exist alone.
+func (s *SmartContract) initLedger(APIstub shim.ChaincodeStubInterface, function string, args []string) sc.Response {
+
+	if function == "" {
+		function = "init"
+	} else if function != "init" && function != "initLedger" {
+		return shim.Error("Invalid Init function name. Expecting init or initLedger")
+	}
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 0 or 1")
+	}
+
+	if err := recordTxAudit(APIstub, function); err != nil {
+		return shim.Error("Failed to record transaction audit: " + err.Error())
+	}
+
+	if len(args) == 1 && args[0] != "" {
+		config, err := parseLedgerConfig(args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := config.validateGovernance(); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err := applyLedgerConfig(APIstub, config); err != nil {
+			return shim.Error("Failed to record ledger configuration: " + err.Error())
+		}
+	}
+
+	if function == "initLedger" {
+		if err := seedDemoLedger(APIstub); err != nil {
+			return shim.Error("Failed to seed demo dataset: " + err.Error())
+		}
+	}
+
+	return shim.Success(nil)
+}
+
+func (s *SmartContract) getLedgerConfig(APIstub shim.ChaincodeStubInterface) sc.Response {
+
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get ledger configuration: " + err.Error())
+	}
+
+	configAsBytes, _ := json.Marshal(config)
+	return shim.Success(configAsBytes)
+}
+
+// callerIsConfiguredAdmin reports whether the caller is listed as an admin of mspId in the ledger configuration.
+func callerIsConfiguredAdmin(APIstub shim.ChaincodeStubInterface, mspId string) bool {
+	config, err := readLedgerConfig(APIstub)
+	if err != nil || len(config.Admins[mspId]) == 0 {
+		return false
+	}
+
+	id, err := callerIdentity(APIstub)
+	if err != nil {
+		return false
+	}
+	return contains(config.Admins[mspId], id)
+}
+
+// callerIdentity returns the caller's identity in the x509::subject::issuer form used for admins.
+func callerIdentity(APIstub shim.ChaincodeStubInterface) (string, error) {
+	// cid.GetID base64 encodes x509::subject::issuer.
+	id, err := cid.GetID(APIstub)
+	if err != nil {
+		return "", err
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(id); err == nil {
+		id = string(decoded)
+	}
+	return id, nil
+}
+
+// assertStatusTransition checks a status change of a Container or Cargo against the configured transitions.
+func assertStatusTransition(APIstub shim.ChaincodeStubInterface, objectType string, from string, to string) error {
+	if from == to || from == "" {
+		return nil
+	}
+
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return fmt.Errorf("Failed to get ledger configuration: %s", err.Error())
+	}
+	transitions, found := config.StatusTransitions[objectType]
+	if !found || contains(transitions[from], to) {
+		return nil
+	}
+	return fmt.Errorf("%s cannot change from %s to %s", objectType, from, to)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/core/chaincode/shim/ext/statebased"
+)
+
+// asConfiguredAdmin makes the following transactions come from the admin of mspId that configureTestAdmins names.
+func (stub *testStub) asConfiguredAdmin(mspId string) *testStub {
+	return stub.as(mspId, map[string]string{"name": "admin"})
+}
+
+// configureTestAdmins initialises the ledger with one configured admin for each of mspIds.
+func (stub *testStub) configureTestAdmins(mspIds ...string) {
+	stub.t.Helper()
+
+	config := LedgerConfig{Admins: map[string][]string{}}
+	for _, mspId := range mspIds {
+		var identity string
+		stub.asConfiguredAdmin(mspId)
+		if err := stub.run(func() (err error) { identity, err = callerIdentity(stub); return err }); err != nil {
+			stub.t.Fatal(err)
+		}
+		config.Admins[mspId] = []string{identity}
+	}
+
+	configAsBytes, _ := json.Marshal(config)
+	if response := stub.init("init", string(configAsBytes)); response.Status != shim.OK {
+		stub.t.Fatalf("init failed: %s", response.Message)
+	}
+}
+
+// endorsingOrgs returns the organisations the key-level endorsement policy of key names, in order.
+func (stub *testStub) endorsingOrgs(key string) []string {
+	stub.t.Helper()
+
+	var orgs []string
+	err := stub.run(func() error {
+		policy, err := stub.GetStateValidationParameter(key)
+		if err != nil {
+			return err
+		}
+		endorsementPolicy, err := statebased.NewStateEP(policy)
+		if err != nil {
+			return err
+		}
+		orgs = endorsementPolicy.ListOrgs()
+		sort.Strings(orgs)
+		return nil
+	})
+	if err != nil {
+		stub.t.Fatal(err)
+	}
+	return orgs
+}
+
+func TestParseLedgerConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		wantErr bool
+	}{
+		{"empty", `{}`, false},
+		{"batch size", `{"maxBatchSize":50}`, false},
+		{"unknown field", `{"maxBatchSise":50}`, true},
+		{"empty admin identity", `{"admins":{"Org1MSP":[""]}}`, true},
+		{"transitions for participants", `{"statusTransitions":{"Participant":{"Active":["Suspended"]}}}`, true},
+		{"invalid default tariff", `{"defaultTariff":{"currency":"USD","freeDays":5,"tiers":[]}}`, true},
+		{"negative batch size", `{"maxBatchSize":-1}`, true},
+		{"invalid rule", `{"rules":[{"ruleId":"r1","function":"f"}]}`, true},
+	}
+	for _, test := range tests {
+		if _, err := parseLedgerConfig(test.value); (err != nil) != test.wantErr {
+			t.Errorf("%s: parseLedgerConfig() = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestShippedLedgerConfig(t *testing.T) {
+	configAsBytes, err := ioutil.ReadFile("ledger_config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := parseLedgerConfig(string(configAsBytes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.validateGovernance(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInitLedger(t *testing.T) {
+	stub := newTestStub(t)
+	config := `{"maxBatchSize":10,"statusTransitions":{"Container":{"Available":["Loaded"],"Loaded":["InCargo"]}}}`
+
+	stub.asAdmin(testMspId)
+	if response := stub.init("setup", config); response.Status == 200 {
+		t.Error("init accepted an unknown Init function")
+	}
+	if response := stub.init("initLedger", `{"maxBatchSise":10}`); response.Status == 200 {
+		t.Error("init accepted an invalid configuration")
+	}
+	for i := 0; i < 2; i++ {
+		// Seeding again leaves the demo records that already exist alone.
+		if response := stub.init("initLedger", config); response.Status != 200 {
+			t.Fatalf("initLedger failed: %s", response.Message)
+		}
+	}
+	if stub.State[demoCargoId] == nil {
+		t.Errorf("initLedger did not seed %s", demoCargoId)
+	}
+
+	var stored LedgerConfig
+	if err := json.Unmarshal(stub.mustInvoke("getLedgerConfig"), &stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.MaxBatchSize != 10 {
+		t.Errorf("stored max batch size = %d, want 10", stored.MaxBatchSize)
+	}
+	if maxBatchSize, err := readMaxBatchSize(stub); err != nil || maxBatchSize != 10 {
+		t.Errorf("max batch size = %d (%v), want 10", maxBatchSize, err)
+	}
+
+	// Init without a configuration keeps the one on the ledger.
+	if response := stub.init(""); response.Status != 200 {
+		t.Fatalf("init failed: %s", response.Message)
+	}
+
+	tests := []struct {
+		objectType string
+		from       string
+		to         string
+		wantErr    bool
+	}{
+		{"Container", "Available", "Loaded", false},
+		{"Container", "Available", "InCargo", true},
+		{"Container", "Loaded", "Loaded", false},
+		{"Container", "", "InCargo", false},
+		{"Cargo", "Ready", "Arrived", false},
+	}
+	for _, test := range tests {
+		err := stub.run(func() error { return assertStatusTransition(stub, test.objectType, test.from, test.to) })
+		if (err != nil) != test.wantErr {
+			t.Errorf("assertStatusTransition(%s, %s, %s) = %v, wantErr %v", test.objectType, test.from, test.to, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+/*
+ * Multimodal legs:
+ * A door-to-door Cargo can be planned as an ordered list of legs (e.g. truck, rail, sea, truck),
+ * each with its own mode, carrier and origin/destination. Every carrier on the plan accepts its legs
+ * (acceptCargoLeg) before the journey starts, which is its consent to take custody in turn. The carriers
+ * then run the legs in turn; when a leg is completed, custody passes to the next leg's carrier without a
+ * separate handover. traceCargo reports which leg the Cargo was on at each point.
+ * Leg States --> Planned, In-Transit, Completed.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Leg is one part of a Cargo's journey. Carrier is a Participant HashId or an OrganisationId.
+type Leg struct {
+	Mode        string `json:"mode"`
+	Carrier     string `json:"carrier"`
+	Origin      string `json:"origin"`
+	Destination string `json:"destination"`
+	Status      string `json:"status"`
+	AcceptedAt  string `json:"acceptedAt"`
+	StartedAt   string `json:"startedAt"`
+	CompletedAt string `json:"completedAt"`
+}
+
+// currentLeg returns the index of the first leg not yet completed, or -1 if there is none.
+func (cargo *Cargo) currentLeg() int {
+	for i, leg := range cargo.Legs {
+		if leg.Status != "Completed" {
+			return i
+		}
+	}
+	return -1
+}
+
+// describeLegProgress summarises the leg a Cargo is on, e.g. "Leg 2 of 4 (Rail, Nhava Sheva to Delhi): In-Transit".
+func describeLegProgress(cargo Cargo) string {
+	if len(cargo.Legs) == 0 {
+		return ""
+	}
+	i := cargo.currentLeg()
+	if i < 0 {
+		return fmt.Sprintf("All %d legs completed", len(cargo.Legs))
+	}
+	leg := cargo.Legs[i]
+	return fmt.Sprintf("Leg %d of %d (%s, %s to %s): %s", i+1, len(cargo.Legs), leg.Mode, leg.Origin, leg.Destination, leg.Status)
+}
+
+// legEndorsementOrgs returns the organisations of the Cargo's owner and of the carriers of its legs from index from onwards.
+func legEndorsementOrgs(APIstub shim.ChaincodeStubInterface, cargo Cargo, from int) []string {
+	mspIds := []string{ownerMspId(APIstub, cargo.Owner)}
+	for _, leg := range cargo.Legs[from:] {
+		mspIds = append(mspIds, ownerMspId(APIstub, leg.Carrier))
+	}
+	return mspIds
+}
+
+// planCargoLegs - args: cargoHashId, legs (JSON, e.g. [{"mode":"Road","carrier":"P1","origin":"Pune","destination":"Nhava Sheva"},...]).
+// The legs must join up from the Cargo's shippedFrom to its shippedTo, and the first carrier must hold the Cargo.
+// Legs carried by the Cargo's owner are accepted by planning them; every other carrier has to accept its legs.
+func (s *SmartContract) planCargoLegs(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Ready" {
+		return shim.Error("Legs can only be planned while the Cargo is Ready. Cargo status is " + cargo.Status)
+	}
+
+	var legs []Leg
+	if err := json.Unmarshal([]byte(args[1]), &legs); err != nil {
+		return shim.Error("Failed to decode legs: " + err.Error())
+	} else if len(legs) == 0 {
+		return shim.Error("A Cargo needs at least one leg")
+	}
+
+	for i := range legs {
+		leg := &legs[i]
+		switch leg.Mode {
+		case "Sea", "Air", "Rail", "Road":
+		default:
+			return shim.Error(fmt.Sprintf("Leg %d has invalid transport mode %s. Expecting Sea, Air, Rail or Road", i+1, leg.Mode))
+		}
+		if organisationId, mspId := resolveOwner(APIstub, leg.Carrier); organisationId == "" && mspId == "" {
+			return shim.Error(fmt.Sprintf("Carrier %s of leg %d is neither a Participant nor an Organisation", leg.Carrier, i+1))
+		}
+		if leg.Origin == "" || leg.Origin == leg.Destination {
+			return shim.Error(fmt.Sprintf("Leg %d needs distinct origin and destination", i+1))
+		} else if i > 0 && leg.Origin != legs[i-1].Destination {
+			return shim.Error(fmt.Sprintf("Leg %d starts at %s, not where leg %d ends (%s)", i+1, leg.Origin, i, legs[i-1].Destination))
+		}
+		leg.Status = "Planned"
+		leg.AcceptedAt = ""
+		leg.StartedAt = ""
+		leg.CompletedAt = ""
+	}
+	if legs[0].Origin != cargo.ShippedFrom || legs[len(legs)-1].Destination != cargo.ShippedTo {
+		return shim.Error("Legs must run from " + cargo.ShippedFrom + " to " + cargo.ShippedTo)
+	} else if legs[0].Carrier != cargo.Owner {
+		return shim.Error("The first leg must be carried by the Cargo's current owner " + cargo.Owner)
+	}
+	if err := assertNotSuspended(APIstub, cargo.Owner); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, cargo.Owner); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	for i := range legs {
+		if legs[i].Carrier == cargo.Owner {
+			legs[i].AcceptedAt = now.UTC().Format(time.RFC3339)
+		}
+	}
+
+	cargo.Legs = legs
+	cargo.TransportationType = legs[0].Mode
+
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+	// The plan was only endorsed by the owner's organisation. From now on every carrier's organisation
+	// endorses changes to the Cargo, starting with the acceptance of its own legs.
+	if err := setKeyEndorsementOrgs(APIstub, args[0], legEndorsementOrgs(APIstub, cargo, 0)...); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// acceptCargoLeg - args: cargoHashId, carrier. Accepts every planned leg the carrier is to run, agreeing to take custody of the Cargo
+// when the leg before it is completed. The caller must act for the carrier.
+func (s *SmartContract) acceptCargoLeg(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	accepted := 0
+	for i := range cargo.Legs {
+		leg := &cargo.Legs[i]
+		if leg.Carrier == args[1] && leg.Status == "Planned" && leg.AcceptedAt == "" {
+			leg.AcceptedAt = now.UTC().Format(time.RFC3339)
+			accepted++
+		}
+	}
+	if accepted == 0 {
+		return shim.Error("Cargo has no planned leg awaiting acceptance by " + args[1])
+	}
+
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// startCargoLeg - args: cargoHashId, carrier. Starting the first leg puts the Cargo In-Transit, so its Containers need VGM declarations.
+// The journey cannot start until every carrier has accepted its legs.
+func (s *SmartContract) startCargoLeg(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	i := cargo.currentLeg()
+	if i < 0 {
+		return shim.Error("Cargo has no leg left to start")
+	}
+	leg := &cargo.Legs[i]
+	if leg.Status != "Planned" {
+		return shim.Error(fmt.Sprintf("Leg %d is already %s", i+1, leg.Status))
+	} else if leg.Carrier != args[1] || cargo.Owner != args[1] {
+		return shim.Error(fmt.Sprintf("Leg %d can only be started by its carrier %s while it holds the Cargo", i+1, leg.Carrier))
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if cargo.Status == "Ready" {
+		for j, planned := range cargo.Legs {
+			if planned.AcceptedAt == "" {
+				return shim.Error(fmt.Sprintf("Leg %d has not been accepted by its carrier %s", j+1, planned.Carrier))
+			}
+		}
+		if err := assertContainersHaveVgm(APIstub, cargo.AssociatedContainerHashIds); err != nil {
+			return shim.Error(err.Error())
+		}
+		cargo.Status = "In-Transit"
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	leg.Status = "In-Transit"
+	leg.StartedAt = now.UTC().Format(time.RFC3339)
+	cargo.TransportationType = leg.Mode
+	cargo.Timestamp = leg.StartedAt
+
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+	if err := evaluateCargoSla(APIstub, cargo, nil); err != nil {
+		return shim.Error("Failed to evaluate SLA: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// completeCargoLeg - args: cargoHashId, carrier, and optionally the seals seen at handover (JSON object of container HashId to seal number).
+// The Cargo and its Containers move to the leg's destination, and custody passes to the next leg's carrier.
+// Completing the last leg makes the Cargo Arrived.
+func (s *SmartContract) completeCargoLeg(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	i := cargo.currentLeg()
+	if i < 0 || cargo.Legs[i].Status != "In-Transit" {
+		return shim.Error("Cargo has no leg in transit")
+	}
+	leg := &cargo.Legs[i]
+	if leg.Carrier != args[1] {
+		return shim.Error(fmt.Sprintf("Leg %d can only be completed by its carrier %s", i+1, leg.Carrier))
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	leg.Status = "Completed"
+	leg.CompletedAt = now.UTC().Format(time.RFC3339)
+	cargo.Timestamp = leg.CompletedAt
+	cargo.CargoLocation = leg.Destination
+
+	seals := map[string]string{}
+	if reportedSeals := optionalArg(args, 2); reportedSeals != "" {
+		if err := json.Unmarshal([]byte(reportedSeals), &seals); err != nil {
+			return shim.Error("Failed to decode reported seals: " + err.Error())
+		}
+	}
+
+	// Seals are checked as part of the same Container update, since a read in this transaction would not see an earlier write.
+	next := ""
+	if i < len(cargo.Legs)-1 {
+		if cargo.Legs[i+1].AcceptedAt == "" {
+			return shim.Error(fmt.Sprintf("Leg %d has not been accepted by its carrier %s", i+2, cargo.Legs[i+1].Carrier))
+		}
+		next = cargo.Legs[i+1].Carrier
+	}
+	for _, containerHashId := range cargo.AssociatedContainerHashIds {
+		container, err := readContainer(APIstub, containerHashId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		container.ContainerLocation = leg.Destination
+		if next != "" {
+			if err := verifySeal(APIstub, &container, seals[containerHashId], next); err != nil {
+				return shim.Error("Failed to verify seal: " + err.Error())
+			}
+		}
+		if err := putObject(APIstub, containerHashId, container); err != nil {
+			return shim.Error("Failed to update Container: " + err.Error())
+		}
+	}
+
+	endorsementOrgs := []string{ownerMspId(APIstub, cargo.Owner)}
+	if next == "" {
+		cargo.Status = "Arrived"
+	} else {
+		if err := assertNotSuspended(APIstub, next); err != nil {
+			return shim.Error(err.Error())
+		}
+		cargo.OwnerOrganisation, err = updateHolding(APIstub, "Cargo", args[0], cargo.OwnerOrganisation, next)
+		if err != nil {
+			return shim.Error("Failed to update organisation index: " + err.Error())
+		}
+		cargo.Owner = next
+		cargo.PendingOwner = ""
+		endorsementOrgs = legEndorsementOrgs(APIstub, cargo, i+1)
+	}
+
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, args[0], endorsementOrgs...); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+	if err := evaluateCargoSla(APIstub, cargo, nil); err != nil {
+		return shim.Error("Failed to evaluate SLA: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestDescribeLegProgress(t *testing.T) {
+	legs := func(statuses ...string) []Leg {
+		all := []Leg{{Mode: "Road", Origin: "Pune", Destination: "Nhava Sheva"}, {Mode: "Rail", Origin: "Nhava Sheva", Destination: "Delhi"}}
+		for i, status := range statuses {
+			all[i].Status = status
+		}
+		return all
+	}
+
+	tests := []struct {
+		legs     []Leg
+		progress string
+	}{
+		{nil, ""},
+		{legs("Planned", "Planned"), "Leg 1 of 2 (Road, Pune to Nhava Sheva): Planned"},
+		{legs("Completed", "In-Transit"), "Leg 2 of 2 (Rail, Nhava Sheva to Delhi): In-Transit"},
+		{legs("Completed", "Completed"), "All 2 legs completed"},
+	}
+	for _, test := range tests {
+		if progress := describeLegProgress(Cargo{Legs: test.legs}); progress != test.progress {
+			t.Errorf("describeLegProgress() = %q, want %q", progress, test.progress)
+		}
+	}
+}
+
+func TestCargoLegs(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "ROAD", "Transporter")
+	stub.registerTestParticipant(testMspId, "RAIL", "Transporter")
+	stub.seedTestRecord("Container", "C1", "ROAD", Container{HashId: "C1", Owner: "ROAD", Status: "InCargo", CargoId: "CG1", Vgm: Vgm{Weight: "24000"}, Seal: Seal{SealNumber: "S1", Status: sealIntactStatus}})
+	stub.seedTestRecord("Cargo", "CG1", "ROAD", Cargo{HashId: "CG1", Owner: "ROAD", Status: "Ready", ShippedFrom: "Pune", ShippedTo: "Delhi", CargoLocation: "Pune", AssociatedContainerHashIds: []string{"C1"}})
+
+	plan := `[{"mode":"Road","carrier":"ROAD","origin":"Pune","destination":"Nhava Sheva"},{"mode":"Rail","carrier":"RAIL","origin":"Nhava Sheva","destination":"Delhi"}]`
+	stub.asParticipant(testMspId, "ROAD")
+	stub.mustFail("invalid transport mode Ship", "planCargoLegs", "CG1", `[{"mode":"Ship","carrier":"ROAD","origin":"Pune","destination":"Delhi"}]`)
+	stub.mustFail("Leg 2 starts at Mumbai, not where leg 1 ends (Nhava Sheva)", "planCargoLegs", "CG1", `[{"mode":"Road","carrier":"ROAD","origin":"Pune","destination":"Nhava Sheva"},{"mode":"Rail","carrier":"RAIL","origin":"Mumbai","destination":"Delhi"}]`)
+	stub.mustFail("The first leg must be carried by the Cargo's current owner ROAD", "planCargoLegs", "CG1", `[{"mode":"Road","carrier":"RAIL","origin":"Pune","destination":"Delhi"}]`)
+	stub.asParticipant(testMspId, "RAIL").mustFail("not participant ROAD", "planCargoLegs", "CG1", plan)
+	stub.asParticipant(testMspId, "ROAD").mustInvoke("planCargoLegs", "CG1", plan)
+
+	// Planning a leg for RAIL does not commit RAIL to take custody; RAIL has to accept it itself.
+	stub.asParticipant(testMspId, "ROAD").mustFail("Leg 2 has not been accepted by its carrier RAIL", "startCargoLeg", "CG1", "ROAD")
+	stub.asParticipant(testMspId, "ROAD").mustFail("not participant RAIL", "acceptCargoLeg", "CG1", "RAIL")
+	stub.asParticipant(testMspId, "ROAD").mustFail("no planned leg awaiting acceptance by ROAD", "acceptCargoLeg", "CG1", "ROAD")
+	stub.asParticipant(testMspId, "RAIL").mustInvoke("acceptCargoLeg", "CG1", "RAIL")
+
+	stub.asParticipant(testMspId, "RAIL").mustFail("not participant ROAD", "startCargoLeg", "CG1", "ROAD")
+	stub.asParticipant(testMspId, "ROAD").mustInvoke("startCargoLeg", "CG1", "ROAD")
+	stub.asParticipant(testMspId, "RAIL").mustFail("not participant ROAD", "completeCargoLeg", "CG1", "ROAD", `{"C1":"S1"}`)
+	stub.asParticipant(testMspId, "ROAD").mustFail("The seal number must be reported at handover", "completeCargoLeg", "CG1", "ROAD")
+	stub.asParticipant(testMspId, "ROAD").mustInvoke("completeCargoLeg", "CG1", "ROAD", `{"C1":"S1"}`)
+
+	var cargo Cargo
+	stub.readTestRecord("CG1", &cargo)
+	if cargo.Owner != "RAIL" || cargo.Status != "In-Transit" || cargo.CargoLocation != "Nhava Sheva" {
+		t.Errorf("after leg 1 the cargo is %s at %s held by %s, want In-Transit at Nhava Sheva held by RAIL", cargo.Status, cargo.CargoLocation, cargo.Owner)
+	}
+
+	stub.asParticipant(testMspId, "ROAD").mustFail("Leg 2 can only be started by its carrier RAIL", "startCargoLeg", "CG1", "ROAD")
+	stub.asParticipant(testMspId, "RAIL").mustInvoke("startCargoLeg", "CG1", "RAIL")
+	stub.asParticipant(testMspId, "RAIL").mustInvoke("completeCargoLeg", "CG1", "RAIL")
+
+	stub.readTestRecord("CG1", &cargo)
+	if cargo.Status != "Arrived" || cargo.CargoLocation != "Delhi" || cargo.currentLeg() != -1 {
+		t.Errorf("after leg 2 the cargo is %s at %s on leg %d, want Arrived at Delhi with every leg completed", cargo.Status, cargo.CargoLocation, cargo.currentLeg()+1)
+	}
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.ContainerLocation != "Delhi" {
+		t.Errorf("container is at %s, want Delhi", container.ContainerLocation)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"container/list"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/common/attrmgr"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	"github.com/hyperledger/fabric/protos/msp"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	testMspId      = "Org1MSP"
+	otherTestMspId = "Org2MSP"
+)
+
+// testStub is a MockStub that carries the identity of the caller and keeps key history, neither of which
+// MockStub does. Unlike a peer, it lets a transaction read its own writes.
+type testStub struct {
+	*shim.MockStub
+	t         *testing.T
+	creator   []byte
+	args      [][]byte
+	transient map[string][]byte
+	history   map[string][]*queryresult.KeyModification
+	now       time.Time
+	txCount   int
+}
+
+func newTestStub(t *testing.T) *testStub {
+	return &testStub{MockStub: shim.NewMockStub("cargo-app", new(SmartContract)), t: t, history: map[string][]*queryresult.KeyModification{}, now: time.Date(2020, 3, 1, 8, 0, 0, 0, time.UTC)}
+}
+
+// as makes the following transactions come from an identity of mspId whose certificate carries attrs.
+func (stub *testStub) as(mspId string, attrs map[string]string) *testStub {
+	stub.t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		stub.t.Fatal(err)
+	}
+	names := []string{mspId}
+	for name, value := range attrs {
+		names = append(names, name+"="+value)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: strings.Join(names, ",")}, NotBefore: stub.now.Add(-time.Hour), NotAfter: stub.now.Add(24 * 365 * time.Hour)}
+	if len(attrs) > 0 {
+		attrsAsBytes, _ := json.Marshal(attrmgr.Attributes{Attrs: attrs})
+		template.ExtraExtensions = []pkix.Extension{{Id: attrmgr.AttrOID, Value: attrsAsBytes}}
+	}
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		stub.t.Fatal(err)
+	}
+
+	stub.creator, err = proto.Marshal(&msp.SerializedIdentity{Mspid: mspId, IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate})})
+	if err != nil {
+		stub.t.Fatal(err)
+	}
+	return stub
+}
+
+// asAdmin makes the following transactions come from an org admin of mspId.
+func (stub *testStub) asAdmin(mspId string) *testStub {
+	return stub.as(mspId, map[string]string{orgAdminAttribute: "true"})
+}
+
+// asParticipant makes the following transactions come from the participant hashId of mspId.
+func (stub *testStub) asParticipant(mspId string, hashId string) *testStub {
+	return stub.as(mspId, map[string]string{participantIdAttribute: hashId})
+}
+
+func (stub *testStub) GetCreator() ([]byte, error) {
+	return stub.creator, nil
+}
+
+func (stub *testStub) GetArgs() [][]byte {
+	return stub.args
+}
+
+func (stub *testStub) GetStringArgs() []string {
+	var args []string
+	for _, arg := range stub.args {
+		args = append(args, string(arg))
+	}
+	return args
+}
+
+func (stub *testStub) GetFunctionAndParameters() (string, []string) {
+	args := stub.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+func (stub *testStub) GetTransient() (map[string][]byte, error) {
+	return stub.transient, nil
+}
+
+// GetStateByRange follows a peer rather than MockStub: composite keys are left out of the range, and an empty
+// endKey leaves it open after startKey.
+func (stub *testStub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = "\x01"
+	}
+	if endKey == "" {
+		endKey = string(utf8.MaxRune)
+	}
+	return stub.MockStub.GetStateByRange(startKey, endKey)
+}
+
+func (stub *testStub) PutState(key string, value []byte) error {
+	if err := stub.MockStub.PutState(key, value); err != nil {
+		return err
+	}
+	stub.recordHistory(key, value, false)
+	return nil
+}
+
+func (stub *testStub) DelState(key string) error {
+	if err := stub.MockStub.DelState(key); err != nil {
+		return err
+	}
+	stub.recordHistory(key, nil, true)
+	return nil
+}
+
+func (stub *testStub) recordHistory(key string, value []byte, isDelete bool) {
+	timestamp, _ := ptypes.TimestampProto(stub.now)
+	modifications := stub.history[key]
+	// A key keeps only the last value a transaction writes to it.
+	if n := len(modifications); n > 0 && modifications[n-1].TxId == stub.TxID {
+		modifications = modifications[:n-1]
+	}
+	stub.history[key] = append(modifications, &queryresult.KeyModification{TxId: stub.TxID, Value: value, Timestamp: timestamp, IsDelete: isDelete})
+}
+
+func (stub *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	modifications := list.New()
+	for _, modification := range stub.history[key] {
+		modifications.PushBack(modification)
+	}
+	return &testHistoryIterator{next: modifications.Front()}, nil
+}
+
+type testHistoryIterator struct {
+	next *list.Element
+}
+
+func (iterator *testHistoryIterator) HasNext() bool {
+	return iterator.next != nil
+}
+
+func (iterator *testHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	modification := iterator.next.Value.(*queryresult.KeyModification)
+	iterator.next = iterator.next.Next()
+	return modification, nil
+}
+
+func (iterator *testHistoryIterator) Close() error {
+	return nil
+}
+
+// testSnapshot is the state, private data, key history and endorsement policies before a transaction.
+type testSnapshot struct {
+	state    map[string][]byte
+	keys     []string
+	private  map[string]map[string][]byte
+	policies map[string]map[string][]byte
+	history  map[string][]*queryresult.KeyModification
+}
+
+func (stub *testStub) snapshot() testSnapshot {
+	snapshot := testSnapshot{state: map[string][]byte{}, private: map[string]map[string][]byte{}, policies: map[string]map[string][]byte{}, history: map[string][]*queryresult.KeyModification{}}
+	for key, value := range stub.State {
+		snapshot.state[key] = value
+	}
+	for element := stub.Keys.Front(); element != nil; element = element.Next() {
+		snapshot.keys = append(snapshot.keys, element.Value.(string))
+	}
+	for collection, values := range stub.PvtState {
+		snapshot.private[collection] = map[string][]byte{}
+		for key, value := range values {
+			snapshot.private[collection][key] = value
+		}
+	}
+	for key, policies := range stub.EndorsementPolicies {
+		snapshot.policies[key] = map[string][]byte{}
+		for name, policy := range policies {
+			snapshot.policies[key][name] = policy
+		}
+	}
+	for key, modifications := range stub.history {
+		snapshot.history[key] = append([]*queryresult.KeyModification{}, modifications...)
+	}
+	return snapshot
+}
+
+func (stub *testStub) restore(snapshot testSnapshot) {
+	stub.State = snapshot.state
+	stub.Keys = list.New()
+	for _, key := range snapshot.keys {
+		stub.Keys.PushBack(key)
+	}
+	stub.PvtState = snapshot.private
+	stub.EndorsementPolicies = snapshot.policies
+	stub.history = snapshot.history
+}
+
+// transaction runs apply as one transaction at the stub's current time, then moves the clock on a minute.
+func (stub *testStub) transaction(function string, args []string, apply func() sc.Response) sc.Response {
+	stub.txCount++
+	txId := "tx" + strconv.Itoa(stub.txCount)
+
+	stub.args = [][]byte{[]byte(function)}
+	for _, arg := range args {
+		stub.args = append(stub.args, []byte(arg))
+	}
+	snapshot := stub.snapshot()
+	stub.MockTransactionStart(txId)
+	stub.TxTimestamp, _ = ptypes.TimestampProto(stub.now)
+	response := apply()
+	stub.MockTransactionEnd(txId)
+	if response.Status != shim.OK {
+		// A failed transaction is never committed, so none of its writes remain.
+		stub.restore(snapshot)
+	}
+
+	stub.now = stub.now.Add(time.Minute)
+	return response
+}
+
+func (stub *testStub) init(function string, args ...string) sc.Response {
+	return stub.transaction(function, args, func() sc.Response { return new(SmartContract).Init(stub) })
+}
+
+func (stub *testStub) invoke(function string, args ...string) sc.Response {
+	return stub.transaction(function, args, func() sc.Response { return new(SmartContract).Invoke(stub) })
+}
+
+// run runs a helper that takes the stub as one transaction, for checks below the Invoke level.
+func (stub *testStub) run(apply func() error) error {
+	var err error
+	stub.transaction("", nil, func() sc.Response {
+		err = apply()
+		return shim.Success(nil)
+	})
+	return err
+}
+
+// mustInvoke invokes function and fails the test unless it succeeds.
+func (stub *testStub) mustInvoke(function string, args ...string) []byte {
+	stub.t.Helper()
+	response := stub.invoke(function, args...)
+	if response.Status != shim.OK {
+		stub.t.Fatalf("%s(%s) failed: %s", function, strings.Join(args, ", "), response.Message)
+	}
+	return response.Payload
+}
+
+// mustFail invokes function and fails the test unless it is refused with a message containing reason.
+func (stub *testStub) mustFail(reason string, function string, args ...string) {
+	stub.t.Helper()
+	response := stub.invoke(function, args...)
+	if response.Status == shim.OK {
+		stub.t.Fatalf("%s(%s) succeeded, expected %q", function, strings.Join(args, ", "), reason)
+	} else if !strings.Contains(response.Message, reason) {
+		stub.t.Fatalf("%s(%s) failed with %q, expected %q", function, strings.Join(args, ", "), response.Message, reason)
+	}
+}
+
+// registerTestParticipant registers a participant of mspId through registerParticipant, as an admin of mspId.
+func (stub *testStub) registerTestParticipant(mspId string, hashId string, role string) {
+	stub.t.Helper()
+	stub.asAdmin(mspId).mustInvoke("registerParticipant", hashId, hashId+" Ltd", strings.ToLower(hashId)+"@example.com", role)
+}
+
+// readTestRecord reads a record under a plain key straight from state.
+func (stub *testStub) readTestRecord(key string, record interface{}) {
+	stub.t.Helper()
+	valueAsBytes := stub.State[key]
+	if valueAsBytes == nil {
+		stub.t.Fatalf("%s does not exist", key)
+	}
+	if err := json.Unmarshal(valueAsBytes, record); err != nil {
+		stub.t.Fatal(err)
+	}
+}
+
+// seedTestRecord writes a record straight to state, indexed under its owner's organisation, for tests that need
+// a Container or Cargo in a given state without walking it through its lifecycle.
+func (stub *testStub) seedTestRecord(objectType string, hashId string, owner string, record interface{}) {
+	stub.t.Helper()
+	err := stub.run(func() error {
+		if err := putObject(stub, hashId, record); err != nil {
+			return err
+		}
+		_, err := updateHolding(stub, objectType, hashId, "", owner)
+		return err
+	})
+	if err != nil {
+		stub.t.Fatal(err)
+	}
+}
@@ -0,0 +1,394 @@
+/*
+ * Organisations:
+ * The shipping lines, forwarders, suppliers and authorities that participants work for.
+ * Participants belong to one Organisation, and custody of every Container and Cargo is
+ * tracked at organisation level (ownerOrganisation) whether the Owner is a participant or
+ * the organisation itself, so holdings can be listed per organisation.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	organisationObjectType = "Organisation"
+	holdingIndex           = "organisation~type~hashId"
+)
+
+// Organisation is a company taking part in the supply chain, identified on the channel by its MSP ID.
+type Organisation struct {
+	OrganisationId      string            `json:"organisationId"`
+	LegalName           string            `json:"legalName"`
+	MspId               string            `json:"mspId"`
+	Country             string            `json:"country"`
+	Roles               []string          `json:"roles"`
+	RegistrationNumbers map[string]string `json:"registrationNumbers"`
+	SchemaVersion       int               `json:"schemaVersion"`
+}
+
+func readOrganisation(APIstub shim.ChaincodeStubInterface, organisationId string) (Organisation, string, error) {
+	organisation := Organisation{}
+
+	organisationKey, err := APIstub.CreateCompositeKey(organisationObjectType, []string{organisationId})
+	if err != nil {
+		return organisation, "", err
+	}
+	organisationAsBytes, err := APIstub.GetState(organisationKey)
+	if err != nil {
+		return organisation, organisationKey, err
+	} else if organisationAsBytes == nil {
+		return organisation, organisationKey, nil
+	}
+
+	err = unmarshalRecord(organisationObjectType, organisationAsBytes, &organisation)
+	return organisation, organisationKey, err
+}
+
+// resolveOwner returns the organisation and MSP ID behind an Owner, which may be an Organisation or a Participant.
+// Both are empty if the owner is neither.
+func resolveOwner(APIstub shim.ChaincodeStubInterface, owner string) (string, string) {
+	if organisation, _, err := readOrganisation(APIstub, owner); err == nil && organisation.OrganisationId != "" {
+		return organisation.OrganisationId, organisation.MspId
+	}
+	if participant, err := readParticipant(APIstub, owner); err == nil {
+		return participant.OrganisationId, participant.MspId
+	}
+	return "", ""
+}
+
+// ownerMspId returns the MSP ID of the organisation responsible for an Owner, or "" if it is unknown.
+func ownerMspId(APIstub shim.ChaincodeStubInterface, owner string) string {
+	_, mspId := resolveOwner(APIstub, owner)
+	return mspId
+}
+
+// updateHolding re-indexes a Container or Cargo under the organisation behind its new owner and returns that organisation.
+func updateHolding(APIstub shim.ChaincodeStubInterface, objectType string, hashId string, oldOrganisationId string, owner string) (string, error) {
+	newOrganisationId, _ := resolveOwner(APIstub, owner)
+	return newOrganisationId, moveHolding(APIstub, objectType, hashId, oldOrganisationId, newOrganisationId)
+}
+
+// moveHolding moves a record from one organisation to another in the organisation index.
+func moveHolding(APIstub shim.ChaincodeStubInterface, objectType string, hashId string, oldOrganisationId string, newOrganisationId string) error {
+	if newOrganisationId == oldOrganisationId {
+		return nil
+	}
+
+	if oldOrganisationId != "" {
+		oldKey, err := APIstub.CreateCompositeKey(holdingIndex, []string{oldOrganisationId, objectType, hashId})
+		if err != nil {
+			return err
+		}
+		if err := APIstub.DelState(oldKey); err != nil {
+			return err
+		}
+	}
+	if newOrganisationId != "" {
+		newKey, err := APIstub.CreateCompositeKey(holdingIndex, []string{newOrganisationId, objectType, hashId})
+		if err != nil {
+			return err
+		}
+		// Only the key is needed, but CouchDB cannot store a nil value.
+		if err := APIstub.PutState(newKey, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// registerOrganisation - args: organisationId, legalName, mspId, country, roles (comma separated), registrationNumbers (JSON object)
+func (s *SmartContract) registerOrganisation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting 6")
+	}
+
+	organisation, organisationKey, err := readOrganisation(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get organisation: " + err.Error())
+	} else if organisation.OrganisationId != "" {
+		return shim.Error("This Organisation already exists. OrganisationId: " + args[0])
+	}
+
+	if err := assertOrgAdmin(APIstub, args[2]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	registrationNumbers := map[string]string{}
+	if args[5] != "" {
+		if err := json.Unmarshal([]byte(args[5]), &registrationNumbers); err != nil {
+			return shim.Error("Failed to decode registrationNumbers: " + err.Error())
+		}
+	}
+
+	organisation = Organisation{OrganisationId: args[0], LegalName: args[1], MspId: args[2], Country: args[3], Roles: strings.Split(args[4], ","), RegistrationNumbers: registrationNumbers}
+
+	if err := putObject(APIstub, organisationKey, organisation); err != nil {
+		return shim.Error("Failed to record organisation: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, organisationKey, args[2]); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+func (s *SmartContract) getOrganisation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	organisation, _, err := readOrganisation(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get organisation: " + err.Error())
+	} else if organisation.OrganisationId == "" {
+		return shim.Error("Organisation does not exist. OrganisationId: " + args[0])
+	}
+
+	organisationAsBytes, _ := json.Marshal(organisation)
+	return shim.Success(organisationAsBytes)
+}
+
+// setParticipantOrganisation - args: hashId, organisationId. Moves a participant into an organisation of the same MSP,
+// together with the Containers and Cargos it holds.
+func (s *SmartContract) setParticipantOrganisation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	participant, err := readParticipant(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	organisation, _, err := readOrganisation(APIstub, args[1])
+	if err != nil {
+		return shim.Error("Failed to get organisation: " + err.Error())
+	} else if organisation.OrganisationId == "" {
+		return shim.Error("Organisation does not exist. OrganisationId: " + args[1])
+	} else if organisation.MspId != participant.MspId {
+		return shim.Error("Participant and Organisation belong to different MSPs")
+	} else if !contains(organisation.Roles, participant.Role) {
+		return shim.Error("Organisation " + args[1] + " does not play the role " + participant.Role)
+	}
+
+	if err := assertOrgAdmin(APIstub, participant.MspId); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := moveHolding(APIstub, "Participant", args[0], participant.OrganisationId, args[1]); err != nil {
+		return shim.Error("Failed to update organisation index: " + err.Error())
+	}
+	if err := moveParticipantHoldings(APIstub, args[0], participant.OrganisationId, args[1]); err != nil {
+		return shim.Error("Failed to move participant holdings: " + err.Error())
+	}
+	participant.OrganisationId = args[1]
+
+	if err := putObject(APIstub, args[0], participant); err != nil {
+		return shim.Error("Failed to update participant: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// moveParticipantHoldings re-indexes the Containers and Cargos a participant owns from its old organisation to its new
+// one and updates their ownerOrganisation.
+func moveParticipantHoldings(APIstub shim.ChaincodeStubInterface, owner string, oldOrganisationId string, newOrganisationId string) error {
+	for _, objectType := range []string{"Container", "Cargo"} {
+		hashIds, err := participantHoldings(APIstub, owner, oldOrganisationId, objectType)
+		if err != nil {
+			return err
+		}
+		for _, hashId := range hashIds {
+			if err := moveHolding(APIstub, objectType, hashId, oldOrganisationId, newOrganisationId); err != nil {
+				return err
+			}
+			if objectType == "Container" {
+				container, err := readContainer(APIstub, hashId)
+				if err != nil {
+					return err
+				}
+				container.OwnerOrganisation = newOrganisationId
+				err = putObject(APIstub, hashId, container)
+			} else {
+				cargo, err := readCargo(APIstub, hashId)
+				if err != nil {
+					return err
+				}
+				cargo.OwnerOrganisation = newOrganisationId
+				err = putObject(APIstub, hashId, cargo)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// participantHoldings returns the HashIds of the records of objectType that owner holds. Holdings are indexed under
+// the owner's organisation; the holdings of a participant without one are not indexed, so all records are scanned.
+func participantHoldings(APIstub shim.ChaincodeStubInterface, owner string, organisationId string, objectType string) ([]string, error) {
+	var hashIds []string
+
+	if organisationId != "" {
+		indexed, err := getHoldings(APIstub, organisationId, objectType)
+		if err != nil {
+			return nil, err
+		}
+		for _, hashId := range indexed {
+			holderAsBytes, err := APIstub.GetState(hashId)
+			if err != nil {
+				return nil, err
+			}
+			var holder struct {
+				Owner string `json:"owner"`
+			}
+			json.Unmarshal(holderAsBytes, &holder)
+			if holder.Owner == owner {
+				hashIds = append(hashIds, hashId)
+			}
+		}
+		return hashIds, nil
+	}
+
+	recordsIterator, err := APIstub.GetStateByRange("", "")
+	if err != nil {
+		return nil, err
+	}
+	defer recordsIterator.Close()
+
+	for recordsIterator.HasNext() {
+		record, err := recordsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if plainRecordType(record.Value) != objectType {
+			continue
+		}
+		var holder struct {
+			Owner string `json:"owner"`
+		}
+		json.Unmarshal(record.Value, &holder)
+		if holder.Owner == owner {
+			hashIds = append(hashIds, record.Key)
+		}
+	}
+	return hashIds, nil
+}
+
+// getContainersByOrganisation - args: organisationId. Returns the Containers the organisation currently holds.
+func (s *SmartContract) getContainersByOrganisation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type OrganisationContainers struct {
+		Containers []Container `json:"containers"`
+	}
+	var organisationContainers OrganisationContainers
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	hashIds, err := getHoldings(APIstub, args[0], "Container")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, hashId := range hashIds {
+		container, err := readContainer(APIstub, hashId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		organisationContainers.Containers = append(organisationContainers.Containers, container)
+	}
+
+	organisationContainersAsBytes, _ := json.Marshal(organisationContainers)
+	return shim.Success(organisationContainersAsBytes)
+}
+
+// getCargosByOrganisation - args: organisationId. Returns the Cargos the organisation currently holds.
+func (s *SmartContract) getCargosByOrganisation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type OrganisationCargos struct {
+		Cargos []Cargo `json:"cargos"`
+	}
+	var organisationCargos OrganisationCargos
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	hashIds, err := getHoldings(APIstub, args[0], "Cargo")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, hashId := range hashIds {
+		cargo, err := readCargo(APIstub, hashId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		organisationCargos.Cargos = append(organisationCargos.Cargos, cargo)
+	}
+
+	organisationCargosAsBytes, _ := json.Marshal(organisationCargos)
+	return shim.Success(organisationCargosAsBytes)
+}
+
+// getParticipantsByOrganisation - args: organisationId
+func (s *SmartContract) getParticipantsByOrganisation(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type OrganisationParticipants struct {
+		Participants []Participant `json:"participants"`
+	}
+	var organisationParticipants OrganisationParticipants
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	hashIds, err := getHoldings(APIstub, args[0], "Participant")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, hashId := range hashIds {
+		participant, err := readParticipant(APIstub, hashId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		organisationParticipants.Participants = append(organisationParticipants.Participants, participant)
+	}
+
+	organisationParticipantsAsBytes, _ := json.Marshal(organisationParticipants)
+	return shim.Success(organisationParticipantsAsBytes)
+}
+
+// getHoldings returns the HashIds of the records of objectType indexed under an organisation.
+func getHoldings(APIstub shim.ChaincodeStubInterface, organisationId string, objectType string) ([]string, error) {
+	var hashIds []string
+
+	holdingsIterator, err := APIstub.GetStateByPartialCompositeKey(holdingIndex, []string{organisationId, objectType})
+	if err != nil {
+		return nil, err
+	}
+	defer holdingsIterator.Close()
+
+	for holdingsIterator.HasNext() {
+		holding, err := holdingsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		_, keyParts, err := APIstub.SplitCompositeKey(holding.Key)
+		if err != nil {
+			return nil, err
+		}
+		hashIds = append(hashIds, keyParts[2])
+	}
+	return hashIds, nil
+}
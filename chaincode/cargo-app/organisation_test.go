@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSetParticipantOrganisationMovesHoldings(t *testing.T) {
+	tests := []struct {
+		name            string
+		oldOrganisation string
+	}{
+		{"from another organisation", "ORG-A"},
+		{"from no organisation", ""},
+	}
+	for _, test := range tests {
+		stub := newTestStub(t)
+		for _, organisationId := range []string{"ORG-A", "ORG-B"} {
+			stub.asAdmin(testMspId).mustInvoke("registerOrganisation", organisationId, organisationId+" Lines", testMspId, "NL", "Transporter", "")
+		}
+		if test.oldOrganisation == "" {
+			stub.registerTestParticipant(testMspId, "MOVER", "Transporter")
+		} else {
+			stub.asAdmin(testMspId).mustInvoke("registerParticipant", "MOVER", "Mover Ltd", "mover@example.com", "Transporter", test.oldOrganisation)
+		}
+		stub.registerTestParticipant(testMspId, "STAYER", "Transporter")
+		stub.asAdmin(testMspId).mustInvoke("setParticipantOrganisation", "STAYER", "ORG-A")
+
+		stub.seedTestRecord("Container", "C1", "MOVER", Container{HashId: "C1", Owner: "MOVER", OwnerOrganisation: test.oldOrganisation, Status: "Available"})
+		stub.seedTestRecord("Cargo", "CG1", "MOVER", Cargo{HashId: "CG1", Owner: "MOVER", OwnerOrganisation: test.oldOrganisation, Status: "Ready", AssociatedContainerHashIds: []string{}})
+		stub.seedTestRecord("Container", "C2", "STAYER", Container{HashId: "C2", Owner: "STAYER", OwnerOrganisation: "ORG-A", Status: "Available"})
+
+		stub.asAdmin(testMspId).mustInvoke("setParticipantOrganisation", "MOVER", "ORG-B")
+
+		holdings := map[string][]string{}
+		for _, organisationId := range []string{"ORG-A", "ORG-B"} {
+			var containers struct {
+				Containers []Container `json:"containers"`
+			}
+			var cargos struct {
+				Cargos []Cargo `json:"cargos"`
+			}
+			json.Unmarshal(stub.mustInvoke("getContainersByOrganisation", organisationId), &containers)
+			json.Unmarshal(stub.mustInvoke("getCargosByOrganisation", organisationId), &cargos)
+			for _, container := range containers.Containers {
+				holdings[organisationId] = append(holdings[organisationId], container.HashId)
+				if container.OwnerOrganisation != organisationId {
+					t.Errorf("%s: container %s has ownerOrganisation %q, indexed under %s", test.name, container.HashId, container.OwnerOrganisation, organisationId)
+				}
+			}
+			for _, cargo := range cargos.Cargos {
+				holdings[organisationId] = append(holdings[organisationId], cargo.HashId)
+				if cargo.OwnerOrganisation != organisationId {
+					t.Errorf("%s: cargo %s has ownerOrganisation %q, indexed under %s", test.name, cargo.HashId, cargo.OwnerOrganisation, organisationId)
+				}
+			}
+		}
+		if len(holdings["ORG-A"]) != 1 || holdings["ORG-A"][0] != "C2" {
+			t.Errorf("%s: ORG-A holds %v, want [C2]", test.name, holdings["ORG-A"])
+		}
+		if len(holdings["ORG-B"]) != 2 {
+			t.Errorf("%s: ORG-B holds %v, want [C1 CG1]", test.name, holdings["ORG-B"])
+		}
+	}
+}
+
+func TestUpdateParticipantRoleStaysWithinOrganisation(t *testing.T) {
+	stub := newTestStub(t)
+	stub.asAdmin(testMspId).mustInvoke("registerOrganisation", "LINE", "Line Shipping", testMspId, "SG", "Exporter,Transporter", "")
+	stub.asAdmin(testMspId).mustInvoke("registerParticipant", "P1", "Planner", "p1@example.com", "Transporter", "LINE")
+
+	stub.mustFail("Organisation LINE does not play the role Customs Officer", "updateParticipant", "P1", "Planner", "p1@example.com", "Customs Officer")
+	stub.mustInvoke("updateParticipant", "P1", "Planner", "p1@example.com", "Exporter")
+
+	var participant Participant
+	stub.readTestRecord("P1", &participant)
+	if participant.Role != "Exporter" {
+		t.Errorf("P1 plays %s, want Exporter", participant.Role)
+	}
+}
@@ -0,0 +1,340 @@
+/*
+ * Participant lifecycle:
+ * Org admins can update, suspend and reinstate the participants of their own organisation.
+ * Every role change is kept in an effective-dated role history, so the role a participant
+ * held at the time of any action can be looked up later.
+ * Participant States --> Active, Suspended.
+ * An org admin is an identity of the participant's organisation whose certificate carries the attribute admin=true,
+ * or that is listed as an admin of the organisation in the ledger configuration.
+ * Every other caller must carry the attribute participantId naming an active participant of its own organisation;
+ * registerUser.js issues it. Callers with neither are refused.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	participantActiveStatus    = "Active"
+	participantSuspendedStatus = "Suspended"
+	participantIdAttribute     = "participantId"
+	orgAdminAttribute          = "admin"
+)
+
+// RoleAssignment is one entry of a participant's role history. EffectiveTo is empty for the current role.
+type RoleAssignment struct {
+	Role          string `json:"role"`
+	EffectiveFrom string `json:"effectiveFrom"`
+	EffectiveTo   string `json:"effectiveTo"`
+	AssignedBy    string `json:"assignedBy"`
+}
+
+// isSuspended treats participants registered before the lifecycle existed (no status) as active.
+func (participant Participant) isSuspended() bool {
+	return participant.Status == participantSuspendedStatus
+}
+
+// roleAt returns the role the participant held at the given time.
+func (participant Participant) roleAt(at time.Time) (string, error) {
+	for _, assignment := range participant.RoleHistory {
+		from, err := time.Parse(time.RFC3339, assignment.EffectiveFrom)
+		if err != nil || at.Before(from) {
+			continue
+		}
+		if assignment.EffectiveTo != "" {
+			to, err := time.Parse(time.RFC3339, assignment.EffectiveTo)
+			if err == nil && !at.Before(to) {
+				continue
+			}
+		}
+		return assignment.Role, nil
+	}
+
+	// Participants without a role history have held their role throughout.
+	if len(participant.RoleHistory) == 0 {
+		return participant.Role, nil
+	}
+	return "", fmt.Errorf("Participant %s had no role at %s", participant.HashId, at.Format(time.RFC3339))
+}
+
+// assertOrgAdmin checks that the caller is an admin of the organisation mspId.
+func assertOrgAdmin(APIstub shim.ChaincodeStubInterface, mspId string) error {
+	callerMspId, err := callerOrg(APIstub)
+	if err != nil {
+		return fmt.Errorf("Failed to get caller organisation: %s", err.Error())
+	} else if callerMspId != mspId {
+		return fmt.Errorf("Caller is not a member of organisation %s", mspId)
+	}
+	if err := cid.AssertAttributeValue(APIstub, orgAdminAttribute, "true"); err != nil {
+		// Admins named in the ledger configuration need no admin attribute.
+		if callerIsConfiguredAdmin(APIstub, mspId) {
+			return nil
+		}
+		return fmt.Errorf("Caller is not an org admin: %s", err.Error())
+	}
+	return nil
+}
+
+// assertNotSuspended rejects the transaction if any of the named participants is suspended.
+// Owners that are not registered participants, such as Organisations, are left alone.
+func assertNotSuspended(APIstub shim.ChaincodeStubInterface, hashIds ...string) error {
+	for _, hashId := range hashIds {
+		participantAsBytes, err := APIstub.GetState(hashId)
+		if err != nil {
+			return fmt.Errorf("Failed to get participant: %s", err.Error())
+		} else if participantAsBytes == nil || plainRecordType(participantAsBytes) != "Participant" {
+			continue
+		}
+		participant := Participant{}
+		if err := unmarshalRecord("Participant", participantAsBytes, &participant); err != nil {
+			return fmt.Errorf("Failed to decode participant %s: %s", hashId, err.Error())
+		}
+		if participant.isSuspended() {
+			return fmt.Errorf("Participant %s is suspended", hashId)
+		}
+	}
+	return nil
+}
+
+// callerParticipant returns the participant named by the caller's participantId attribute. The participant
+// must belong to the caller's organisation.
+func callerParticipant(APIstub shim.ChaincodeStubInterface) (Participant, error) {
+	participantId, found, err := cid.GetAttributeValue(APIstub, participantIdAttribute)
+	if err != nil {
+		return Participant{}, fmt.Errorf("Failed to get caller identity: %s", err.Error())
+	} else if !found || participantId == "" {
+		return Participant{}, fmt.Errorf("Caller's certificate does not name a participant (attribute %s)", participantIdAttribute)
+	}
+
+	participant, err := readParticipant(APIstub, participantId)
+	if err != nil {
+		return participant, err
+	}
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return participant, fmt.Errorf("Failed to get caller organisation: %s", err.Error())
+	} else if participant.MspId != mspId {
+		return participant, fmt.Errorf("Participant %s does not belong to %s", participantId, mspId)
+	}
+	return participant, nil
+}
+
+// assertCallerNotSuspended rejects the transaction unless the caller's certificate identifies an active participant.
+// Org admins without a participantId attribute act for their organisation.
+func assertCallerNotSuspended(APIstub shim.ChaincodeStubInterface) error {
+	_, found, err := cid.GetAttributeValue(APIstub, participantIdAttribute)
+	if err != nil {
+		return fmt.Errorf("Failed to get caller identity: %s", err.Error())
+	} else if !found {
+		mspId, err := callerOrg(APIstub)
+		if err != nil {
+			return fmt.Errorf("Failed to get caller organisation: %s", err.Error())
+		}
+		if assertOrgAdmin(APIstub, mspId) == nil {
+			return nil
+		}
+	}
+
+	participant, err := callerParticipant(APIstub)
+	if err != nil {
+		return err
+	} else if participant.isSuspended() {
+		return fmt.Errorf("Participant %s is suspended", participant.HashId)
+	}
+	return nil
+}
+
+// assertCallerActsFor checks that the caller may act for owner: the participant itself, or, for an Organisation,
+// one of its participants or an admin of its MSP.
+func assertCallerActsFor(APIstub shim.ChaincodeStubInterface, owner string) error {
+	organisation, _, err := readOrganisation(APIstub, owner)
+	if err != nil {
+		return fmt.Errorf("Failed to get organisation: %s", err.Error())
+	}
+	if organisation.OrganisationId != "" {
+		if participant, err := callerParticipant(APIstub); err == nil && participant.OrganisationId == owner {
+			return nil
+		}
+		if assertOrgAdmin(APIstub, organisation.MspId) == nil {
+			return nil
+		}
+		return fmt.Errorf("Caller does not act for organisation %s", owner)
+	}
+
+	participant, err := callerParticipant(APIstub)
+	if err != nil {
+		return err
+	} else if participant.HashId != owner {
+		return fmt.Errorf("Caller is not participant %s", owner)
+	}
+	return nil
+}
+
+// assertCallerActsForAny checks that the caller may act for at least one of owners. Empty owners are skipped.
+func assertCallerActsForAny(APIstub shim.ChaincodeStubInterface, owners ...string) error {
+	var named []string
+	for _, owner := range owners {
+		if owner == "" {
+			continue
+		}
+		if assertCallerActsFor(APIstub, owner) == nil {
+			return nil
+		}
+		named = append(named, owner)
+	}
+	return fmt.Errorf("Caller does not act for any of %s", strings.Join(named, ", "))
+}
+
+// updateParticipant - args: hashId, name, emailId, role. A role change takes effect from the transaction time, and the
+// participant's organisation, if it has one, must play the new role.
+func (s *SmartContract) updateParticipant(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	participant, err := readParticipant(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertOrgAdmin(APIstub, participant.MspId); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+
+	if args[3] != participant.Role {
+		// As on registration, the participant's organisation must play the new role.
+		if participant.OrganisationId != "" {
+			organisation, _, err := readOrganisation(APIstub, participant.OrganisationId)
+			if err != nil {
+				return shim.Error("Failed to get organisation: " + err.Error())
+			} else if !contains(organisation.Roles, args[3]) {
+				return shim.Error("Organisation " + participant.OrganisationId + " does not play the role " + args[3])
+			}
+		}
+		adminId, _ := cid.GetID(APIstub)
+		participant.RoleHistory = changeRole(participant, args[3], now, adminId)
+		participant.Role = args[3]
+	}
+	participant.Name = args[1]
+	participant.EmailId = args[2]
+
+	if err := putObject(APIstub, args[0], participant); err != nil {
+		return shim.Error("Failed to update participant: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// suspendParticipant - args: hashId, reason
+func (s *SmartContract) suspendParticipant(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	participant, err := readParticipant(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if participant.isSuspended() {
+		return shim.Error("Participant is already suspended")
+	}
+	if err := assertOrgAdmin(APIstub, participant.MspId); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	participant.Status = participantSuspendedStatus
+	participant.SuspendedReason = args[1]
+
+	if err := putObject(APIstub, args[0], participant); err != nil {
+		return shim.Error("Failed to suspend participant: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// reinstateParticipant - args: hashId
+func (s *SmartContract) reinstateParticipant(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	participant, err := readParticipant(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if !participant.isSuspended() {
+		return shim.Error("Participant is not suspended")
+	}
+	if err := assertOrgAdmin(APIstub, participant.MspId); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	participant.Status = participantActiveStatus
+	participant.SuspendedReason = ""
+
+	if err := putObject(APIstub, args[0], participant); err != nil {
+		return shim.Error("Failed to reinstate participant: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getParticipantRoleAt - args: hashId, timestamp (RFC3339). Returns the role the participant held at that time.
+func (s *SmartContract) getParticipantRoleAt(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type ParticipantRole struct {
+		HashId string `json:"hashId"`
+		At     string `json:"at"`
+		Role   string `json:"role"`
+	}
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	at, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("Timestamp must be in RFC3339 format: " + err.Error())
+	}
+
+	participant, err := readParticipant(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	role, err := participant.roleAt(at)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	participantRoleAsBytes, _ := json.Marshal(ParticipantRole{HashId: args[0], At: args[1], Role: role})
+	return shim.Success(participantRoleAsBytes)
+}
+
+// changeRole closes the current role assignment and opens a new one from the given time.
+func changeRole(participant Participant, role string, from time.Time, assignedBy string) []RoleAssignment {
+	effective := from.UTC().Format(time.RFC3339)
+
+	history := participant.RoleHistory
+	if len(history) == 0 {
+		// Participants registered before role history was kept held their role until now.
+		history = []RoleAssignment{{Role: participant.Role, EffectiveFrom: time.Time{}.Format(time.RFC3339)}}
+	}
+	history[len(history)-1].EffectiveTo = effective
+
+	return append(history, RoleAssignment{Role: role, EffectiveFrom: effective, AssignedBy: assignedBy})
+}
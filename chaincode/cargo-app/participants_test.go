@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRoleAt(t *testing.T) {
+	participant := Participant{HashId: "P1", Role: "Importer", RoleHistory: []RoleAssignment{
+		{Role: "Exporter", EffectiveFrom: "2020-01-01T00:00:00Z", EffectiveTo: "2020-02-01T00:00:00Z"},
+		{Role: "Importer", EffectiveFrom: "2020-02-01T00:00:00Z"},
+	}}
+
+	tests := []struct {
+		at      string
+		role    string
+		wantErr bool
+	}{
+		{"2019-12-31T23:59:59Z", "", true},
+		{"2020-01-01T00:00:00Z", "Exporter", false},
+		{"2020-01-31T23:59:59Z", "Exporter", false},
+		{"2020-02-01T00:00:00Z", "Importer", false},
+		{"2021-06-01T00:00:00Z", "Importer", false},
+	}
+	for _, test := range tests {
+		at, _ := time.Parse(time.RFC3339, test.at)
+		role, err := participant.roleAt(at)
+		if (err != nil) != test.wantErr || role != test.role {
+			t.Errorf("roleAt(%s) = %q, %v; want %q", test.at, role, err, test.role)
+		}
+	}
+
+	// Participants without a role history have always held their role.
+	legacy := Participant{HashId: "P2", Role: "Transporter"}
+	if role, err := legacy.roleAt(time.Time{}); err != nil || role != "Transporter" {
+		t.Errorf("roleAt without history = %q, %v", role, err)
+	}
+}
+
+func TestAssertCallerNotSuspended(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "ACTIVE", "Importer")
+	stub.registerTestParticipant(testMspId, "SUSPENDED", "Importer")
+	stub.registerTestParticipant(otherTestMspId, "FOREIGN", "Importer")
+	stub.asAdmin(testMspId).mustInvoke("suspendParticipant", "SUSPENDED", "Audit")
+
+	tests := []struct {
+		name    string
+		mspId   string
+		attrs   map[string]string
+		wantErr bool
+	}{
+		{"active participant", testMspId, map[string]string{participantIdAttribute: "ACTIVE"}, false},
+		{"suspended participant", testMspId, map[string]string{participantIdAttribute: "SUSPENDED"}, true},
+		{"participant of another organisation", testMspId, map[string]string{participantIdAttribute: "FOREIGN"}, true},
+		{"unregistered participant", testMspId, map[string]string{participantIdAttribute: "NOBODY"}, true},
+		{"no participantId", testMspId, nil, true},
+		{"org admin without participantId", testMspId, map[string]string{orgAdminAttribute: "true"}, false},
+	}
+	for _, test := range tests {
+		stub.as(test.mspId, test.attrs)
+		err := stub.run(func() error { return assertCallerNotSuspended(stub) })
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: assertCallerNotSuspended() = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestAssertNotSuspended(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "ACTIVE", "Importer")
+	stub.registerTestParticipant(testMspId, "SUSPENDED", "Importer")
+	stub.asAdmin(testMspId).mustInvoke("suspendParticipant", "SUSPENDED", "Audit")
+
+	tests := []struct {
+		hashIds []string
+		wantErr bool
+	}{
+		{[]string{"ACTIVE"}, false},
+		{[]string{"ACTIVE", "SUSPENDED"}, true},
+		// Owners that are not participants, such as Organisations, are not checked.
+		{[]string{"SOME-ORG"}, false},
+	}
+	for _, test := range tests {
+		err := stub.run(func() error { return assertNotSuspended(stub, test.hashIds...) })
+		if (err != nil) != test.wantErr {
+			t.Errorf("assertNotSuspended(%v) = %v, wantErr %v", test.hashIds, err, test.wantErr)
+		}
+	}
+}
+
+func TestAssertCallerActsFor(t *testing.T) {
+	stub := newTestStub(t)
+	stub.asAdmin(testMspId).mustInvoke("registerOrganisation", "ORG-1", "Org One", testMspId, "NL", "Transporter", "")
+	stub.registerTestParticipant(testMspId, "MEMBER", "Transporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+	stub.asAdmin(testMspId).mustInvoke("setParticipantOrganisation", "MEMBER", "ORG-1")
+
+	tests := []struct {
+		name    string
+		caller  func()
+		owner   string
+		wantErr bool
+	}{
+		{"participant itself", func() { stub.asParticipant(testMspId, "MEMBER") }, "MEMBER", false},
+		{"another participant", func() { stub.asParticipant(testMspId, "OUTSIDER") }, "MEMBER", true},
+		{"member of the organisation", func() { stub.asParticipant(testMspId, "MEMBER") }, "ORG-1", false},
+		{"participant outside the organisation", func() { stub.asParticipant(testMspId, "OUTSIDER") }, "ORG-1", true},
+		{"admin of the organisation's MSP", func() { stub.asAdmin(testMspId) }, "ORG-1", false},
+		{"admin of another MSP", func() { stub.asAdmin(otherTestMspId) }, "ORG-1", true},
+	}
+	for _, test := range tests {
+		test.caller()
+		err := stub.run(func() error { return assertCallerActsFor(stub, test.owner) })
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: assertCallerActsFor(%s) = %v, wantErr %v", test.name, test.owner, err, test.wantErr)
+		}
+	}
+}
+
+func TestRegisterParticipantRequiresOrgAdmin(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "MEMBER", "Transporter")
+
+	// Arbiters, Customs Officers and IoT Sensors are trusted by other checks, so members cannot mint them.
+	for _, role := range []string{arbiterRole, customsOfficerRole, sensorRole} {
+		stub.asParticipant(testMspId, "MEMBER").mustFail("not an org admin", "registerParticipant", "P1", "P1 Ltd", "p1@example.com", role)
+	}
+	stub.asAdmin(otherTestMspId).mustInvoke("registerParticipant", "P1", "P1 Ltd", "p1@example.com", arbiterRole)
+
+	var participant Participant
+	stub.readTestRecord("P1", &participant)
+	if participant.MspId != otherTestMspId || len(participant.RoleHistory) != 1 || !strings.HasSuffix(participant.RoleHistory[0].EffectiveFrom, "Z") {
+		t.Errorf("participant registered as %s with role history %+v, want %s from a UTC time", participant.MspId, participant.RoleHistory, otherTestMspId)
+	}
+}
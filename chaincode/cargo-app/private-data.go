@@ -0,0 +1,262 @@
+/*
+ * Private data for Cargo and Containers:
+ * Declared values, pricing and consignee contact details are kept in private data
+ * collections (see collections_config.json) and only salted hashes are written to the
+ * public Cargo / Container records, so any disclosed value can be verified on-chain.
+ * Each field has its own salt, so disclosing one field's salt to verify it reveals nothing about the others.
+ * Collections --> collectionCommercialTerms (Cargo, Container), collectionConsigneeDetails (Cargo).
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	commercialTermsCollection  = "collectionCommercialTerms"
+	consigneeDetailsCollection = "collectionConsigneeDetails"
+)
+
+// CommercialTerms are the declared value and pricing of a Cargo or Container.
+type CommercialTerms struct {
+	HashId        string            `json:"hashId"`
+	DeclaredValue string            `json:"declaredValue"`
+	Currency      string            `json:"currency"`
+	FreightPrice  string            `json:"freightPrice"`
+	Salts         map[string]string `json:"salts"`
+	SchemaVersion int               `json:"schemaVersion"`
+}
+
+// ConsigneeDetails are the contact details of the consignee of a Cargo.
+type ConsigneeDetails struct {
+	HashId        string            `json:"hashId"`
+	Name          string            `json:"name"`
+	EmailId       string            `json:"emailId"`
+	Phone         string            `json:"phone"`
+	Address       string            `json:"address"`
+	Salts         map[string]string `json:"salts"`
+	SchemaVersion int               `json:"schemaVersion"`
+}
+
+// hashPrivateValue is the salted hash stored publicly for a single private field.
+func hashPrivateValue(salt string, value string) string {
+	hash := sha256.Sum256([]byte(salt + value))
+	return hex.EncodeToString(hash[:])
+}
+
+// checkSalts requires a salt for each of fields, and no salt to be reused across them.
+func checkSalts(salts map[string]string, fields ...string) error {
+	seen := map[string]string{}
+	for _, field := range fields {
+		salt := salts[field]
+		if salt == "" {
+			return fmt.Errorf("Missing salt for %s", field)
+		} else if other, ok := seen[salt]; ok {
+			return fmt.Errorf("%s and %s share a salt. Expecting a separate salt per field", other, field)
+		}
+		seen[salt] = field
+	}
+	return nil
+}
+
+func mergeHashes(existing map[string]string, hashes map[string]string) map[string]string {
+	if existing == nil {
+		existing = map[string]string{}
+	}
+	for field, hash := range hashes {
+		existing[field] = hash
+	}
+	return existing
+}
+
+func (terms CommercialTerms) hashes() map[string]string {
+	return map[string]string{
+		commercialTermsCollection + ".declaredValue": hashPrivateValue(terms.Salts["declaredValue"], terms.DeclaredValue),
+		commercialTermsCollection + ".currency":      hashPrivateValue(terms.Salts["currency"], terms.Currency),
+		commercialTermsCollection + ".freightPrice":  hashPrivateValue(terms.Salts["freightPrice"], terms.FreightPrice),
+	}
+}
+
+func (details ConsigneeDetails) hashes() map[string]string {
+	return map[string]string{
+		consigneeDetailsCollection + ".name":    hashPrivateValue(details.Salts["name"], details.Name),
+		consigneeDetailsCollection + ".emailId": hashPrivateValue(details.Salts["emailId"], details.EmailId),
+		consigneeDetailsCollection + ".phone":   hashPrivateValue(details.Salts["phone"], details.Phone),
+		consigneeDetailsCollection + ".address": hashPrivateValue(details.Salts["address"], details.Address),
+	}
+}
+
+/*
+ * setPrivateDetails - args: objectType (Cargo/Container), hashId
+ * The private values are passed in the transient map so they never appear in the transaction:
+ * "commercialTerms" -> CommercialTerms JSON, "consigneeDetails" -> ConsigneeDetails JSON (Cargo only).
+ * Each carries "salts", a distinct salt per field, e.g. {"declaredValue": "...", "currency": "...", "freightPrice": "..."}.
+ * The caller must act for the owner of the Cargo or Container.
+ */
+func (s *SmartContract) setPrivateDetails(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	var cargo Cargo
+	var container Container
+	var owner string
+	var err error
+
+	switch args[0] {
+	case "Cargo":
+		cargo, err = readCargo(APIstub, args[1])
+		owner = cargo.Owner
+	case "Container":
+		container, err = readContainer(APIstub, args[1])
+		owner = container.Owner
+	default:
+		return shim.Error("Invalid object type. Expecting Cargo or Container")
+	}
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, owner); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	transientMap, err := APIstub.GetTransient()
+	if err != nil {
+		return shim.Error("Failed to get transient data: " + err.Error())
+	}
+
+	hashes := map[string]string{}
+
+	if termsAsBytes, ok := transientMap["commercialTerms"]; ok {
+		terms := CommercialTerms{}
+		if err := json.Unmarshal(termsAsBytes, &terms); err != nil {
+			return shim.Error("Failed to decode commercialTerms: " + err.Error())
+		} else if err := checkSalts(terms.Salts, "declaredValue", "currency", "freightPrice"); err != nil {
+			return shim.Error("Invalid commercialTerms: " + err.Error())
+		}
+		terms.HashId = args[1]
+
+		if err := putPrivateObject(APIstub, commercialTermsCollection, args[1], terms); err != nil {
+			return shim.Error("Failed to record commercial terms: " + err.Error())
+		}
+		for field, hash := range terms.hashes() {
+			hashes[field] = hash
+		}
+	}
+
+	if detailsAsBytes, ok := transientMap["consigneeDetails"]; ok {
+		if args[0] != "Cargo" {
+			return shim.Error("Consignee details can only be set on a Cargo")
+		}
+
+		details := ConsigneeDetails{}
+		if err := json.Unmarshal(detailsAsBytes, &details); err != nil {
+			return shim.Error("Failed to decode consigneeDetails: " + err.Error())
+		} else if err := checkSalts(details.Salts, "name", "emailId", "phone", "address"); err != nil {
+			return shim.Error("Invalid consigneeDetails: " + err.Error())
+		}
+		details.HashId = args[1]
+
+		if err := putPrivateObject(APIstub, consigneeDetailsCollection, args[1], details); err != nil {
+			return shim.Error("Failed to record consignee details: " + err.Error())
+		}
+		for field, hash := range details.hashes() {
+			hashes[field] = hash
+		}
+	}
+
+	if len(hashes) == 0 {
+		return shim.Error("No private details found in the transient map. Expecting commercialTerms or consigneeDetails")
+	}
+
+	// Only the salted hashes go on the public record.
+	if args[0] == "Cargo" {
+		cargo.PrivateHashes = mergeHashes(cargo.PrivateHashes, hashes)
+		err = putObject(APIstub, args[1], cargo)
+	} else {
+		container.PrivateHashes = mergeHashes(container.PrivateHashes, hashes)
+		err = putObject(APIstub, args[1], container)
+	}
+	if err != nil {
+		return shim.Error("Failed to record private data hashes: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getPrivateDetails - args: collection, hashId. Only members of the collection can read it (memberOnlyRead).
+func (s *SmartContract) getPrivateDetails(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	if args[0] != commercialTermsCollection && args[0] != consigneeDetailsCollection {
+		return shim.Error("Invalid collection. Expecting " + commercialTermsCollection + " or " + consigneeDetailsCollection)
+	}
+
+	detailsAsBytes, err := APIstub.GetPrivateData(args[0], args[1])
+	if err != nil {
+		return shim.Error("Failed to get private details: " + err.Error())
+	} else if detailsAsBytes == nil {
+		return shim.Error("No private details in " + args[0] + " for HashId: " + args[1])
+	}
+
+	return shim.Success(detailsAsBytes)
+}
+
+// verifyPrivateValue - args: hashId, field (e.g. collectionCommercialTerms.declaredValue), value, salt of that field
+func (s *SmartContract) verifyPrivateValue(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type Verification struct {
+		HashId   string `json:"hashId"`
+		Field    string `json:"field"`
+		Verified bool   `json:"verified"`
+	}
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	recordAsBytes, err := APIstub.GetState(args[0])
+	if err != nil {
+		return shim.Error("Failed to get record: " + err.Error())
+	} else if recordAsBytes == nil {
+		return shim.Error("Record does not exist. HashId: " + args[0])
+	}
+
+	// Cargo and Container both carry their hashes in privateHashes.
+	var record struct {
+		PrivateHashes map[string]string `json:"privateHashes"`
+	}
+	if err := json.Unmarshal(recordAsBytes, &record); err != nil {
+		return shim.Error("Failed to decode record: " + err.Error())
+	}
+
+	hash, ok := record.PrivateHashes[args[1]]
+	if !ok {
+		return shim.Error("No private data hash recorded for field " + args[1])
+	}
+
+	verification := Verification{HashId: args[0], Field: args[1], Verified: hash == hashPrivateValue(args[3], args[2])}
+
+	verificationAsBytes, _ := json.Marshal(verification)
+	return shim.Success(verificationAsBytes)
+}
+
+// putPrivateObject marshals value to JSON and writes it under key in a private data collection.
+func putPrivateObject(APIstub shim.ChaincodeStubInterface, collection string, key string, value interface{}) error {
+	valueAsBytes, err := marshalRecord(value)
+	if err != nil {
+		return err
+	}
+	return APIstub.PutPrivateData(collection, key, valueAsBytes)
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCheckSalts(t *testing.T) {
+	tests := []struct {
+		name    string
+		salts   map[string]string
+		wantErr bool
+	}{
+		{"separate salts", map[string]string{"declaredValue": "s1", "currency": "s2", "freightPrice": "s3"}, false},
+		{"missing salt", map[string]string{"declaredValue": "s1", "currency": "s2"}, true},
+		{"empty salt", map[string]string{"declaredValue": "s1", "currency": "", "freightPrice": "s3"}, true},
+		{"shared salt", map[string]string{"declaredValue": "s1", "currency": "s1", "freightPrice": "s3"}, true},
+		{"no salts", nil, true},
+	}
+	for _, test := range tests {
+		err := checkSalts(test.salts, "declaredValue", "currency", "freightPrice")
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: checkSalts() = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestVerifyPrivateValue(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "SHIPPER", "Exporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Importer")
+	stub.seedTestRecord("Cargo", "CG1", "SHIPPER", Cargo{HashId: "CG1", Owner: "SHIPPER", Status: "Created", AssociatedContainerHashIds: []string{}})
+
+	terms, _ := json.Marshal(CommercialTerms{DeclaredValue: "125000", Currency: "USD", FreightPrice: "4200",
+		Salts: map[string]string{"declaredValue": "salt-value", "currency": "salt-currency", "freightPrice": "salt-price"}})
+	stub.transient = map[string][]byte{"commercialTerms": terms}
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("Caller is not participant SHIPPER", "setPrivateDetails", "Cargo", "CG1")
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("setPrivateDetails", "Cargo", "CG1")
+	stub.transient = nil
+
+	tests := []struct {
+		field    string
+		value    string
+		salt     string
+		verified bool
+	}{
+		{commercialTermsCollection + ".declaredValue", "125000", "salt-value", true},
+		{commercialTermsCollection + ".declaredValue", "125001", "salt-value", false},
+		{commercialTermsCollection + ".currency", "USD", "salt-currency", true},
+		// A disclosed salt only verifies its own field.
+		{commercialTermsCollection + ".currency", "USD", "salt-value", false},
+		{commercialTermsCollection + ".freightPrice", "4200", "salt-price", true},
+	}
+	for _, test := range tests {
+		var verification struct {
+			Verified bool `json:"verified"`
+		}
+		payload := stub.mustInvoke("verifyPrivateValue", "CG1", test.field, test.value, test.salt)
+		if err := json.Unmarshal(payload, &verification); err != nil {
+			t.Fatal(err)
+		}
+		if verification.Verified != test.verified {
+			t.Errorf("verifyPrivateValue(%s, %s, %s) = %v, want %v", test.field, test.value, test.salt, verification.Verified, test.verified)
+		}
+	}
+
+	// A record that cannot be decoded is reported as such, not as one without hashes.
+	if err := stub.run(func() error {
+		return stub.PutState("CG2", []byte(`{"hashId":"CG2","privateHashes":["not","a","map"]}`))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stub.mustFail("Failed to decode record", "verifyPrivateValue", "CG2", commercialTermsCollection+".currency", "USD", "salt-currency")
+
+	shared, _ := json.Marshal(CommercialTerms{DeclaredValue: "1", Currency: "USD", FreightPrice: "2",
+		Salts: map[string]string{"declaredValue": "salt", "currency": "salt", "freightPrice": "salt"}})
+	stub.transient = map[string][]byte{"commercialTerms": shared}
+	stub.mustFail("share a salt", "setPrivateDetails", "Cargo", "CG1")
+}
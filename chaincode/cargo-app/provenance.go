@@ -0,0 +1,247 @@
+/*
+ * Provenance:
+ * getProvenance answers "where has this container been and who held it" in one query. It walks the
+ * Container's history, the history of every Cargo it travelled in while it was in it, and merges
+ * them into one graph in time order. Transshipments show up as the Container moving between Cargos,
+ * or a Cargo moving between Voyages. Cargos are taken from their key history, so Cargos that have
+ * since been archived or deleted still appear.
+ * Node Types --> Container, Cargo, Voyage, Participant, Organisation, Location.
+ * Edge Types --> contained-in, held-by, moved-to.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+type ProvenanceNode struct {
+	Id    string `json:"id"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+// ProvenanceEdge links two nodes from time At, as recorded by transaction TxId.
+type ProvenanceEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+	At   string `json:"at"`
+	TxId string `json:"txId"`
+	at   time.Time
+}
+
+type ProvenanceGraph struct {
+	ContainerId string           `json:"containerId"`
+	Nodes       []ProvenanceNode `json:"nodes"`
+	Edges       []ProvenanceEdge `json:"edges"`
+	nodeIds     map[string]bool
+}
+
+// node adds a node once and returns its id, which is prefixed by its type so ids of different types cannot clash.
+func (graph *ProvenanceGraph) node(nodeType string, id string, label string) string {
+	nodeId := nodeType + ":" + id
+	if !graph.nodeIds[nodeId] {
+		graph.nodeIds[nodeId] = true
+		if label == "" {
+			label = id
+		}
+		graph.Nodes = append(graph.Nodes, ProvenanceNode{Id: nodeId, Type: nodeType, Label: label})
+	}
+	return nodeId
+}
+
+func (graph *ProvenanceGraph) edge(from string, to string, edgeType string, version historyVersion) {
+	graph.Edges = append(graph.Edges, ProvenanceEdge{From: from, To: to, Type: edgeType, At: version.At.UTC().Format(time.RFC3339Nano), TxId: version.TxId, at: version.At})
+}
+
+// holderNode adds the Participant or Organisation behind an Owner.
+func (graph *ProvenanceGraph) holderNode(APIstub shim.ChaincodeStubInterface, owner string) string {
+	if organisation, _, err := readOrganisation(APIstub, owner); err == nil && organisation.OrganisationId != "" {
+		return graph.node("Organisation", owner, organisation.LegalName)
+	}
+	participant, _ := readParticipant(APIstub, owner)
+	return graph.node("Participant", owner, participant.Name)
+}
+
+// cargoMembership is a period during which the Container was part of a Cargo, from the transaction TxId.
+// A zero Until means it still is.
+type cargoMembership struct {
+	CargoId string
+	TxId    string
+	Since   time.Time
+	Until   time.Time
+}
+
+// wasCargo reports whether key has ever held a Cargo, whether or not it still does.
+func wasCargo(APIstub shim.ChaincodeStubInterface, key string) (bool, error) {
+	versions, err := readHistory(APIstub, key)
+	if err != nil {
+		return false, err
+	}
+	for _, version := range versions {
+		if !version.IsDelete && plainRecordType(version.Value) == "Cargo" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addContainerHistory adds the Container's own moves and custody changes, and returns the Cargos it was part of.
+func (graph *ProvenanceGraph) addContainerHistory(APIstub shim.ChaincodeStubInterface, containerId string) ([]cargoMembership, error) {
+	versions, err := readHistory(APIstub, containerId)
+	if err != nil {
+		return nil, err
+	} else if len(versions) == 0 {
+		return nil, fmt.Errorf("Container %s has no history", containerId)
+	}
+
+	var memberships []cargoMembership
+	isCargo := map[string]bool{}
+	containerNode := ""
+	previous := Container{}
+
+	for _, version := range versions {
+		current := Container{}
+		if !version.IsDelete {
+			if err := json.Unmarshal(version.Value, &current); err != nil {
+				return nil, err
+			}
+		}
+		if containerNode == "" || current.ContainerNumber != "" {
+			containerNode = graph.node("Container", containerId, current.ContainerNumber)
+		}
+
+		if current.CargoId != previous.CargoId {
+			if n := len(memberships); n > 0 && memberships[n-1].Until.IsZero() {
+				memberships[n-1].Until = version.At
+			}
+			if _, checked := isCargo[current.CargoId]; !checked && current.CargoId != "" {
+				if isCargo[current.CargoId], err = wasCargo(APIstub, current.CargoId); err != nil {
+					return nil, err
+				}
+			}
+			if isCargo[current.CargoId] {
+				memberships = append(memberships, cargoMembership{CargoId: current.CargoId, TxId: version.TxId, Since: version.At})
+				graph.edge(containerNode, graph.node("Cargo", current.CargoId, ""), "contained-in", version)
+			}
+		}
+		if current.Owner != previous.Owner && current.Owner != "" {
+			graph.edge(containerNode, graph.holderNode(APIstub, current.Owner), "held-by", version)
+		}
+		if current.ContainerLocation != previous.ContainerLocation && current.ContainerLocation != "" {
+			graph.edge(containerNode, graph.node("Location", current.ContainerLocation, ""), "moved-to", version)
+		}
+		previous = current
+	}
+	return memberships, nil
+}
+
+// addCargoHistory adds the moves, custody changes and Voyages of a Cargo while the Container was part of it.
+func (graph *ProvenanceGraph) addCargoHistory(APIstub shim.ChaincodeStubInterface, membership cargoMembership) error {
+	versions, err := readHistory(APIstub, membership.CargoId)
+	if err != nil {
+		return err
+	}
+
+	cargoNode := graph.node("Cargo", membership.CargoId, "")
+	joining := historyVersion{TxId: membership.TxId, At: membership.Since}
+	joined := false
+	previous := Cargo{}
+
+	for _, version := range versions {
+		current := Cargo{}
+		if !version.IsDelete {
+			if err := json.Unmarshal(version.Value, &current); err != nil {
+				return err
+			}
+		}
+		if !membership.Until.IsZero() && !version.At.Before(membership.Until) {
+			break
+		}
+		// Versions before the Container joined only set the baseline to compare against.
+		if version.At.Before(membership.Since) {
+			previous = current
+			continue
+		}
+		// An existing Cargo's holder, location and Voyage when the Container joined it.
+		if !joined {
+			graph.addCargoChanges(APIstub, cargoNode, Cargo{}, previous, joining)
+			joined = true
+		}
+		graph.addCargoChanges(APIstub, cargoNode, previous, current, version)
+		previous = current
+	}
+	// The Cargo did not change while the Container was in it.
+	if !joined {
+		graph.addCargoChanges(APIstub, cargoNode, Cargo{}, previous, joining)
+	}
+	return nil
+}
+
+// addCargoChanges adds an edge for each of the Cargo's holder, location and Voyage that changed from previous to current.
+func (graph *ProvenanceGraph) addCargoChanges(APIstub shim.ChaincodeStubInterface, cargoNode string, previous Cargo, current Cargo, version historyVersion) {
+	if current.Owner != previous.Owner && current.Owner != "" {
+		graph.edge(cargoNode, graph.holderNode(APIstub, current.Owner), "held-by", version)
+	}
+	if current.CargoLocation != previous.CargoLocation && current.CargoLocation != "" {
+		graph.edge(cargoNode, graph.node("Location", current.CargoLocation, ""), "moved-to", version)
+	}
+	if current.VoyageId != previous.VoyageId && current.VoyageId != "" {
+		graph.edge(cargoNode, graph.node("Voyage", current.VoyageId, ""), "contained-in", version)
+	}
+}
+
+// dot renders the graph in Graphviz DOT format, with edges labelled by type and time.
+func (graph *ProvenanceGraph) dot() []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("digraph provenance {\n")
+	for _, node := range graph.Nodes {
+		buffer.WriteString(fmt.Sprintf("  %s [label=%s, type=%s];\n", strconv.Quote(node.Id), strconv.Quote(node.Label), strconv.Quote(node.Type)))
+	}
+	for _, edge := range graph.Edges {
+		buffer.WriteString(fmt.Sprintf("  %s -> %s [label=%s, type=%s, at=%s];\n", strconv.Quote(edge.From), strconv.Quote(edge.To), strconv.Quote(edge.Type+" "+edge.At), strconv.Quote(edge.Type), strconv.Quote(edge.At)))
+	}
+	buffer.WriteString("}\n")
+	return buffer.Bytes()
+}
+
+// getProvenance - args: containerHashId, and optionally the format: json (default) or dot (Graphviz).
+func (s *SmartContract) getProvenance(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 && len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 1 or 2")
+	}
+	format := optionalArg(args, 1)
+	if format != "" && format != "json" && format != "dot" {
+		return shim.Error("Invalid format " + format + ". Expecting json or dot")
+	}
+
+	graph := &ProvenanceGraph{ContainerId: args[0], Nodes: []ProvenanceNode{}, Edges: []ProvenanceEdge{}, nodeIds: map[string]bool{}}
+
+	memberships, err := graph.addContainerHistory(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get Container history: " + err.Error())
+	}
+	for _, membership := range memberships {
+		if err := graph.addCargoHistory(APIstub, membership); err != nil {
+			return shim.Error("Failed to get Cargo history: " + err.Error())
+		}
+	}
+
+	sort.SliceStable(graph.Edges, func(i, j int) bool { return graph.Edges[i].at.Before(graph.Edges[j].at) })
+
+	if format == "dot" {
+		return shim.Success(graph.dot())
+	}
+	graphAsBytes, _ := json.Marshal(graph)
+	return shim.Success(graphAsBytes)
+}
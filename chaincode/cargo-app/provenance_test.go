@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetProvenance(t *testing.T) {
+	stub := newTestStub(t)
+	put := func(key string, record interface{}) {
+		t.Helper()
+		if err := stub.run(func() error { return putObject(stub, key, record) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// tx1-tx6: the Container joins a Cargo that already exists, which is later deleted, then names one that never existed.
+	put("CG1", Cargo{HashId: "CG1", Owner: "CARRIER", CargoLocation: "Mumbai", Status: "Ready", AssociatedContainerHashIds: []string{"C0"}})
+	put("C1", Container{HashId: "C1", Owner: "SHIPPER", ContainerLocation: "Pune", Status: "Loaded"})
+	put("C1", Container{HashId: "C1", Owner: "SHIPPER", ContainerLocation: "Pune", Status: "InCargo", CargoId: "CG1"})
+	put("CG1", Cargo{HashId: "CG1", Owner: "CARRIER", CargoLocation: "Rotterdam", Status: "Arrived", AssociatedContainerHashIds: []string{"C0", "C1"}})
+	put("C1", Container{HashId: "C1", Owner: "SHIPPER", ContainerLocation: "Rotterdam", Status: "Unloaded", CargoId: "CG9"})
+	if err := stub.run(func() error { return stub.DelState("CG1") }); err != nil {
+		t.Fatal(err)
+	}
+	stub.registerTestParticipant(testMspId, "VIEWER", "Importer")
+
+	var graph ProvenanceGraph
+	if err := json.Unmarshal(stub.asParticipant(testMspId, "VIEWER").mustInvoke("getProvenance", "C1"), &graph); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []ProvenanceEdge{
+		{From: "Container:C1", To: "Participant:SHIPPER", Type: "held-by", TxId: "tx2"},
+		{From: "Container:C1", To: "Location:Pune", Type: "moved-to", TxId: "tx2"},
+		{From: "Container:C1", To: "Cargo:CG1", Type: "contained-in", TxId: "tx3"},
+		// The Cargo existed before the Container joined it.
+		{From: "Cargo:CG1", To: "Participant:CARRIER", Type: "held-by", TxId: "tx3"},
+		{From: "Cargo:CG1", To: "Location:Mumbai", Type: "moved-to", TxId: "tx3"},
+		{From: "Cargo:CG1", To: "Location:Rotterdam", Type: "moved-to", TxId: "tx4"},
+		{From: "Container:C1", To: "Location:Rotterdam", Type: "moved-to", TxId: "tx5"},
+	}
+	if len(graph.Edges) != len(tests) {
+		t.Errorf("got %d edges, want %d: %+v", len(graph.Edges), len(tests), graph.Edges)
+	}
+	for _, want := range tests {
+		found := false
+		for _, edge := range graph.Edges {
+			if edge.From == want.From && edge.To == want.To && edge.Type == want.Type && edge.TxId == want.TxId {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("missing edge %s -%s-> %s in %s", want.From, want.Type, want.To, want.TxId)
+		}
+	}
+}
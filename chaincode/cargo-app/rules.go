@@ -0,0 +1,466 @@
+/*
+ * Business rules:
+ * Rules kept in the ledger configuration are checked before a function runs, on top of the checks
+ * the function makes itself. A rule applies to one function; when all of its "when" conditions hold
+ * (or it has none), all of its "require" conditions must hold too or the transaction is rejected.
+ * A condition compares a field with a value:
+ *   caller.role, caller.mspId, caller.participantId, caller.organisationId --> the submitting identity
+ *   args.<name> or args.<index>                                          --> a function argument
+ *   <field>-><path>                                                      --> a field of the record stored under <field>'s value,
+ *                                                                            or of the Organisation with that id,
+ *                                                                            e.g. args.owner->role, args.hashId->seal.status
+ * The caller's participant fields are set only for a participant of the caller's MSP, as callerParticipant checks.
+ * An Organisation's role is the list of roles it plays, so owner roles are best compared with includes.
+ * Operators --> eq, ne, in, notIn, exists, notExists, gt, gte, lt, lte (numeric), matches (regular expression),
+ * includes (the value, or a list containing it).
+ * Admins replace the rules with setRules, and evaluateRules dry-runs the active or proposed rules against a payload.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Rule is a business rule for one function. Message is returned when the rule rejects a transaction.
+type Rule struct {
+	RuleId   string          `json:"ruleId"`
+	Function string          `json:"function"`
+	When     []RuleCondition `json:"when"`
+	Require  []RuleCondition `json:"require"`
+	Message  string          `json:"message"`
+}
+
+// RuleCondition compares Field with Value, or with Values for in and notIn.
+type RuleCondition struct {
+	Field    string   `json:"field"`
+	Operator string   `json:"operator"`
+	Value    string   `json:"value"`
+	Values   []string `json:"values"`
+}
+
+// ConditionResult is the outcome of one condition in a dry run.
+type ConditionResult struct {
+	RuleCondition
+	Actual string `json:"actual"`
+	Holds  bool   `json:"holds"`
+}
+
+// RuleResult is the outcome of one rule in a dry run. Passed is true for rules that do not apply.
+type RuleResult struct {
+	RuleId  string            `json:"ruleId"`
+	Applies bool              `json:"applies"`
+	Passed  bool              `json:"passed"`
+	Message string            `json:"message"`
+	When    []ConditionResult `json:"when"`
+	Require []ConditionResult `json:"require"`
+}
+
+var ruleOperators = []string{"eq", "ne", "in", "notIn", "exists", "notExists", "gt", "gte", "lt", "lte", "matches", "includes"}
+
+// ruleArgNames names the arguments of the functions rules are most often written for, as in their doc comments.
+// Arguments of other functions are addressed by index.
+var ruleArgNames = map[string][]string{
+	"registerParticipant":         {"hashId", "name", "emailId", "role", "organisationId"},
+	"addNewContainer":             {"hashId", "timestamp", "manufacturer", "status", "loadedItems", "owner", "cargoId", "customClearanceStatus", "shippedFrom", "shippedTo", "containerLocation", "containerNumber", "sizeTypeCode", "tareWeight", "maxPayload", "supplier"},
+	"loadContainerWithPackages":   {"hashId", "timestamp", "status", "loadedItems", "customClearanceStatus", "shippedFrom", "shippedTo", "containerLocation", "sealNumber", "sealType", "sealAppliedBy"},
+	"createCargoLoadContainers":   {"hashId", "txnId", "timestamp", "cargoId", "shippedFrom", "shippedTo", "cargoLocation", "transportationType", "containerQty", "owner", "associatedContainerHashIds", "status", "bookingId"},
+	"updateCargoAttributes":       {"hashId", "txnId", "timestamp", "shippedFrom", "shippedTo", "transportationType", "containerQty", "associatedContainerHashIds", "status"},
+	"updateCargoCoordinates":      {"hashId", "timestamp", "cargoLocation"},
+	"changeCargoCustody":          {"hashId", "newOwner", "seals"},
+	"acceptCargoCustody":          {"hashId", "newOwner", "seals"},
+	"updateContainerAttributes":   {"hashId", "timestamp", "manufacturer", "status", "loadedItems", "customClearanceStatus", "shippedFrom", "shippedTo", "containerLocation"},
+	"changeContainerCustody":      {"hashId", "newOwner", "sealNumber"},
+	"acceptContainerCustody":      {"hashId", "newOwner", "sealNumber"},
+	"unloadContainerFromCargo":    {"cargoHashId", "containerHashId", "sealNumber"},
+	"releaseContainerFromCustoms": {"containerHashId", "customsOfficer", "clearanceStatus", "timestamp"},
+	"declareVGM":                  {"containerHashId", "method", "weight", "responsibleParty", "signatureHash"},
+}
+
+// validateRules checks that every rule names a function, has conditions with known operators and
+// well-formed fields, and has a RuleId of its own.
+func validateRules(rules []Rule) error {
+	ruleIds := map[string]bool{}
+	for _, rule := range rules {
+		if rule.RuleId == "" || rule.Function == "" {
+			return fmt.Errorf("Every rule needs a ruleId and a function")
+		} else if ruleIds[rule.RuleId] {
+			return fmt.Errorf("Rule %s is defined more than once", rule.RuleId)
+		} else if len(rule.Require) == 0 {
+			return fmt.Errorf("Rule %s has no require conditions", rule.RuleId)
+		}
+		ruleIds[rule.RuleId] = true
+
+		for _, condition := range append(append([]RuleCondition{}, rule.When...), rule.Require...) {
+			if !contains(ruleOperators, condition.Operator) {
+				return fmt.Errorf("Rule %s uses unknown operator %s. Expecting one of %s", rule.RuleId, condition.Operator, strings.Join(ruleOperators, ", "))
+			}
+			if !strings.HasPrefix(condition.Field, "caller.") && !strings.HasPrefix(condition.Field, "args.") {
+				return fmt.Errorf("Rule %s field %s must start with caller. or args.", rule.RuleId, condition.Field)
+			}
+			if condition.Operator == "matches" {
+				if _, err := regexp.Compile(condition.Value); err != nil {
+					return fmt.Errorf("Rule %s has an invalid pattern: %s", rule.RuleId, err.Error())
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// parseRules decodes a JSON array of rules, rejecting fields a Rule does not have.
+func parseRules(value string) ([]Rule, error) {
+	var rules []Rule
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(value)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("Failed to decode rules: %s", err.Error())
+	}
+	return rules, validateRules(rules)
+}
+
+// ruleFacts resolves condition fields for one call of a function, loading each record it refers to once.
+type ruleFacts struct {
+	APIstub shim.ChaincodeStubInterface
+	args    map[string]string
+	caller  map[string]string
+	records map[string]map[string]interface{}
+}
+
+func newRuleFacts(APIstub shim.ChaincodeStubInterface, args map[string]string) (*ruleFacts, error) {
+	facts := &ruleFacts{APIstub: APIstub, args: args, caller: map[string]string{}, records: map[string]map[string]interface{}{}}
+
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get caller organisation: %s", err.Error())
+	}
+	facts.caller["mspId"] = mspId
+
+	// Org admins without a participantId attribute have no participant fields.
+	if participant, err := callerParticipant(APIstub); err == nil {
+		facts.caller["participantId"] = participant.HashId
+		facts.caller["role"] = participant.Role
+		facts.caller["organisationId"] = participant.OrganisationId
+	}
+	return facts, nil
+}
+
+// namedArgs maps positional arguments to their names, keeping the index as well.
+func namedArgs(function string, args []string) map[string]string {
+	named := map[string]string{}
+	for i, arg := range args {
+		named[strconv.Itoa(i)] = arg
+		if names := ruleArgNames[function]; i < len(names) {
+			named[names[i]] = arg
+		}
+	}
+	return named
+}
+
+// resolve returns the value of a condition field, or "" if there is none.
+func (facts *ruleFacts) resolve(field string) (string, error) {
+	parts := strings.Split(field, "->")
+
+	var value string
+	if name := strings.TrimPrefix(parts[0], "caller."); name != parts[0] {
+		value = facts.caller[name]
+	} else {
+		value = facts.args[strings.TrimPrefix(parts[0], "args.")]
+	}
+
+	for _, path := range parts[1:] {
+		if value == "" {
+			return "", nil
+		}
+		record, err := facts.record(value)
+		if err != nil {
+			return "", err
+		}
+		value = recordField(record, path)
+	}
+	return value, nil
+}
+
+func (facts *ruleFacts) record(key string) (map[string]interface{}, error) {
+	if record, found := facts.records[key]; found {
+		return record, nil
+	}
+
+	record := map[string]interface{}{}
+	recordAsBytes, err := facts.APIstub.GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get %s: %s", key, err.Error())
+	}
+	isOrganisation := false
+	if recordAsBytes == nil {
+		// Organisations are stored under composite keys.
+		organisationKey, err := facts.APIstub.CreateCompositeKey(organisationObjectType, []string{key})
+		if err != nil {
+			return nil, err
+		}
+		if recordAsBytes, err = facts.APIstub.GetState(organisationKey); err != nil {
+			return nil, fmt.Errorf("Failed to get organisation %s: %s", key, err.Error())
+		}
+		isOrganisation = recordAsBytes != nil
+	}
+	if recordAsBytes != nil {
+		decoder := json.NewDecoder(bytes.NewReader(recordAsBytes))
+		decoder.UseNumber()
+		// Values that are not JSON objects have no fields to compare.
+		decoder.Decode(&record)
+	}
+	if isOrganisation {
+		record["role"] = record["roles"]
+	}
+	facts.records[key] = record
+	return record, nil
+}
+
+// recordField returns the value at a dotted path in a decoded record as a string.
+func recordField(record map[string]interface{}, path string) string {
+	var value interface{} = record
+	for _, name := range strings.Split(path, ".") {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = fields[name]
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	default:
+		valueAsBytes, _ := json.Marshal(value)
+		return string(valueAsBytes)
+	}
+}
+
+// holds evaluates a condition against the actual value of its field.
+func (condition RuleCondition) holds(actual string) bool {
+	switch condition.Operator {
+	case "eq":
+		return actual == condition.Value
+	case "ne":
+		return actual != condition.Value
+	case "in":
+		return contains(condition.Values, actual)
+	case "notIn":
+		return !contains(condition.Values, actual)
+	case "exists":
+		return actual != ""
+	case "notExists":
+		return actual == ""
+	case "matches":
+		matched, err := regexp.MatchString(condition.Value, actual)
+		return err == nil && matched
+	case "includes":
+		var list []string
+		if err := json.Unmarshal([]byte(actual), &list); err == nil {
+			return contains(list, condition.Value)
+		}
+		return actual == condition.Value
+	}
+
+	actualNumber, err := strconv.ParseFloat(actual, 64)
+	if err != nil {
+		return false
+	}
+	expected, err := strconv.ParseFloat(condition.Value, 64)
+	if err != nil {
+		return false
+	}
+	switch condition.Operator {
+	case "gt":
+		return actualNumber > expected
+	case "gte":
+		return actualNumber >= expected
+	case "lt":
+		return actualNumber < expected
+	case "lte":
+		return actualNumber <= expected
+	}
+	return false
+}
+
+func (facts *ruleFacts) evaluateConditions(conditions []RuleCondition) ([]ConditionResult, bool, error) {
+	results := []ConditionResult{}
+	allHold := true
+	for _, condition := range conditions {
+		actual, err := facts.resolve(condition.Field)
+		if err != nil {
+			return nil, false, err
+		}
+		result := ConditionResult{RuleCondition: condition, Actual: actual, Holds: condition.holds(actual)}
+		allHold = allHold && result.Holds
+		results = append(results, result)
+	}
+	return results, allHold, nil
+}
+
+// evaluateRuleSet evaluates the rules for function against its named arguments.
+func evaluateRuleSet(APIstub shim.ChaincodeStubInterface, rules []Rule, function string, args map[string]string) ([]RuleResult, error) {
+	results := []RuleResult{}
+
+	var facts *ruleFacts
+	for _, rule := range rules {
+		if rule.Function != function {
+			continue
+		}
+		if facts == nil {
+			var err error
+			if facts, err = newRuleFacts(APIstub, args); err != nil {
+				return nil, err
+			}
+		}
+
+		result := RuleResult{RuleId: rule.RuleId, Passed: true}
+		var err error
+		if result.When, result.Applies, err = facts.evaluateConditions(rule.When); err != nil {
+			return nil, err
+		}
+		if result.Applies {
+			if result.Require, result.Passed, err = facts.evaluateConditions(rule.Require); err != nil {
+				return nil, err
+			}
+		}
+		if !result.Passed {
+			result.Message = rule.Message
+			if result.Message == "" {
+				result.Message = "Rejected by rule " + rule.RuleId
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// assertRules rejects a call of function that breaks one of the active rules. Queries, setRules and the
+// governance votes are not checked, so a bad rule can always be replaced.
+func assertRules(APIstub shim.ChaincodeStubInterface, function string, args []string) error {
+	if isQueryFunction(function) || contains([]string{"setRules", "proposeConfigChange", "approveProposal", "rejectProposal"}, function) {
+		return nil
+	}
+
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return fmt.Errorf("Failed to get ledger configuration: %s", err.Error())
+	} else if len(config.Rules) == 0 {
+		return nil
+	}
+
+	results, err := evaluateRuleSet(APIstub, config.Rules, function, namedArgs(function, args))
+	if err != nil {
+		return fmt.Errorf("Failed to evaluate rules: %s", err.Error())
+	}
+	for _, result := range results {
+		if !result.Passed {
+			return fmt.Errorf("%s", result.Message)
+		}
+	}
+	return nil
+}
+
+// setRules - args: rules (JSON array of Rule). Replaces the active rules. Only an admin named in the ledger configuration
+// can change them, and only while governance is not configured. The configuration key needs the endorsement of every
+// organisation with admins configured, so one organisation cannot change the rules on its own.
+func (s *SmartContract) setRules(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	rules, err := parseRules(args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	config, err := readLedgerConfig(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get ledger configuration: " + err.Error())
+	} else if len(config.Admins) == 0 {
+		return shim.Error("Rules can only be set once admins are named in the ledger configuration")
+	}
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get caller organisation: " + err.Error())
+	}
+	if !callerIsConfiguredAdmin(APIstub, mspId) {
+		return shim.Error("Caller is not an admin of " + mspId + " named in the ledger configuration")
+	}
+	if err := assertUngoverned(APIstub, "rules"); err != nil {
+		return shim.Error(err.Error())
+	}
+	config.Rules = rules
+
+	if err := putLedgerConfig(APIstub, config); err != nil {
+		return shim.Error("Failed to record rules: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// evaluateRules - args: function, payload (JSON object of argument names to values, or array of arguments), and
+// optionally rules (JSON array of Rule) to test instead of the active ones. Reports how each rule for the function decides.
+func (s *SmartContract) evaluateRules(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type RulesEvaluation struct {
+		Function string       `json:"function"`
+		Allowed  bool         `json:"allowed"`
+		Rules    []RuleResult `json:"rules"`
+	}
+
+	if len(args) != 2 && len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	named := map[string]string{}
+	var positional []string
+	if err := json.Unmarshal([]byte(args[1]), &positional); err == nil {
+		named = namedArgs(args[0], positional)
+	} else if err := json.Unmarshal([]byte(args[1]), &named); err != nil {
+		return shim.Error("Payload must be a JSON object of argument names to values, or an array of arguments")
+	}
+
+	var rules []Rule
+	if len(args) == 3 {
+		var err error
+		if rules, err = parseRules(args[2]); err != nil {
+			return shim.Error(err.Error())
+		}
+	} else {
+		config, err := readLedgerConfig(APIstub)
+		if err != nil {
+			return shim.Error("Failed to get ledger configuration: " + err.Error())
+		}
+		rules = config.Rules
+	}
+
+	results, err := evaluateRuleSet(APIstub, rules, args[0], named)
+	if err != nil {
+		return shim.Error("Failed to evaluate rules: " + err.Error())
+	}
+
+	evaluation := RulesEvaluation{Function: args[0], Allowed: true, Rules: results}
+	for _, result := range results {
+		evaluation.Allowed = evaluation.Allowed && result.Passed
+	}
+
+	evaluationAsBytes, _ := json.Marshal(evaluation)
+	return shim.Success(evaluationAsBytes)
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRuleConditionHolds(t *testing.T) {
+	tests := []struct {
+		condition RuleCondition
+		actual    string
+		holds     bool
+	}{
+		{RuleCondition{Operator: "eq", Value: "Transporter"}, "Transporter", true},
+		{RuleCondition{Operator: "eq", Value: "Transporter"}, "Importer", false},
+		{RuleCondition{Operator: "ne", Value: "Transporter"}, "Importer", true},
+		{RuleCondition{Operator: "in", Values: []string{"Sea", "Air"}}, "Air", true},
+		{RuleCondition{Operator: "notIn", Values: []string{"Sea", "Air"}}, "Air", false},
+		{RuleCondition{Operator: "exists"}, "", false},
+		{RuleCondition{Operator: "notExists"}, "", true},
+		{RuleCondition{Operator: "gt", Value: "30000"}, "30480", true},
+		{RuleCondition{Operator: "lte", Value: "30000"}, "30480", false},
+		{RuleCondition{Operator: "gte", Value: "1.5"}, "1.5", true},
+		{RuleCondition{Operator: "lt", Value: "10"}, "heavy", false},
+		{RuleCondition{Operator: "matches", Value: "^[A-Z]{4}[0-9]{7}$"}, "CSQU3054383", true},
+		{RuleCondition{Operator: "matches", Value: "^[A-Z]{4}[0-9]{7}$"}, "CSQU305438", false},
+		{RuleCondition{Operator: "includes", Value: "Transporter"}, "Transporter", true},
+		{RuleCondition{Operator: "includes", Value: "Transporter"}, `["Exporter","Transporter"]`, true},
+		{RuleCondition{Operator: "includes", Value: "Transporter"}, `["Exporter"]`, false},
+		{RuleCondition{Operator: "includes", Value: "Transporter"}, "", false},
+	}
+	for _, test := range tests {
+		if holds := test.condition.holds(test.actual); holds != test.holds {
+			t.Errorf("%s %q %v holds for %q = %v, want %v", test.condition.Operator, test.condition.Value, test.condition.Values, test.actual, holds, test.holds)
+		}
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	require := []RuleCondition{{Field: "args.owner->role", Operator: "eq", Value: "Transporter"}}
+
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr bool
+	}{
+		{"valid", []Rule{{RuleId: "r1", Function: "addNewContainer", Require: require}}, false},
+		{"no ruleId", []Rule{{Function: "addNewContainer", Require: require}}, true},
+		{"duplicate ruleId", []Rule{{RuleId: "r1", Function: "f", Require: require}, {RuleId: "r1", Function: "g", Require: require}}, true},
+		{"no require", []Rule{{RuleId: "r1", Function: "f"}}, true},
+		{"unknown operator", []Rule{{RuleId: "r1", Function: "f", Require: []RuleCondition{{Field: "args.0", Operator: "like"}}}}, true},
+		{"unknown field source", []Rule{{RuleId: "r1", Function: "f", Require: []RuleCondition{{Field: "state.x", Operator: "exists"}}}}, true},
+		{"bad pattern", []Rule{{RuleId: "r1", Function: "f", Require: []RuleCondition{{Field: "args.0", Operator: "matches", Value: "("}}}}, true},
+	}
+	for _, test := range tests {
+		if err := validateRules(test.rules); (err != nil) != test.wantErr {
+			t.Errorf("%s: validateRules() = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestEvaluateRulesResolvesCallerAndOwners(t *testing.T) {
+	stub := newTestStub(t)
+	stub.configureTestAdmins(testMspId)
+	stub.asAdmin(testMspId).mustInvoke("registerOrganisation", "LINE", "Line Shipping", testMspId, "SG", "Exporter,Transporter", "")
+	stub.asAdmin(testMspId).mustInvoke("registerOrganisation", "TRADER", "Trader Ltd", testMspId, "GB", "Importer", "")
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(testMspId, "BUYER", "Importer")
+
+	rules, _ := json.Marshal([]Rule{
+		{RuleId: "owner-is-transporter", Function: "addNewContainer", Require: []RuleCondition{{Field: "args.owner->role", Operator: "includes", Value: "Transporter"}}},
+		{RuleId: "coordinates-from-transporters", Function: "updateCargoCoordinates", When: []RuleCondition{{Field: "caller.participantId", Operator: "exists"}}, Require: []RuleCondition{{Field: "caller.role", Operator: "eq", Value: "Transporter"}}},
+	})
+	stub.asConfiguredAdmin(testMspId).mustInvoke("setRules", string(rules))
+
+	tests := []struct {
+		name     string
+		mspId    string
+		attrs    map[string]string
+		function string
+		payload  string
+		allowed  bool
+	}{
+		{"participant owner with the role", testMspId, nil, "addNewContainer", `{"owner":"CARRIER"}`, true},
+		{"participant owner without the role", testMspId, nil, "addNewContainer", `{"owner":"BUYER"}`, false},
+		{"organisation owner playing the role", testMspId, nil, "addNewContainer", `{"owner":"LINE"}`, true},
+		{"organisation owner not playing the role", testMspId, nil, "addNewContainer", `{"owner":"TRADER"}`, false},
+		{"unknown owner", testMspId, nil, "addNewContainer", `{"owner":"NOBODY"}`, false},
+		{"transporter caller", testMspId, map[string]string{participantIdAttribute: "CARRIER"}, "updateCargoCoordinates", `{}`, true},
+		{"importer caller", testMspId, map[string]string{participantIdAttribute: "BUYER"}, "updateCargoCoordinates", `{}`, false},
+		{"org admin", testMspId, map[string]string{orgAdminAttribute: "true"}, "updateCargoCoordinates", `{}`, true},
+	}
+	for _, test := range tests {
+		var evaluation struct {
+			Allowed bool `json:"allowed"`
+		}
+		attrs := test.attrs
+		if attrs == nil {
+			attrs = map[string]string{orgAdminAttribute: "true"}
+		}
+		payload := stub.as(test.mspId, attrs).mustInvoke("evaluateRules", test.function, test.payload)
+		if err := json.Unmarshal(payload, &evaluation); err != nil {
+			t.Fatal(err)
+		}
+		if evaluation.Allowed != test.allowed {
+			t.Errorf("%s: allowed = %v, want %v", test.name, evaluation.Allowed, test.allowed)
+		}
+	}
+}
+
+func TestAddNewContainerOwnerRule(t *testing.T) {
+	stub := newTestStub(t)
+	stub.configureTestAdmins(testMspId)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(testMspId, "BUYER", "Importer")
+
+	container := func(hashId string, owner string, cargoId string, containerNumber string) []string {
+		return []string{hashId, "2020-03-01T08:00:00Z", "Maersk", "Available", "", owner, cargoId, "Pending", "Mumbai", "Rotterdam", "Mumbai", containerNumber, "22G1", "2200", "28280"}
+	}
+
+	// Without rules, the owner's role is not checked, and the cargoId is just a cargoId.
+	stub.asParticipant(testMspId, "BUYER").mustInvoke("addNewContainer", container("C1", "BUYER", "", "CSQU3054383")...)
+
+	rules, _ := json.Marshal([]Rule{{RuleId: "owner-is-transporter", Function: "addNewContainer", Require: []RuleCondition{{Field: "args.owner->role", Operator: "includes", Value: "Transporter"}}, Message: "New Owner is not a Transporter"}})
+	stub.asConfiguredAdmin(testMspId).mustInvoke("setRules", string(rules))
+	stub.asParticipant(testMspId, "BUYER").mustFail("New Owner is not a Transporter", "addNewContainer", container("C2", "BUYER", "", "MSCU6639870")...)
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("addNewContainer", container("C2", "CARRIER", "CG7", "MSCU6639870")...)
+}
+
+func TestSetRulesNeedsEveryAdminOrganisation(t *testing.T) {
+	stub := newTestStub(t)
+	rules, _ := json.Marshal([]Rule{{RuleId: "r1", Function: "addNewContainer", Require: []RuleCondition{{Field: "args.owner->role", Operator: "includes", Value: "Transporter"}}}})
+
+	stub.asAdmin(testMspId).mustFail("once admins are named", "setRules", string(rules))
+
+	stub.configureTestAdmins(testMspId, otherTestMspId)
+	// An org admin by certificate attribute alone, or of an organisation without configured admins, cannot set them.
+	stub.asAdmin(testMspId).mustFail("Caller is not an admin of "+testMspId+" named in the ledger configuration", "setRules", string(rules))
+	stub.asAdmin("Org3MSP").mustFail("Caller is not an admin of Org3MSP", "setRules", string(rules))
+	stub.asConfiguredAdmin(otherTestMspId).mustInvoke("setRules", string(rules))
+
+	if want := []string{testMspId, otherTestMspId}; !reflect.DeepEqual(stub.endorsingOrgs(ledgerConfigKey), want) {
+		t.Errorf("ledger configuration endorsed by %v, want %v", stub.endorsingOrgs(ledgerConfigKey), want)
+	}
+}
@@ -0,0 +1,333 @@
+/*
+ * Schema versioning and migration:
+ * Every record the chaincode stores carries the schemaVersion it was written with; records written
+ * before versioning have none and count as version 1. When a change to a record type needs old
+ * documents rewritten, bump currentSchemaVersion and register an upgrade from the previous version.
+ * Upgrades are applied lazily whenever a record is read, and eagerly, in pages, by migrateState,
+ * so a chaincode upgrade can be rolled out and the ledger migrated behind it.
+ * migrateState scans the records stored under plain keys (Cargo, Container, Participant); records
+ * under composite keys have no upgrades registered and take the current version when next written.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	currentSchemaVersion     = 2
+	migrationStatusKey       = "MigrationStatus"
+	defaultMigrationBatch    = 100
+	schemaVersionField       = "schemaVersion"
+	unversionedSchemaVersion = 1
+)
+
+// schemaUpgrade rewrites a decoded record from one schema version to the next.
+type schemaUpgrade func(record map[string]interface{}) error
+
+// schemaUpgrades holds, per object type, the upgrade from each schema version to the next.
+var schemaUpgrades = map[string]map[int]schemaUpgrade{
+	"Participant": {
+		// Version 1 participants predate the participant lifecycle.
+		1: func(record map[string]interface{}) error {
+			if status, _ := record["status"].(string); status == "" {
+				record["status"] = participantActiveStatus
+			}
+			if record["roleHistory"] == nil {
+				record["roleHistory"] = []interface{}{}
+			}
+			return nil
+		},
+	},
+	"Cargo": {
+		// Version 1 Cargo may predate containers lists and multimodal legs.
+		1: func(record map[string]interface{}) error {
+			if record["associatedContainerHashIds"] == nil {
+				record["associatedContainerHashIds"] = []interface{}{}
+			}
+			if record["legs"] == nil {
+				record["legs"] = []interface{}{}
+			}
+			return nil
+		},
+	},
+}
+
+// MigrationStatus is the progress of the eager migration by migrateState.
+type MigrationStatus struct {
+	TargetVersion int    `json:"targetVersion"`
+	NextKey       string `json:"nextKey"`
+	Scanned       int    `json:"scanned"`
+	Migrated      int    `json:"migrated"`
+	Complete      bool   `json:"complete"`
+	LastRunAt     string `json:"lastRunAt"`
+	LastRunTxId   string `json:"lastRunTxId"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// marshalRecord marshals value to JSON, stamping the current schema version on record types that carry one.
+func marshalRecord(value interface{}) ([]byte, error) {
+	valueAsBytes, err := json.Marshal(value)
+	if err != nil || !bytes.HasPrefix(valueAsBytes, []byte("{")) {
+		return valueAsBytes, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(valueAsBytes, &fields); err != nil {
+		return nil, err
+	}
+	if _, versioned := fields[schemaVersionField]; !versioned {
+		return valueAsBytes, nil
+	}
+	fields[schemaVersionField] = json.RawMessage(strconv.Itoa(currentSchemaVersion))
+	return json.Marshal(fields)
+}
+
+// recordSchemaVersion returns the schema version of a decoded record.
+func recordSchemaVersion(record map[string]interface{}) (int, error) {
+	version, found := record[schemaVersionField]
+	if !found || version == nil {
+		return unversionedSchemaVersion, nil
+	}
+	number, ok := version.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("Invalid schema version %v", version)
+	}
+	schemaVersion, err := strconv.Atoi(number.String())
+	if err != nil || schemaVersion < 1 {
+		return 0, fmt.Errorf("Invalid schema version %s", number.String())
+	}
+	return schemaVersion, nil
+}
+
+// upgradeRecord brings a stored record of objectType up to the current schema version. It also
+// reports whether the record changed. Records written by a newer chaincode are refused rather than
+// read partially.
+func upgradeRecord(objectType string, valueAsBytes []byte) ([]byte, bool, error) {
+	record := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(valueAsBytes))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return nil, false, err
+	}
+
+	version, err := recordSchemaVersion(record)
+	if err != nil {
+		return nil, false, err
+	} else if version == currentSchemaVersion {
+		return valueAsBytes, false, nil
+	} else if version > currentSchemaVersion {
+		return nil, false, fmt.Errorf("%s was written with schema version %d; this chaincode only knows up to %d", objectType, version, currentSchemaVersion)
+	}
+
+	for ; version < currentSchemaVersion; version++ {
+		if upgrade, found := schemaUpgrades[objectType][version]; found {
+			if err := upgrade(record); err != nil {
+				return nil, false, fmt.Errorf("Failed to upgrade %s from schema version %d: %s", objectType, version, err.Error())
+			}
+		}
+	}
+	record[schemaVersionField] = currentSchemaVersion
+
+	upgradedAsBytes, err := json.Marshal(record)
+	return upgradedAsBytes, true, err
+}
+
+// unmarshalRecord decodes a stored record of objectType into record, upgrading it to the current schema version first.
+func unmarshalRecord(objectType string, valueAsBytes []byte, record interface{}) error {
+	upgradedAsBytes, _, err := upgradeRecord(objectType, valueAsBytes)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(upgradedAsBytes, record)
+}
+
+// upgradeRecordBytes returns a stored record upgraded for a query that passes it on as JSON. Missing records stay nil.
+func upgradeRecordBytes(objectType string, valueAsBytes []byte) ([]byte, error) {
+	if valueAsBytes == nil {
+		return nil, nil
+	}
+	upgradedAsBytes, _, err := upgradeRecord(objectType, valueAsBytes)
+	return upgradedAsBytes, err
+}
+
+// plainRecordType tells the record types stored under plain keys apart by their fields.
+// Configuration values under plain keys are not records and give "".
+func plainRecordType(valueAsBytes []byte) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(valueAsBytes, &fields); err != nil {
+		return ""
+	}
+	if _, found := fields["associatedContainerHashIds"]; found {
+		return "Cargo"
+	} else if _, found := fields["loadedItems"]; found {
+		return "Container"
+	} else if _, found := fields["emailId"]; found {
+		return "Participant"
+	}
+	return ""
+}
+
+func readMigrationStatus(APIstub shim.ChaincodeStubInterface) (MigrationStatus, error) {
+	status := MigrationStatus{TargetVersion: currentSchemaVersion}
+
+	statusAsBytes, err := APIstub.GetState(migrationStatusKey)
+	if err != nil || statusAsBytes == nil {
+		return status, err
+	}
+
+	err = json.Unmarshal(statusAsBytes, &status)
+	if status.TargetVersion != currentSchemaVersion {
+		// The chaincode has been upgraded again since the last migration, so it starts over.
+		status = MigrationStatus{TargetVersion: currentSchemaVersion}
+	}
+	return status, err
+}
+
+// migrateState - args: fromKey, batchSize. Upgrades up to batchSize records from fromKey on ("" starts at the
+// beginning) and returns the key to continue from. Only an org admin can migrate state; records whose key-level
+// endorsement policy names other organisations need their endorsement as well.
+func (s *SmartContract) migrateState(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	batchSize := defaultMigrationBatch
+	if args[1] != "" {
+		var err error
+		if batchSize, err = strconv.Atoi(args[1]); err != nil || batchSize < 1 {
+			return shim.Error("Batch size must be a whole number of at least 1")
+		}
+	}
+
+	mspId, err := callerOrg(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get caller organisation: " + err.Error())
+	}
+	if err := assertOrgAdmin(APIstub, mspId); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	status, err := readMigrationStatus(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get migration status: " + err.Error())
+	}
+	if args[0] == "" {
+		status = MigrationStatus{TargetVersion: currentSchemaVersion}
+	}
+
+	recordsIterator, err := APIstub.GetStateByRange(args[0], "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer recordsIterator.Close()
+
+	scanned := 0
+	status.NextKey = ""
+	for recordsIterator.HasNext() {
+		record, err := recordsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if scanned == batchSize {
+			status.NextKey = record.Key
+			break
+		}
+		scanned++
+
+		objectType := plainRecordType(record.Value)
+		if objectType == "" {
+			continue
+		}
+		upgradedAsBytes, upgraded, err := upgradeRecord(objectType, record.Value)
+		if err != nil {
+			return shim.Error("Failed to upgrade " + record.Key + ": " + err.Error())
+		} else if !upgraded {
+			continue
+		}
+		if err := APIstub.PutState(record.Key, upgradedAsBytes); err != nil {
+			return shim.Error("Failed to write " + record.Key + ": " + err.Error())
+		}
+		status.Migrated++
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+	status.Scanned += scanned
+	status.Complete = status.NextKey == ""
+	status.LastRunAt = now.UTC().Format(time.RFC3339)
+	status.LastRunTxId = APIstub.GetTxID()
+
+	if err := putObject(APIstub, migrationStatusKey, status); err != nil {
+		return shim.Error("Failed to record migration status: " + err.Error())
+	}
+
+	statusAsBytes, _ := json.Marshal(status)
+	return shim.Success(statusAsBytes)
+}
+
+// getMigrationStatus returns the progress of migrateState and how many records of each type are still
+// stored at each schema version.
+func (s *SmartContract) getMigrationStatus(APIstub shim.ChaincodeStubInterface) sc.Response {
+
+	type SchemaReport struct {
+		CurrentSchemaVersion int                       `json:"currentSchemaVersion"`
+		Migration            MigrationStatus           `json:"migration"`
+		RecordVersions       map[string]map[string]int `json:"recordVersions"`
+		Outdated             int                       `json:"outdated"`
+	}
+
+	status, err := readMigrationStatus(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get migration status: " + err.Error())
+	}
+	report := SchemaReport{CurrentSchemaVersion: currentSchemaVersion, Migration: status, RecordVersions: map[string]map[string]int{}}
+
+	recordsIterator, err := APIstub.GetStateByRange("", "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer recordsIterator.Close()
+
+	for recordsIterator.HasNext() {
+		record, err := recordsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		objectType := plainRecordType(record.Value)
+		if objectType == "" {
+			continue
+		}
+
+		fields := map[string]interface{}{}
+		decoder := json.NewDecoder(bytes.NewReader(record.Value))
+		decoder.UseNumber()
+		decoder.Decode(&fields)
+		version, err := recordSchemaVersion(fields)
+		if err != nil {
+			return shim.Error("Failed to read schema version of " + record.Key + ": " + err.Error())
+		}
+
+		if report.RecordVersions[objectType] == nil {
+			report.RecordVersions[objectType] = map[string]int{}
+		}
+		report.RecordVersions[objectType][strconv.Itoa(version)]++
+		if version < currentSchemaVersion {
+			report.Outdated++
+		}
+	}
+
+	reportAsBytes, _ := json.Marshal(report)
+	return shim.Success(reportAsBytes)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUpgradeRecord(t *testing.T) {
+	tests := []struct {
+		name       string
+		objectType string
+		value      string
+		upgraded   bool
+		check      func(record map[string]interface{}) bool
+		wantErr    bool
+	}{
+		{"unversioned participant", "Participant", `{"hashId":"P1","emailId":"p1@example.com"}`, true, func(record map[string]interface{}) bool {
+			return record["status"] == participantActiveStatus && record["roleHistory"] != nil
+		}, false},
+		{"suspended participant keeps its status", "Participant", `{"hashId":"P1","status":"Suspended","schemaVersion":1}`, true, func(record map[string]interface{}) bool {
+			return record["status"] == "Suspended"
+		}, false},
+		{"unversioned cargo", "Cargo", `{"hashId":"CG1"}`, true, func(record map[string]interface{}) bool {
+			return record["legs"] != nil && record["associatedContainerHashIds"] != nil
+		}, false},
+		{"type without upgrades", "Container", `{"hashId":"C1"}`, true, nil, false},
+		{"current version", "Cargo", `{"hashId":"CG1","schemaVersion":2}`, false, nil, false},
+		{"newer version", "Cargo", `{"hashId":"CG1","schemaVersion":3}`, false, nil, true},
+		{"invalid version", "Cargo", `{"hashId":"CG1","schemaVersion":"two"}`, false, nil, true},
+	}
+	for _, test := range tests {
+		upgradedAsBytes, upgraded, err := upgradeRecord(test.objectType, []byte(test.value))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: upgradeRecord() = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		} else if err != nil {
+			continue
+		}
+		record := map[string]interface{}{}
+		json.Unmarshal(upgradedAsBytes, &record)
+		if upgraded != test.upgraded || record[schemaVersionField] != float64(currentSchemaVersion) {
+			t.Errorf("%s: upgradeRecord() = %s, upgraded %v; want version %d, upgraded %v", test.name, upgradedAsBytes, upgraded, currentSchemaVersion, test.upgraded)
+		} else if test.check != nil && !test.check(record) {
+			t.Errorf("%s: upgradeRecord() = %s", test.name, upgradedAsBytes)
+		}
+	}
+}
+
+func TestMarshalRecord(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{Booking{BookingId: "B1"}, `"schemaVersion":` + strconv.Itoa(currentSchemaVersion)},
+		{BatchItemResult{HashId: "C1"}, `{"index":0,"hashId":"C1","status":"","message":""}`},
+		{[]string{"C1"}, `["C1"]`},
+	}
+	for _, test := range tests {
+		valueAsBytes, err := marshalRecord(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !json.Valid(valueAsBytes) || !strings.Contains(string(valueAsBytes), test.want) {
+			t.Errorf("marshalRecord(%T) = %s, want %s", test.value, valueAsBytes, test.want)
+		}
+	}
+}
+
+func TestPlainRecordType(t *testing.T) {
+	tests := []struct {
+		value      string
+		objectType string
+	}{
+		{`{"hashId":"CG1","associatedContainerHashIds":[]}`, "Cargo"},
+		{`{"hashId":"C1","loadedItems":""}`, "Container"},
+		{`{"hashId":"P1","emailId":"p1@example.com"}`, "Participant"},
+		{`100`, ""},
+		{`{"targetVersion":2}`, ""},
+	}
+	for _, test := range tests {
+		if objectType := plainRecordType([]byte(test.value)); objectType != test.objectType {
+			t.Errorf("plainRecordType(%s) = %q, want %q", test.value, objectType, test.objectType)
+		}
+	}
+}
+
+func TestMigrateState(t *testing.T) {
+	stub := newTestStub(t)
+	err := stub.run(func() error {
+		for _, hashId := range []string{"P1", "P2", "P3"} {
+			if err := stub.PutState(hashId, []byte(`{"hashId":"`+hashId+`","emailId":"`+hashId+`@example.com","mspId":"`+testMspId+`"}`)); err != nil {
+				return err
+			}
+		}
+		return stub.PutState("CG1", []byte(`{"hashId":"CG1","associatedContainerHashIds":["C1"],"schemaVersion":2}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type schemaReport struct {
+		Migration MigrationStatus `json:"migration"`
+		Outdated  int             `json:"outdated"`
+	}
+	var report schemaReport
+	json.Unmarshal(stub.asAdmin(testMspId).mustInvoke("getMigrationStatus"), &report)
+	if report.Outdated != 3 {
+		t.Errorf("%d records outdated before migration, want 3", report.Outdated)
+	}
+
+	stub.asParticipant(testMspId, "P1").mustFail("Caller is not an org admin", "migrateState", "", "2")
+	stub.asAdmin(testMspId).mustFail("Batch size must be a whole number of at least 1", "migrateState", "", "0")
+
+	var status MigrationStatus
+	json.Unmarshal(stub.mustInvoke("migrateState", "", "2"), &status)
+	if status.Complete || status.NextKey == "" || status.Scanned != 2 {
+		t.Fatalf("first page = %+v, want 2 scanned and a key to continue from", status)
+	}
+	json.Unmarshal(stub.mustInvoke("migrateState", status.NextKey, "100"), &status)
+	if !status.Complete || status.Migrated != 3 {
+		t.Errorf("second page = %+v, want complete with 3 migrated in all", status)
+	}
+
+	json.Unmarshal(stub.mustInvoke("getMigrationStatus"), &report)
+	if report.Outdated != 0 || !report.Migration.Complete {
+		t.Errorf("%d records outdated after migration (%+v), want 0", report.Outdated, report.Migration)
+	}
+	var participant Participant
+	stub.readTestRecord("P2", &participant)
+	if participant.Status != participantActiveStatus || participant.SchemaVersion != currentSchemaVersion {
+		t.Errorf("P2 is %q at schema version %d, want %s at %d", participant.Status, participant.SchemaVersion, participantActiveStatus, currentSchemaVersion)
+	}
+}
+
+func TestHandlersRefuseUnreadableRecords(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	err := stub.run(func() error {
+		if err := stub.PutState("CG1", []byte(`{"hashId":"CG1","owner":"CARRIER","status":"In-Transit","schemaVersion":3}`)); err != nil {
+			return err
+		}
+		return stub.PutState("C1", []byte(`{"hashId":"C1","owner":"CARRIER","status":"Available","schemaVersion":3}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		function string
+		args     []string
+		reason   string
+	}{
+		{"updateCargoCoordinates", []string{"CG1", "2020-03-01T09:00:00Z", "Delhi"}, "written with schema version 3"},
+		{"changeCargoCustody", []string{"CG1", "CARRIER"}, "written with schema version 3"},
+		{"loadContainerWithPackages", []string{"C1", "2020-03-01T09:00:00Z", "Loaded", "Tea", "Pending", "Pune", "Delhi", "Pune"}, "written with schema version 3"},
+		{"changeContainerCustody", []string{"C1", "CARRIER"}, "written with schema version 3"},
+		// An absent key is not an empty record to fill in.
+		{"updateCargoCoordinates", []string{"CG9", "2020-03-01T09:00:00Z", "Delhi"}, "Cargo does not exist"},
+		{"updateCargoAttributes", []string{"CG9", "T1", "2020-03-01T09:00:00Z", "Pune", "Delhi", "Road", "1", "C1", "Ready"}, "Cargo does not exist"},
+		{"updateContainerAttributes", []string{"C9", "2020-03-01T09:00:00Z", "Maersk", "Available", "", "Pending", "Pune", "Delhi", "Pune"}, "Container does not exist"},
+		{"unloadContainerFromCargo", []string{"CG9", "C1"}, "Cargo does not exist"},
+	}
+	stub.asParticipant(testMspId, "CARRIER")
+	for _, test := range tests {
+		stub.mustFail(test.reason, test.function, test.args...)
+	}
+
+	if stub.State["CG9"] != nil || stub.State["C9"] != nil {
+		t.Error("updating a missing record created it")
+	}
+	var record map[string]interface{}
+	json.Unmarshal(stub.State["CG1"], &record)
+	if record["schemaVersion"] != float64(3) || record["status"] != "In-Transit" {
+		t.Errorf("CG1 = %v, want it left at schema version 3", record)
+	}
+}
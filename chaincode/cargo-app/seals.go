@@ -0,0 +1,285 @@
+/*
+ * Container seals and tamper evidence:
+ * A seal is applied when a Container is loaded (or resealed later), and whoever completes a
+ * custody handover or unloads the Container reports the seal number they see. A different
+ * number, or a door-open sensor event without an authorized opening, records a Seal Broken
+ * incident against the Container and marks its seal Broken. Door events are accepted from sensors
+ * registered as participants with the IoT Sensor role, reporting as themselves, or from the custodian.
+ * Seal States --> Intact, Removed, Broken.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	sealIncidentObjectType = "SealIncident"
+	sealIntactStatus       = "Intact"
+	sensorRole             = "IoT Sensor"
+)
+
+type Seal struct {
+	SealNumber string `json:"sealNumber"`
+	Type       string `json:"type"`
+	AppliedBy  string `json:"appliedBy"`
+	AppliedAt  string `json:"appliedAt"`
+	Timestamp  string `json:"timestamp"`
+	Status     string `json:"status"`
+}
+
+// SealIncident records evidence that a Container may have been tampered with.
+type SealIncident struct {
+	ContainerId        string `json:"containerId"`
+	SealNumber         string `json:"sealNumber"`
+	ReportedSealNumber string `json:"reportedSealNumber"`
+	Reason             string `json:"reason"`
+	ReportedBy         string `json:"reportedBy"`
+	TxnId              string `json:"txnId"`
+	Timestamp          string `json:"timestamp"`
+	SchemaVersion      int    `json:"schemaVersion"`
+}
+
+// newSeal returns an intact seal applied at the transaction time.
+func newSeal(APIstub shim.ChaincodeStubInterface, sealNumber string, sealType string, appliedBy string, location string) (Seal, error) {
+	if sealNumber == "" {
+		return Seal{}, fmt.Errorf("Seal number cannot be empty")
+	}
+	now, err := txTime(APIstub)
+	if err != nil {
+		return Seal{}, err
+	}
+	return Seal{SealNumber: sealNumber, Type: sealType, AppliedBy: appliedBy, AppliedAt: location, Timestamp: now.UTC().Format(time.RFC3339), Status: sealIntactStatus}, nil
+}
+
+// recordSealIncident marks the Container's seal Broken and stores a Seal Broken incident for it.
+// The caller still has to write the Container.
+func recordSealIncident(APIstub shim.ChaincodeStubInterface, container *Container, reportedSealNumber string, reason string, reportedBy string) error {
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+
+	incident := SealIncident{ContainerId: container.HashId, ReportedSealNumber: reportedSealNumber, Reason: reason, ReportedBy: reportedBy, TxnId: APIstub.GetTxID(), Timestamp: now.UTC().Format(time.RFC3339)}
+	if container.Seal.SealNumber != "" {
+		incident.SealNumber = container.Seal.SealNumber
+		container.Seal.Status = "Broken"
+	}
+
+	// One transaction can record incidents for several containers, but only one per container.
+	incidentKey, err := APIstub.CreateCompositeKey(sealIncidentObjectType, []string{container.HashId, APIstub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	return putObject(APIstub, incidentKey, incident)
+}
+
+// verifySeal checks the seal number reported at a handover against the Container's intact seal.
+// A mismatch is recorded as an incident rather than failing the transaction, so that the evidence is kept.
+func verifySeal(APIstub shim.ChaincodeStubInterface, container *Container, reportedSealNumber string, reportedBy string) error {
+	if container.Seal.Status != sealIntactStatus {
+		return nil
+	}
+	if reportedSealNumber == "" {
+		return fmt.Errorf("Container %s is sealed. The seal number must be reported at handover", container.HashId)
+	}
+	if reportedSealNumber != container.Seal.SealNumber {
+		return recordSealIncident(APIstub, container, reportedSealNumber, "Seal number mismatch", reportedBy)
+	}
+	return nil
+}
+
+// verifyCargoSeals verifies the seals of every Container in a Cargo against reportedSeals (JSON object of container HashId to seal number).
+func verifyCargoSeals(APIstub shim.ChaincodeStubInterface, cargo Cargo, reportedSeals string, reportedBy string) error {
+	seals := map[string]string{}
+	if reportedSeals != "" {
+		if err := json.Unmarshal([]byte(reportedSeals), &seals); err != nil {
+			return fmt.Errorf("Failed to decode reported seals: %s", err.Error())
+		}
+	}
+
+	for _, containerHashId := range cargo.AssociatedContainerHashIds {
+		container, err := readContainer(APIstub, containerHashId)
+		if err != nil {
+			return err
+		}
+		if container.Seal.Status != sealIntactStatus {
+			continue
+		}
+		if err := verifySeal(APIstub, &container, seals[containerHashId], reportedBy); err != nil {
+			return err
+		}
+		if err := putObject(APIstub, containerHashId, container); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assertSensorOrCustodian checks who may report a sensor reading: a registered IoT Sensor reporting as itself, or the custodian.
+// A custodian may report through a device that is not registered.
+func assertSensorOrCustodian(APIstub shim.ChaincodeStubInterface, sensorId string, custodian string) error {
+	if sensor, err := readParticipant(APIstub, sensorId); err != nil || sensor.Role != sensorRole {
+		if err := assertCallerActsFor(APIstub, custodian); err != nil {
+			return fmt.Errorf("%s is not a registered %s and the caller is not the custodian: %s", sensorId, sensorRole, err.Error())
+		}
+		return nil
+	}
+	if err := assertCallerActsForAny(APIstub, sensorId, custodian); err != nil {
+		return err
+	}
+	return assertNotSuspended(APIstub, sensorId)
+}
+
+// optionalArg returns args[index], or "" when the optional argument was not passed.
+func optionalArg(args []string, index int) string {
+	if len(args) > index {
+		return args[index]
+	}
+	return ""
+}
+
+// applyContainerSeal - args: containerHashId, sealNumber, sealType, appliedBy, location. Reseals a Container whose seal was removed or broken.
+// Only the Container's owner can reseal it, and the caller must act for the owner.
+func (s *SmartContract) applyContainerSeal(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if container.Seal.Status == sealIntactStatus {
+		return shim.Error("Container already has an intact seal " + container.Seal.SealNumber)
+	} else if args[3] != container.Owner {
+		return shim.Error("Only the Container's owner can reseal it")
+	}
+	if err := assertCallerActsFor(APIstub, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	container.Seal, err = newSeal(APIstub, args[1], args[2], args[3], args[4])
+	if err != nil {
+		return shim.Error("Failed to apply seal: " + err.Error())
+	}
+	container.OpeningAuthorizedBy = ""
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// authorizeContainerOpening - args: containerHashId, participant. Allows the next door opening; only the owner or a Customs Officer may authorize it,
+// and the caller must act for the participant.
+func (s *SmartContract) authorizeContainerOpening(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	participant, err := readParticipant(APIstub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if args[1] != container.Owner && participant.Role != customsOfficerRole {
+		return shim.Error("Only the Container's owner or a " + customsOfficerRole + " can authorize opening it")
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	container.OpeningAuthorizedBy = args[1]
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// recordContainerDoorEvent - args: containerHashId, timestamp, sensorId. IOT door-open event; without an authorized opening it is a Seal Broken incident.
+// The caller must be the registered sensor itself or act for the Container's custodian.
+func (s *SmartContract) recordContainerDoorEvent(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := assertSensorOrCustodian(APIstub, args[2], container.Owner); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if container.OpeningAuthorizedBy != "" {
+		// An authorized opening uses up the authorization and the seal.
+		container.OpeningAuthorizedBy = ""
+		if container.Seal.Status == sealIntactStatus {
+			container.Seal.Status = "Removed"
+		}
+	} else if err := recordSealIncident(APIstub, &container, "", "Door opened without authorization at "+args[1], args[2]); err != nil {
+		return shim.Error("Failed to record seal incident: " + err.Error())
+	}
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getSealIncidents - args: containerHashId
+func (s *SmartContract) getSealIncidents(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type ContainerSealIncidents struct {
+		Incidents []SealIncident `json:"incidents"`
+	}
+	var containerSealIncidents ContainerSealIncidents
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	incidentsIterator, err := APIstub.GetStateByPartialCompositeKey(sealIncidentObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer incidentsIterator.Close()
+
+	for incidentsIterator.HasNext() {
+		incidentAsKV, err := incidentsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		incident := SealIncident{}
+		if err := json.Unmarshal(incidentAsKV.Value, &incident); err != nil {
+			return shim.Error("Failed to decode seal incident: " + err.Error())
+		}
+		containerSealIncidents.Incidents = append(containerSealIncidents.Incidents, incident)
+	}
+
+	containerSealIncidentsAsBytes, _ := json.Marshal(containerSealIncidents)
+	return shim.Success(containerSealIncidentsAsBytes)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRecordContainerDoorEventCallers(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CUSTODIAN", "Transporter")
+	stub.registerTestParticipant(testMspId, "SENSOR-1", sensorRole)
+	stub.registerTestParticipant(testMspId, "SENSOR-2", sensorRole)
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Importer")
+	stub.seedTestRecord("Container", "C1", "CUSTODIAN", Container{HashId: "C1", Owner: "CUSTODIAN", Status: "In-Transit", Seal: Seal{SealNumber: "S1", Status: sealIntactStatus}})
+
+	tests := []struct {
+		name     string
+		caller   string
+		sensorId string
+		reason   string
+	}{
+		{"outsider naming a sensor", "OUTSIDER", "SENSOR-1", "does not act for any of SENSOR-1, CUSTODIAN"},
+		{"sensor reporting as another sensor", "SENSOR-2", "SENSOR-1", "does not act for any of SENSOR-1, CUSTODIAN"},
+		{"outsider naming an unregistered sensor", "OUTSIDER", "SENSOR-9", "is not a registered IoT Sensor"},
+		{"sensor that is not an IoT Sensor", "OUTSIDER", "OUTSIDER", "is not a registered IoT Sensor"},
+		{"registered sensor", "SENSOR-1", "SENSOR-1", ""},
+		{"custodian with its own device", "CUSTODIAN", "GATE-CAM", ""},
+	}
+	for _, test := range tests {
+		stub.asParticipant(testMspId, test.caller)
+		if test.reason != "" {
+			stub.mustFail(test.reason, "recordContainerDoorEvent", "C1", "2020-03-01T10:00:00Z", test.sensorId)
+		} else {
+			stub.mustInvoke("recordContainerDoorEvent", "C1", "2020-03-01T10:00:00Z", test.sensorId)
+		}
+	}
+
+	var incidents struct {
+		Incidents []SealIncident `json:"incidents"`
+	}
+	json.Unmarshal(stub.mustInvoke("getSealIncidents", "C1"), &incidents)
+	if len(incidents.Incidents) != 2 {
+		t.Errorf("recorded %d seal incidents, want 2", len(incidents.Incidents))
+	}
+}
+
+func TestApplyContainerSealCallers(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "OWNER", "Transporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+	stub.seedTestRecord("Container", "C1", "OWNER", Container{HashId: "C1", Owner: "OWNER", Status: "In-Transit", Seal: Seal{SealNumber: "S1", Status: "Broken"}})
+
+	// A broken seal must not be hidden under a fresh one by anyone but the owner.
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("Only the Container's owner can reseal it", "applyContainerSeal", "C1", "S2", "Bolt", "OUTSIDER", "Mumbai")
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant OWNER", "applyContainerSeal", "C1", "S2", "Bolt", "OWNER", "Mumbai")
+	stub.asParticipant(testMspId, "OWNER").mustInvoke("applyContainerSeal", "C1", "S2", "Bolt", "OWNER", "Mumbai")
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.Seal.SealNumber != "S2" || container.Seal.Status != sealIntactStatus || container.Seal.AppliedBy != "OWNER" {
+		t.Errorf("seal = %+v, want S2 Intact applied by OWNER", container.Seal)
+	}
+}
+
+func TestAuthorizeContainerOpeningCallers(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "OWNER", "Transporter")
+	stub.registerTestParticipant(testMspId, "OFFICER", customsOfficerRole)
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+	stub.seedTestRecord("Container", "C1", "OWNER", Container{HashId: "C1", Owner: "OWNER", Status: "In-Transit", Seal: Seal{SealNumber: "S1", Status: sealIntactStatus}})
+
+	tests := []struct {
+		caller      string
+		participant string
+		reason      string
+	}{
+		{"OUTSIDER", "OUTSIDER", "Only the Container's owner or a Customs Officer"},
+		{"OUTSIDER", "OWNER", "not participant OWNER"},
+		{"OUTSIDER", "OFFICER", "not participant OFFICER"},
+		{"OFFICER", "OFFICER", ""},
+		{"OWNER", "OWNER", ""},
+	}
+	for _, test := range tests {
+		stub.asParticipant(testMspId, test.caller)
+		if test.reason != "" {
+			stub.mustFail(test.reason, "authorizeContainerOpening", "C1", test.participant)
+		} else {
+			stub.mustInvoke("authorizeContainerOpening", "C1", test.participant)
+		}
+	}
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.OpeningAuthorizedBy != "OWNER" {
+		t.Errorf("opening authorized by %q, want OWNER", container.OpeningAuthorizedBy)
+	}
+}
+
+func TestLoadAndUnloadContainerCallers(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "OWNER", "Transporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+	stub.seedTestRecord("Container", "C1", "OWNER", Container{HashId: "C1", Owner: "OWNER", Status: "Available"})
+
+	load := func(appliedBy string) []string {
+		return []string{"C1", "2020-03-01T09:00:00Z", "Loaded", "Tea", "Pending", "Mumbai", "Rotterdam", "Mumbai", "S1", "Bolt", appliedBy}
+	}
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant OWNER", "loadContainerWithPackages", load("OUTSIDER")...)
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant OWNER", "loadContainerWithPackages", load("OWNER")...)
+	stub.asParticipant(testMspId, "OWNER").mustFail("Only the Container's owner can seal it", "loadContainerWithPackages", load("OUTSIDER")...)
+	stub.asParticipant(testMspId, "OWNER").mustInvoke("loadContainerWithPackages", load("OWNER")...)
+
+	stub.seedTestRecord("Container", "C1", "OWNER", Container{HashId: "C1", Owner: "OWNER", Status: "InCargo", CargoId: "CG1", Seal: Seal{SealNumber: "S1", Status: sealIntactStatus}})
+	stub.seedTestRecord("Container", "C2", "OUTSIDER", Container{HashId: "C2", Owner: "OUTSIDER", Status: "InCargo", CargoId: "CG2"})
+	stub.seedTestRecord("Cargo", "CG1", "OWNER", Cargo{HashId: "CG1", Owner: "OWNER", Status: "Arrived", AssociatedContainerHashIds: []string{"C1"}})
+	stub.seedTestRecord("Cargo", "CG2", "OUTSIDER", Cargo{HashId: "CG2", Owner: "OUTSIDER", Status: "Arrived", AssociatedContainerHashIds: []string{"C2"}})
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant OWNER", "unloadContainerFromCargo", "CG1", "C1", "S1")
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("Container C1 is not in Cargo CG2", "unloadContainerFromCargo", "CG2", "C1", "S1")
+	stub.asParticipant(testMspId, "OWNER").mustInvoke("unloadContainerFromCargo", "CG1", "C1", "S1")
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.Status != "Unloaded" {
+		t.Errorf("container is %s, want Unloaded", container.Status)
+	}
+}
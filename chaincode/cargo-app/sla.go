@@ -0,0 +1,446 @@
+/*
+ * Shipment-level SLAs:
+ * An SLA attached to a Cargo promises departure and arrival windows, a maximum dwell at any
+ * one location while in transit and a temperature range. It is evaluated against the
+ * transaction time whenever the Cargo's status, coordinates or telemetry are updated, and
+ * every breach is recorded with its penalty in ledger units. An SLA is proposed by the Cargo's owner
+ * or by its carrier and only comes into force when the other accepts it, and so does every change to it.
+ * Departing or arriving outside
+ * either end of its window is a breach, charged at the late penalty rate. Telemetry is accepted from
+ * registered IoT Sensors reporting as themselves, or from the Cargo's custodian.
+ * Breach Types --> Early Departure, Late Departure, Early Arrival, Late Arrival, Excess Dwell, Temperature Excursion.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const (
+	slaObjectType         = "Sla"
+	slaProposalObjectType = "SlaProposal"
+	slaBreachObjectType   = "SlaBreach"
+)
+
+// Sla is the agreement for one Cargo. Window bounds are RFC3339 timestamps; empty bounds and zero limits are not enforced.
+// The fields after TemperaturePenalty track the Cargo as it moves and are maintained by the chaincode.
+type Sla struct {
+	CargoId             string   `json:"cargoId"`
+	Carrier             string   `json:"carrier"`
+	DepartureFrom       string   `json:"departureFrom"`
+	DepartureTo         string   `json:"departureTo"`
+	ArrivalFrom         string   `json:"arrivalFrom"`
+	ArrivalTo           string   `json:"arrivalTo"`
+	MaxDwellHours       int64    `json:"maxDwellHours"`
+	MinTemperature      *float64 `json:"minTemperature"`
+	MaxTemperature      *float64 `json:"maxTemperature"`
+	LatePenaltyPerHour  int64    `json:"latePenaltyPerHour"`
+	DwellPenaltyPerHour int64    `json:"dwellPenaltyPerHour"`
+	TemperaturePenalty  int64    `json:"temperaturePenalty"`
+	MaxPenalty          int64    `json:"maxPenalty"`
+	ProposedBy          string   `json:"proposedBy"`
+	AcceptedBy          string   `json:"acceptedBy"`
+	DepartedAt          string   `json:"departedAt"`
+	ArrivedAt           string   `json:"arrivedAt"`
+	CurrentLocation     string   `json:"currentLocation"`
+	LocationSince       string   `json:"locationSince"`
+	DwellBreached       bool     `json:"dwellBreached"`
+	InExcursion         bool     `json:"inExcursion"`
+	TotalPenalty        int64    `json:"totalPenalty"`
+	SchemaVersion       int      `json:"schemaVersion"`
+}
+
+type SlaBreach struct {
+	BreachId      string `json:"breachId"`
+	CargoId       string `json:"cargoId"`
+	Type          string `json:"type"`
+	Detail        string `json:"detail"`
+	Penalty       int64  `json:"penalty"`
+	DetectedAt    string `json:"detectedAt"`
+	TxnId         string `json:"txnId"`
+	SchemaVersion int    `json:"schemaVersion"`
+}
+
+// readSla loads the SLA in force for a Cargo.
+func readSla(APIstub shim.ChaincodeStubInterface, cargoHashId string) (*Sla, string, error) {
+	return readSlaRecord(APIstub, slaObjectType, cargoHashId)
+}
+
+// readSlaProposal loads the SLA proposed for a Cargo and not yet accepted.
+func readSlaProposal(APIstub shim.ChaincodeStubInterface, cargoHashId string) (*Sla, string, error) {
+	return readSlaRecord(APIstub, slaProposalObjectType, cargoHashId)
+}
+
+func readSlaRecord(APIstub shim.ChaincodeStubInterface, objectType string, cargoHashId string) (*Sla, string, error) {
+	slaKey, err := APIstub.CreateCompositeKey(objectType, []string{cargoHashId})
+	if err != nil {
+		return nil, "", err
+	}
+	slaAsBytes, err := APIstub.GetState(slaKey)
+	if err != nil || slaAsBytes == nil {
+		return nil, slaKey, err
+	}
+
+	sla := Sla{}
+	err = unmarshalRecord(slaObjectType, slaAsBytes, &sla)
+	return &sla, slaKey, err
+}
+
+// setCargoSla - args: cargoHashId, sla (JSON). Proposes an agreement, or a change to the one in force, replacing any earlier
+// proposal. Only the Cargo's owner or its carrier, the carrier of its Voyage, of the agreement in force or of the pending proposal,
+// may propose it, and a carrier only for itself. The other party has to accept it with acceptCargoSla.
+func (s *SmartContract) setCargoSla(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Ready" {
+		return shim.Error("An SLA can only be set while the Cargo is Ready")
+	}
+
+	carriers := []string{}
+	if cargo.VoyageId != "" {
+		voyage, _, err := readVoyage(APIstub, cargo.VoyageId)
+		if err != nil {
+			return shim.Error("Failed to get voyage: " + err.Error())
+		} else if voyage != nil {
+			carriers = append(carriers, voyage.Carrier)
+		}
+	}
+	current, _, err := readSla(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get SLA: " + err.Error())
+	} else if current != nil {
+		carriers = append(carriers, current.Carrier)
+	}
+	// The carrier named in a pending proposal may answer it with one of its own.
+	pending, _, err := readSlaProposal(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get SLA proposal: " + err.Error())
+	} else if pending != nil {
+		carriers = append(carriers, pending.Carrier)
+	}
+	if err := assertCallerActsForAny(APIstub, append([]string{cargo.Owner}, carriers...)...); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	sla := Sla{}
+	if err := json.Unmarshal([]byte(args[1]), &sla); err != nil {
+		return shim.Error("Failed to decode SLA: " + err.Error())
+	} else if sla.Carrier == "" {
+		return shim.Error("SLA must name its carrier")
+	}
+	proposedBy := cargo.Owner
+	if assertCallerActsFor(APIstub, cargo.Owner) != nil {
+		if err := assertCallerActsFor(APIstub, sla.Carrier); err != nil || !contains(carriers, sla.Carrier) {
+			return shim.Error("A carrier can only propose an SLA that it carries itself")
+		}
+		proposedBy = sla.Carrier
+	}
+	for _, bound := range []string{sla.DepartureFrom, sla.DepartureTo, sla.ArrivalFrom, sla.ArrivalTo} {
+		if _, err := parseOptionalTime(bound); err != nil {
+			return shim.Error("SLA windows must be in RFC3339 format: " + err.Error())
+		}
+	}
+	if sla.MinTemperature != nil && sla.MaxTemperature != nil && *sla.MinTemperature > *sla.MaxTemperature {
+		return shim.Error("SLA minTemperature is above maxTemperature")
+	}
+	// A negative penalty would pay the carrier for breaching the agreement.
+	if sla.LatePenaltyPerHour < 0 || sla.DwellPenaltyPerHour < 0 || sla.TemperaturePenalty < 0 || sla.MaxPenalty < 0 {
+		return shim.Error("SLA penalties cannot be negative")
+	}
+
+	// Tracking starts from scratch whatever the caller sent.
+	sla = Sla{CargoId: args[0], Carrier: sla.Carrier, DepartureFrom: sla.DepartureFrom, DepartureTo: sla.DepartureTo, ArrivalFrom: sla.ArrivalFrom, ArrivalTo: sla.ArrivalTo, MaxDwellHours: sla.MaxDwellHours, MinTemperature: sla.MinTemperature, MaxTemperature: sla.MaxTemperature, LatePenaltyPerHour: sla.LatePenaltyPerHour, DwellPenaltyPerHour: sla.DwellPenaltyPerHour, TemperaturePenalty: sla.TemperaturePenalty, MaxPenalty: sla.MaxPenalty, ProposedBy: proposedBy}
+
+	proposalKey, err := APIstub.CreateCompositeKey(slaProposalObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putObject(APIstub, proposalKey, sla); err != nil {
+		return shim.Error("Failed to record SLA proposal: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// acceptCargoSla - args: cargoHashId, participant. Puts the proposed SLA in force. The participant must be the other party to it:
+// the carrier for a proposal by the Cargo's owner, or the owner for one by the carrier. The caller must act for the participant.
+func (s *SmartContract) acceptCargoSla(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Ready" {
+		return shim.Error("An SLA can only be accepted while the Cargo is Ready")
+	}
+
+	proposal, proposalKey, err := readSlaProposal(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get SLA proposal: " + err.Error())
+	} else if proposal == nil {
+		return shim.Error("No SLA proposed for Cargo " + args[0])
+	}
+
+	// The Cargo may have changed hands since the proposal; then its owner never made it.
+	counterparty := ""
+	if proposal.ProposedBy == cargo.Owner {
+		counterparty = proposal.Carrier
+	} else if proposal.ProposedBy == proposal.Carrier {
+		counterparty = cargo.Owner
+	} else {
+		return shim.Error("SLA was proposed by " + proposal.ProposedBy + ", who no longer owns the Cargo")
+	}
+	if args[1] != counterparty {
+		return shim.Error("Only " + counterparty + " can accept the SLA proposed by " + proposal.ProposedBy)
+	}
+	if err := assertCallerActsFor(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	proposal.AcceptedBy = args[1]
+
+	slaKey, err := APIstub.CreateCompositeKey(slaObjectType, []string{args[0]})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := putObject(APIstub, slaKey, proposal); err != nil {
+		return shim.Error("Failed to record SLA: " + err.Error())
+	}
+	if err := APIstub.DelState(proposalKey); err != nil {
+		return shim.Error("Failed to remove SLA proposal: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// recordCargoTelemetry - args: cargoHashId, timestamp, temperature, sensorId. As with container door events, the caller must be
+// the registered sensor itself or act for the Cargo's custodian.
+func (s *SmartContract) recordCargoTelemetry(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	temperature, err := strconv.ParseFloat(args[2], 64)
+	if err != nil {
+		return shim.Error("Temperature must be a number: " + err.Error())
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertSensorOrCustodian(APIstub, args[3], cargo.Owner); err != nil {
+		return shim.Error(err.Error())
+	}
+	cargo.Timestamp = args[1]
+	cargo.Temperature = args[2]
+
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+	if err := evaluateCargoSla(APIstub, cargo, &temperature); err != nil {
+		return shim.Error("Failed to evaluate SLA: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// evaluateCargoSla checks the Cargo's latest state against its SLA, if it has one, and records any new breaches.
+// temperature is nil unless the update carried a telemetry reading.
+func evaluateCargoSla(APIstub shim.ChaincodeStubInterface, cargo Cargo, temperature *float64) error {
+
+	sla, slaKey, err := readSla(APIstub, cargo.HashId)
+	if err != nil || sla == nil {
+		return err
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return err
+	}
+	nowAsString := now.Format(time.RFC3339)
+	inTransit := sla.DepartedAt != "" && sla.ArrivedAt == ""
+
+	var breaches []SlaBreach
+
+	if cargo.Status == "In-Transit" && sla.DepartedAt == "" {
+		sla.DepartedAt = nowAsString
+		if early, _ := earlyBy(now, sla.DepartureFrom); early > 0 {
+			breaches = append(breaches, SlaBreach{Type: "Early Departure", Detail: "Departed " + early.String() + " before " + sla.DepartureFrom, Penalty: hoursCeil(early) * sla.LatePenaltyPerHour})
+		}
+		if late, _ := lateBy(now, sla.DepartureTo); late > 0 {
+			breaches = append(breaches, SlaBreach{Type: "Late Departure", Detail: "Departed " + late.String() + " after " + sla.DepartureTo, Penalty: hoursCeil(late) * sla.LatePenaltyPerHour})
+		}
+	}
+
+	if cargo.Status == "Arrived" && sla.ArrivedAt == "" {
+		sla.ArrivedAt = nowAsString
+		if early, _ := earlyBy(now, sla.ArrivalFrom); early > 0 {
+			breaches = append(breaches, SlaBreach{Type: "Early Arrival", Detail: "Arrived " + early.String() + " before " + sla.ArrivalFrom, Penalty: hoursCeil(early) * sla.LatePenaltyPerHour})
+		}
+		if late, _ := lateBy(now, sla.ArrivalTo); late > 0 {
+			breaches = append(breaches, SlaBreach{Type: "Late Arrival", Detail: "Arrived " + late.String() + " after " + sla.ArrivalTo, Penalty: hoursCeil(late) * sla.LatePenaltyPerHour})
+		}
+	}
+
+	// Dwell only counts between departure and arrival; a breach is recorded once per location. The time held at the
+	// current location is checked before a move to a new one starts the count again.
+	if sla.MaxDwellHours > 0 && inTransit && !sla.DwellBreached {
+		since, err := time.Parse(time.RFC3339, sla.LocationSince)
+		if departed, _ := time.Parse(time.RFC3339, sla.DepartedAt); err == nil && departed.After(since) {
+			since = departed
+		}
+		if err == nil {
+			if excess := now.Sub(since) - time.Duration(sla.MaxDwellHours)*time.Hour; excess > 0 {
+				sla.DwellBreached = true
+				breaches = append(breaches, SlaBreach{Type: "Excess Dwell", Detail: fmt.Sprintf("Held at %s for more than %d hours", sla.CurrentLocation, sla.MaxDwellHours), Penalty: hoursCeil(excess) * sla.DwellPenaltyPerHour})
+			}
+		}
+	}
+	if cargo.CargoLocation != sla.CurrentLocation {
+		sla.CurrentLocation = cargo.CargoLocation
+		sla.LocationSince = nowAsString
+		sla.DwellBreached = false
+	}
+
+	// A breach is recorded when a reading first leaves the range, not for every reading outside it.
+	if temperature != nil {
+		outOfRange := (sla.MinTemperature != nil && *temperature < *sla.MinTemperature) || (sla.MaxTemperature != nil && *temperature > *sla.MaxTemperature)
+		if outOfRange && !sla.InExcursion {
+			breaches = append(breaches, SlaBreach{Type: "Temperature Excursion", Detail: fmt.Sprintf("Temperature %g outside agreed range", *temperature), Penalty: sla.TemperaturePenalty})
+		}
+		sla.InExcursion = outOfRange
+	}
+
+	for index, breach := range breaches {
+		// Penalties stop accruing once the agreed cap is reached.
+		if sla.MaxPenalty > 0 && sla.TotalPenalty+breach.Penalty > sla.MaxPenalty {
+			breach.Penalty = sla.MaxPenalty - sla.TotalPenalty
+		}
+		sla.TotalPenalty += breach.Penalty
+
+		breach.BreachId = fmt.Sprintf("%s-%d", APIstub.GetTxID(), index)
+		breach.CargoId = cargo.HashId
+		breach.DetectedAt = nowAsString
+		breach.TxnId = APIstub.GetTxID()
+
+		breachKey, err := APIstub.CreateCompositeKey(slaBreachObjectType, []string{cargo.HashId, breach.BreachId})
+		if err != nil {
+			return err
+		}
+		if err := putObject(APIstub, breachKey, breach); err != nil {
+			return err
+		}
+	}
+
+	return putObject(APIstub, slaKey, sla)
+}
+
+// getSlaReport - args: cargoHashId. Returns the SLA with all breaches recorded against it and the total penalty,
+// and any change proposed to it that has not been accepted yet.
+func (s *SmartContract) getSlaReport(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	type SlaReport struct {
+		Sla          Sla         `json:"sla"`
+		Proposal     *Sla        `json:"proposal,omitempty"`
+		Breaches     []SlaBreach `json:"breaches"`
+		TotalPenalty int64       `json:"totalPenalty"`
+	}
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	sla, _, err := readSla(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get SLA: " + err.Error())
+	}
+	proposal, _, err := readSlaProposal(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get SLA proposal: " + err.Error())
+	} else if sla == nil && proposal == nil {
+		return shim.Error("No SLA for Cargo " + args[0])
+	} else if sla == nil {
+		sla = &Sla{CargoId: args[0]}
+	}
+
+	breaches, err := getSlaBreaches(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	slaReportAsBytes, _ := json.Marshal(SlaReport{Sla: *sla, Proposal: proposal, Breaches: breaches, TotalPenalty: sla.TotalPenalty})
+	return shim.Success(slaReportAsBytes)
+}
+
+func getSlaBreaches(APIstub shim.ChaincodeStubInterface, cargoHashId string) ([]SlaBreach, error) {
+	breaches := []SlaBreach{}
+
+	breachesIterator, err := APIstub.GetStateByPartialCompositeKey(slaBreachObjectType, []string{cargoHashId})
+	if err != nil {
+		return nil, err
+	}
+	defer breachesIterator.Close()
+
+	for breachesIterator.HasNext() {
+		aKeyValue, err := breachesIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		var breach SlaBreach
+		json.Unmarshal(aKeyValue.Value, &breach)
+		breaches = append(breaches, breach)
+	}
+	return breaches, nil
+}
+
+// lateBy returns how long after the deadline now is, or zero if there is no deadline or it has not passed.
+func lateBy(now time.Time, deadline string) (time.Duration, error) {
+	due, err := parseOptionalTime(deadline)
+	if err != nil || due.IsZero() || !now.After(due) {
+		return 0, err
+	}
+	return now.Sub(due), nil
+}
+
+// earlyBy returns how long before the start of a window now is, or zero if the window has no start or it has begun.
+func earlyBy(now time.Time, start string) (time.Duration, error) {
+	from, err := parseOptionalTime(start)
+	if err != nil || from.IsZero() || !now.Before(from) {
+		return 0, err
+	}
+	return from.Sub(now), nil
+}
+
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// hoursCeil counts every started hour.
+func hoursCeil(duration time.Duration) int64 {
+	return int64(math.Ceil(duration.Hours()))
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWindowBounds(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		bound string
+		early time.Duration
+		late  time.Duration
+	}{
+		{"", 0, 0},
+		{"2020-03-10T12:00:00Z", 0, 0},
+		{"2020-03-10T14:30:00Z", 150 * time.Minute, 0},
+		{"2020-03-10T09:00:00Z", 0, 3 * time.Hour},
+	}
+	for _, test := range tests {
+		early, err := earlyBy(now, test.bound)
+		if err != nil || early != test.early {
+			t.Errorf("earlyBy(%q) = %v, %v; want %v", test.bound, early, err, test.early)
+		}
+		late, err := lateBy(now, test.bound)
+		if err != nil || late != test.late {
+			t.Errorf("lateBy(%q) = %v, %v; want %v", test.bound, late, err, test.late)
+		}
+	}
+
+	if _, err := earlyBy(now, "10/03/2020"); err == nil {
+		t.Error("earlyBy accepted a bound that is not RFC3339")
+	}
+}
+
+func TestSlaWindowBreaches(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		sla     Sla
+		breach  string
+		penalty int64
+	}{
+		{"early departure", "In-Transit", Sla{DepartureFrom: "2020-03-01T10:00:00Z", LatePenaltyPerHour: 10}, "Early Departure", 20},
+		{"late departure", "In-Transit", Sla{DepartureTo: "2020-03-01T07:30:00Z", LatePenaltyPerHour: 10}, "Late Departure", 10},
+		{"departure in window", "In-Transit", Sla{DepartureFrom: "2020-03-01T07:00:00Z", DepartureTo: "2020-03-01T09:00:00Z", LatePenaltyPerHour: 10}, "", 0},
+		{"early arrival", "Arrived", Sla{ArrivalFrom: "2020-03-02T08:00:00Z", LatePenaltyPerHour: 1}, "Early Arrival", 24},
+		{"late arrival", "Arrived", Sla{ArrivalTo: "2020-02-29T08:00:00Z", LatePenaltyPerHour: 1}, "Late Arrival", 24},
+	}
+	for _, test := range tests {
+		stub := newTestStub(t)
+		cargo := Cargo{HashId: "CG1", Status: test.status, AssociatedContainerHashIds: []string{}}
+		sla := test.sla
+		sla.CargoId = "CG1"
+		if test.status == "Arrived" {
+			sla.DepartedAt = "2020-02-20T00:00:00Z"
+		}
+
+		var breaches []SlaBreach
+		err := stub.run(func() error {
+			slaKey, _ := stub.CreateCompositeKey(slaObjectType, []string{"CG1"})
+			if err := putObject(stub, slaKey, sla); err != nil {
+				return err
+			}
+			if err := evaluateCargoSla(stub, cargo, nil); err != nil {
+				return err
+			}
+			var err error
+			breaches, err = getSlaBreaches(stub, "CG1")
+			return err
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if test.breach == "" {
+			if len(breaches) != 0 {
+				t.Errorf("%s: breaches = %v, want none", test.name, breaches)
+			}
+			continue
+		}
+		if len(breaches) != 1 || breaches[0].Type != test.breach || breaches[0].Penalty != test.penalty {
+			t.Errorf("%s: breaches = %v, want one %s of %d", test.name, breaches, test.breach, test.penalty)
+		}
+	}
+}
+
+func TestSetCargoSlaCallers(t *testing.T) {
+	stub := newTestStub(t)
+	for hashId, role := range map[string]string{"SHIPPER": "Exporter", "CARRIER": "Transporter", "OTHER": "Transporter"} {
+		stub.registerTestParticipant(testMspId, hashId, role)
+	}
+	stub.seedTestRecord("Cargo", "CG1", "SHIPPER", Cargo{HashId: "CG1", Owner: "SHIPPER", Status: "Ready", AssociatedContainerHashIds: []string{}})
+
+	report := func() (sla Sla, proposal *Sla) {
+		t.Helper()
+		var slaReport struct {
+			Sla      Sla  `json:"sla"`
+			Proposal *Sla `json:"proposal"`
+		}
+		if err := json.Unmarshal(stub.mustInvoke("getSlaReport", "CG1"), &slaReport); err != nil {
+			t.Fatal(err)
+		}
+		return slaReport.Sla, slaReport.Proposal
+	}
+
+	sla, _ := json.Marshal(Sla{Carrier: "CARRIER", ArrivalTo: "2020-03-20T00:00:00Z", LatePenaltyPerHour: 5})
+	stub.asParticipant(testMspId, "CARRIER").mustFail("does not act for any of SHIPPER", "setCargoSla", "CG1", string(sla))
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("setCargoSla", "CG1", string(sla))
+	// The carrier has not agreed to the owner's proposal yet, so nothing is in force.
+	if inForce, proposal := report(); inForce.Carrier != "" || proposal == nil || proposal.ProposedBy != "SHIPPER" {
+		t.Fatalf("after proposal SLA = %+v, proposal = %+v; want only SHIPPER's proposal", inForce, proposal)
+	}
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("Only CARRIER can accept the SLA proposed by SHIPPER", "acceptCargoSla", "CG1", "SHIPPER")
+	stub.asParticipant(testMspId, "OTHER").mustFail("not participant CARRIER", "acceptCargoSla", "CG1", "CARRIER")
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("acceptCargoSla", "CG1", "CARRIER")
+
+	// Either party may propose a change, but it only comes into force when the other accepts it.
+	zeroed, _ := json.Marshal(Sla{Carrier: "CARRIER", ArrivalTo: "2020-03-21T00:00:00Z"})
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("setCargoSla", "CG1", string(zeroed))
+	if inForce, _ := report(); inForce.LatePenaltyPerHour != 5 || inForce.AcceptedBy != "CARRIER" {
+		t.Errorf("carrier's proposal changed the SLA in force to %+v", inForce)
+	}
+	stub.asParticipant(testMspId, "CARRIER").mustFail("Only SHIPPER can accept the SLA proposed by CARRIER", "acceptCargoSla", "CG1", "CARRIER")
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("acceptCargoSla", "CG1", "SHIPPER")
+	if inForce, proposal := report(); inForce.ArrivalTo != "2020-03-21T00:00:00Z" || inForce.LatePenaltyPerHour != 0 || proposal != nil {
+		t.Errorf("after acceptance SLA = %+v, proposal = %+v; want the carrier's change in force", inForce, proposal)
+	}
+	stub.asParticipant(testMspId, "SHIPPER").mustFail("No SLA proposed", "acceptCargoSla", "CG1", "SHIPPER")
+
+	// Nobody else can propose, nor can the carrier propose on behalf of another.
+	hijacked, _ := json.Marshal(Sla{Carrier: "OTHER", LatePenaltyPerHour: 0})
+	stub.asParticipant(testMspId, "OTHER").mustFail("does not act for any of SHIPPER, CARRIER", "setCargoSla", "CG1", string(hijacked))
+	stub.asParticipant(testMspId, "CARRIER").mustFail("A carrier can only propose an SLA that it carries itself", "setCargoSla", "CG1", string(hijacked))
+}
+
+func TestSetCargoSlaRejectsNegativePenalties(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "SHIPPER", "Exporter")
+	stub.seedTestRecord("Cargo", "CG1", "SHIPPER", Cargo{HashId: "CG1", Owner: "SHIPPER", Status: "Ready", AssociatedContainerHashIds: []string{}})
+
+	stub.asParticipant(testMspId, "SHIPPER")
+	for _, sla := range []Sla{{LatePenaltyPerHour: -5}, {DwellPenaltyPerHour: -1}, {TemperaturePenalty: -100}, {MaxPenalty: -1}} {
+		sla.Carrier = "CARRIER"
+		slaAsBytes, _ := json.Marshal(sla)
+		stub.mustFail("penalties cannot be negative", "setCargoSla", "CG1", string(slaAsBytes))
+	}
+}
+
+func TestSlaDwellCheckedBeforeMoving(t *testing.T) {
+	stub := newTestStub(t)
+	sla := Sla{CargoId: "CG1", MaxDwellHours: 24, DwellPenaltyPerHour: 1, DepartedAt: "2020-02-25T00:00:00Z", CurrentLocation: "Colombo", LocationSince: "2020-02-26T20:00:00Z"}
+	// The stub's clock is at 2020-03-01T08:00:00Z, 84 hours after the Cargo reached Colombo.
+	cargo := Cargo{HashId: "CG1", Status: "In-Transit", CargoLocation: "Singapore", AssociatedContainerHashIds: []string{}}
+
+	var breaches []SlaBreach
+	err := stub.run(func() error {
+		slaKey, _ := stub.CreateCompositeKey(slaObjectType, []string{"CG1"})
+		if err := putObject(stub, slaKey, sla); err != nil {
+			return err
+		}
+		if err := evaluateCargoSla(stub, cargo, nil); err != nil {
+			return err
+		}
+		var err error
+		breaches, err = getSlaBreaches(stub, "CG1")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(breaches) != 1 || breaches[0].Type != "Excess Dwell" || breaches[0].Penalty != 60 {
+		t.Errorf("breaches = %+v, want one Excess Dwell at Colombo of 60", breaches)
+	}
+}
+
+func TestRecordCargoTelemetryCallers(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "CARRIER", "Transporter")
+	stub.registerTestParticipant(testMspId, "SENSOR-1", sensorRole)
+	stub.registerTestParticipant(testMspId, "SENSOR-2", sensorRole)
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Importer")
+	stub.seedTestRecord("Cargo", "CG1", "CARRIER", Cargo{HashId: "CG1", Owner: "CARRIER", Status: "In-Transit", AssociatedContainerHashIds: []string{}})
+
+	tests := []struct {
+		name     string
+		caller   string
+		sensorId string
+		reason   string
+	}{
+		{"outsider naming a sensor", "OUTSIDER", "SENSOR-1", "does not act for any of SENSOR-1, CARRIER"},
+		{"sensor reporting as another sensor", "SENSOR-2", "SENSOR-1", "does not act for any of SENSOR-1, CARRIER"},
+		{"outsider naming an unregistered sensor", "OUTSIDER", "SENSOR-9", "is not a registered IoT Sensor"},
+		{"registered sensor", "SENSOR-1", "SENSOR-1", ""},
+		{"custodian with its own device", "CARRIER", "REEFER-PROBE", ""},
+	}
+	for _, test := range tests {
+		stub.asParticipant(testMspId, test.caller)
+		if test.reason != "" {
+			stub.mustFail(test.reason, "recordCargoTelemetry", "CG1", "2020-03-01T10:00:00Z", "4.5", test.sensorId)
+		} else {
+			stub.mustInvoke("recordCargoTelemetry", "CG1", "2020-03-01T10:00:00Z", "4.5", test.sensorId)
+		}
+	}
+}
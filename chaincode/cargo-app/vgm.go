@@ -0,0 +1,122 @@
+/*
+ * Verified Gross Mass (SOLAS VI/2):
+ * Each packed Container needs a VGM declaration before it can be put into a Cargo or the Cargo
+ * can move to In-Transit, and the declared mass must not exceed the Container's max gross weight.
+ * Reloading a Container or changing its loaded items invalidates its VGM, since the contents have changed.
+ * Weighing Methods --> Method 1 (packed container weighed), Method 2 (contents weighed and added to the tare).
+ */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Vgm is a Container's verified gross mass declaration. Weight is in whole kilograms.
+type Vgm struct {
+	Method           string `json:"method"`
+	Weight           string `json:"weight"`
+	ResponsibleParty string `json:"responsibleParty"`
+	SignatureHash    string `json:"signatureHash"`
+	DeclaredAt       string `json:"declaredAt"`
+	TxnId            string `json:"txnId"`
+}
+
+// assertValidVgm checks that a Container has a VGM declaration within its max gross weight.
+func assertValidVgm(container Container) error {
+	if container.Vgm.Weight == "" {
+		return fmt.Errorf("Container %s has no VGM declaration", container.HashId)
+	}
+	if container.MaxGrossWeight == "" {
+		// Containers registered without master data have no limit to check against.
+		return nil
+	}
+
+	weight, err := strconv.ParseInt(container.Vgm.Weight, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Container %s has an invalid VGM weight %s", container.HashId, container.Vgm.Weight)
+	}
+	maxGrossWeight, err := strconv.ParseInt(container.MaxGrossWeight, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Container %s has an invalid max gross weight %s", container.HashId, container.MaxGrossWeight)
+	}
+	if weight > maxGrossWeight {
+		return fmt.Errorf("Container %s VGM of %d kg exceeds its max gross weight of %d kg", container.HashId, weight, maxGrossWeight)
+	}
+	return nil
+}
+
+// assertContainersHaveVgm checks the VGM of every Container in containerHashIds.
+func assertContainersHaveVgm(APIstub shim.ChaincodeStubInterface, containerHashIds []string) error {
+	for _, containerHashId := range containerHashIds {
+		container, err := readContainer(APIstub, containerHashId)
+		if err != nil {
+			return err
+		}
+		if err := assertValidVgm(container); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// declareVGM - args: containerHashId, method (Method 1 or Method 2), weight (kg), responsibleParty, signatureHash (SHA-256 of the signed declaration)
+// The caller must act for the responsible party.
+func (s *SmartContract) declareVGM(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	if args[1] != "Method 1" && args[1] != "Method 2" {
+		return shim.Error("Invalid weighing method " + args[1] + ". Expecting Method 1 or Method 2")
+	}
+	weight, err := parseWeight("VGM weight", args[2])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := validateSha256Hex(args[4]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	container, err := readContainer(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if container.Status != "Loaded" && container.Status != "InCargo" {
+		return shim.Error("VGM can only be declared for a packed Container. Container status is " + container.Status)
+	}
+	if container.TareWeight != "" {
+		tareWeight, err := strconv.ParseInt(container.TareWeight, 10, 64)
+		if err == nil && weight < tareWeight {
+			return shim.Error("VGM cannot be less than the Container's tare weight of " + container.TareWeight + " kg")
+		}
+	}
+
+	if _, err := readParticipant(APIstub, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertCallerActsFor(APIstub, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err := assertNotSuspended(APIstub, args[3]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	now, err := txTime(APIstub)
+	if err != nil {
+		return shim.Error("Failed to get transaction timestamp: " + err.Error())
+	}
+
+	container.Vgm = Vgm{Method: args[1], Weight: strconv.FormatInt(weight, 10), ResponsibleParty: args[3], SignatureHash: args[4], DeclaredAt: now.UTC().Format(time.RFC3339), TxnId: APIstub.GetTxID()}
+
+	if err := putObject(APIstub, args[0], container); err != nil {
+		return shim.Error("Failed to update Container: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
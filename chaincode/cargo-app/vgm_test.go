@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestAssertValidVgm(t *testing.T) {
+	tests := []struct {
+		name      string
+		container Container
+		wantErr   bool
+	}{
+		{"within max gross weight", Container{MaxGrossWeight: "30480", Vgm: Vgm{Weight: "24000"}}, false},
+		{"at max gross weight", Container{MaxGrossWeight: "30480", Vgm: Vgm{Weight: "30480"}}, false},
+		{"over max gross weight", Container{MaxGrossWeight: "30480", Vgm: Vgm{Weight: "30481"}}, true},
+		{"no declaration", Container{MaxGrossWeight: "30480"}, true},
+		{"no master data", Container{Vgm: Vgm{Weight: "40000"}}, false},
+		{"unparsable weight", Container{MaxGrossWeight: "30480", Vgm: Vgm{Weight: "heavy"}}, true},
+	}
+	for _, test := range tests {
+		if err := assertValidVgm(test.container); (err != nil) != test.wantErr {
+			t.Errorf("%s: assertValidVgm() = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestDeclareVGM(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "SHIPPER", "Exporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Exporter")
+	stub.seedTestRecord("Container", "C1", "SHIPPER", Container{HashId: "C1", Owner: "SHIPPER", Status: "Loaded", TareWeight: "2200", MaxGrossWeight: "30480"})
+	stub.seedTestRecord("Container", "C2", "SHIPPER", Container{HashId: "C2", Owner: "SHIPPER", Status: "Available", TareWeight: "2200", MaxGrossWeight: "30480"})
+
+	signature := "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	stub.asParticipant(testMspId, "SHIPPER")
+	stub.mustFail("Invalid weighing method", "declareVGM", "C1", "Method 3", "24000", "SHIPPER", signature)
+	stub.mustFail("less than the Container's tare weight", "declareVGM", "C1", "Method 1", "2000", "SHIPPER", signature)
+	stub.mustFail("only be declared for a packed Container", "declareVGM", "C2", "Method 1", "24000", "SHIPPER", signature)
+	stub.mustFail("Participant does not exist", "declareVGM", "C1", "Method 1", "24000", "NOBODY", signature)
+	// A SOLAS declaration can only be filed by, or for, the party who signs it.
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant SHIPPER", "declareVGM", "C1", "Method 2", "24000", "SHIPPER", signature)
+	stub.asParticipant(testMspId, "SHIPPER")
+	stub.mustInvoke("declareVGM", "C1", "Method 2", "24000", "SHIPPER", signature)
+
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.Vgm.Weight != "24000" || container.Vgm.ResponsibleParty != "SHIPPER" || container.Vgm.TxnId == "" {
+		t.Errorf("VGM = %+v, want 24000 kg declared by SHIPPER", container.Vgm)
+	}
+	if err := assertValidVgm(container); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRepackingClearsVgm(t *testing.T) {
+	stub := newTestStub(t)
+	stub.registerTestParticipant(testMspId, "SHIPPER", "Exporter")
+	vgm := Vgm{Method: "Method 1", Weight: "24000", ResponsibleParty: "SHIPPER"}
+	stub.seedTestRecord("Container", "C1", "SHIPPER", Container{HashId: "C1", Owner: "SHIPPER", Status: "Loaded", LoadedItems: "Tea", MaxGrossWeight: "30480", Vgm: vgm})
+
+	stub.asParticipant(testMspId, "SHIPPER")
+	stub.mustInvoke("updateContainerAttributes", "C1", "2020-03-01T09:00:00Z", "Maersk", "Loaded", "Tea", "Pending", "Mumbai", "Rotterdam", "Nhava Sheva")
+	var container Container
+	stub.readTestRecord("C1", &container)
+	if container.Vgm != vgm {
+		t.Errorf("VGM after moving the Container = %+v, want it kept", container.Vgm)
+	}
+
+	stub.mustInvoke("updateContainerAttributes", "C1", "2020-03-01T10:00:00Z", "Maersk", "Loaded", "Tea, Coffee", "Pending", "Mumbai", "Rotterdam", "Nhava Sheva")
+	stub.readTestRecord("C1", &container)
+	if container.Vgm != (Vgm{}) {
+		t.Errorf("VGM after repacking the Container = %+v, want it cleared", container.Vgm)
+	}
+}
@@ -0,0 +1,506 @@
+/*
+ * Voyages:
+ * A Voyage is one trip of a vessel, flight, train or truck operated by a Transporter, calling at an
+ * ordered list of ports with planned and actual times of arrival and departure at each. Cargos are
+ * assigned to a Voyage, and the departure or arrival recorded at a port call moves every Cargo on the
+ * Voyage in the same transaction. Schedule changes and arrivals are emitted as chaincode events
+ * (VoyageScheduleChanged, VoyagePortCallArrived) so consignees can re-plan without polling.
+ * Only the carrier's organisation operates a Voyage; a Cargo's owner may also assign it to one.
+ * Transport Modes --> Sea, Air, Rail, Road.
+ * Voyage States --> Scheduled, Underway, Completed.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	sc "github.com/hyperledger/fabric/protos/peer"
+)
+
+const voyageObjectType = "Voyage"
+
+var imoNumberPattern = regexp.MustCompile(`^IMO[0-9]{7}$`)
+
+// PortCall is one stop of a Voyage. Planned times can be revised until the actual time is recorded.
+type PortCall struct {
+	Port       string `json:"port"`
+	PlannedEta string `json:"plannedEta"`
+	PlannedEtd string `json:"plannedEtd"`
+	ActualEta  string `json:"actualEta"`
+	ActualEtd  string `json:"actualEtd"`
+}
+
+type Voyage struct {
+	VoyageId      string     `json:"voyageId"`
+	Carrier       string     `json:"carrier"`
+	Mode          string     `json:"mode"`
+	VehicleId     string     `json:"vehicleId"`
+	PortCalls     []PortCall `json:"portCalls"`
+	CargoIds      []string   `json:"cargoIds"`
+	Status        string     `json:"status"`
+	SchemaVersion int        `json:"schemaVersion"`
+}
+
+// VoyageEvent is the payload of the chaincode events emitted for a Voyage.
+type VoyageEvent struct {
+	VoyageId    string   `json:"voyageId"`
+	Port        string   `json:"port"`
+	PreviousEta string   `json:"previousEta,omitempty"`
+	PreviousEtd string   `json:"previousEtd,omitempty"`
+	Eta         string   `json:"eta"`
+	Etd         string   `json:"etd"`
+	CargoIds    []string `json:"cargoIds"`
+}
+
+func readVoyage(APIstub shim.ChaincodeStubInterface, voyageId string) (*Voyage, string, error) {
+	voyageKey, err := APIstub.CreateCompositeKey(voyageObjectType, []string{voyageId})
+	if err != nil {
+		return nil, "", err
+	}
+	voyageAsBytes, err := APIstub.GetState(voyageKey)
+	if err != nil || voyageAsBytes == nil {
+		return nil, voyageKey, err
+	}
+
+	voyage := Voyage{}
+	err = unmarshalRecord(voyageObjectType, voyageAsBytes, &voyage)
+	return &voyage, voyageKey, err
+}
+
+// portCallIndex returns the position of port in the Voyage's port calls, or -1 if the Voyage does not call there.
+func (voyage *Voyage) portCallIndex(port string) int {
+	for i, portCall := range voyage.PortCalls {
+		if portCall.Port == port {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateImoNumber checks the IMO ship identification number check digit: the first six digits
+// weighted 7 down to 2, summed, modulo 10.
+func validateImoNumber(imoNumber string) error {
+	if !imoNumberPattern.MatchString(imoNumber) {
+		return fmt.Errorf("Vehicle id of a sea Voyage must be an IMO number such as IMO9074729")
+	}
+	sum := 0
+	for i := 0; i < 6; i++ {
+		sum += int(imoNumber[3+i]-'0') * (7 - i)
+	}
+	if sum%10 != int(imoNumber[9]-'0') {
+		return fmt.Errorf("IMO number %s has an invalid check digit", imoNumber)
+	}
+	return nil
+}
+
+// validatePortCalls checks that every port is called at once and that the planned times run forward.
+func validatePortCalls(portCalls []PortCall) error {
+	if len(portCalls) < 2 {
+		return fmt.Errorf("A Voyage needs at least two port calls")
+	}
+
+	var previous time.Time
+	seen := map[string]bool{}
+	for _, portCall := range portCalls {
+		if portCall.Port == "" || seen[portCall.Port] {
+			return fmt.Errorf("Port calls need distinct, non-empty ports")
+		}
+		seen[portCall.Port] = true
+
+		for _, planned := range []string{portCall.PlannedEta, portCall.PlannedEtd} {
+			at, err := parseOptionalTime(planned)
+			if err != nil {
+				return fmt.Errorf("Planned times at %s must be in RFC3339 format: %s", portCall.Port, err.Error())
+			}
+			if at.IsZero() {
+				continue
+			}
+			if at.Before(previous) {
+				return fmt.Errorf("Planned times at %s are earlier than the previous call", portCall.Port)
+			}
+			previous = at
+		}
+	}
+	return nil
+}
+
+// emitVoyageEvent sets the chaincode event of the transaction; Fabric keeps only one event per transaction.
+func emitVoyageEvent(APIstub shim.ChaincodeStubInterface, name string, event VoyageEvent) error {
+	eventAsBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return APIstub.SetEvent(name, eventAsBytes)
+}
+
+// assertCallerOperates checks that the caller works for the Voyage's carrier: the carrier itself, a participant of
+// its organisation, or an admin of its MSP.
+func (voyage *Voyage) assertCallerOperates(APIstub shim.ChaincodeStubInterface) error {
+	carrier, err := readParticipant(APIstub, voyage.Carrier)
+	if err != nil {
+		return err
+	}
+	if assertCallerActsFor(APIstub, carrier.HashId) == nil || assertOrgAdmin(APIstub, carrier.MspId) == nil {
+		return nil
+	}
+	if carrier.OrganisationId != "" && assertCallerActsFor(APIstub, carrier.OrganisationId) == nil {
+		return nil
+	}
+	return fmt.Errorf("Caller does not work for %s, the carrier of Voyage %s", voyage.Carrier, voyage.VoyageId)
+}
+
+// createVoyage - args: voyageId, carrier, mode (Sea, Air, Rail or Road), vehicleId (IMO number for Sea, else flight number or plate),
+// portCalls (JSON, e.g. [{"port":"Mumbai","plannedEtd":"2026-03-02T00:00:00Z"},{"port":"Rotterdam","plannedEta":"2026-03-20T00:00:00Z"}])
+func (s *SmartContract) createVoyage(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 5")
+	}
+
+	voyage, voyageKey, err := readVoyage(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get voyage: " + err.Error())
+	} else if voyage != nil {
+		return shim.Error("This Voyage already exists. VoyageId: " + args[0])
+	}
+
+	switch args[2] {
+	case "Sea":
+		if err := validateImoNumber(args[3]); err != nil {
+			return shim.Error(err.Error())
+		}
+	case "Air", "Rail", "Road":
+		if args[3] == "" {
+			return shim.Error("A Voyage needs a vehicle id")
+		}
+	default:
+		return shim.Error("Invalid transport mode " + args[2] + ". Expecting Sea, Air, Rail or Road")
+	}
+
+	var portCalls []PortCall
+	if err := json.Unmarshal([]byte(args[4]), &portCalls); err != nil {
+		return shim.Error("Failed to decode port calls: " + err.Error())
+	}
+	for i := range portCalls {
+		portCalls[i].ActualEta = ""
+		portCalls[i].ActualEtd = ""
+	}
+	if err := validatePortCalls(portCalls); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	carrier, err := readParticipant(APIstub, args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if carrier.Role != "Transporter" {
+		return shim.Error("Participant " + args[1] + " is not a Transporter")
+	}
+	if err := assertNotSuspended(APIstub, args[1]); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	voyage = &Voyage{VoyageId: args[0], Carrier: args[1], Mode: args[2], VehicleId: args[3], PortCalls: portCalls, CargoIds: []string{}, Status: "Scheduled"}
+	if err := voyage.assertCallerOperates(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err := putObject(APIstub, voyageKey, voyage); err != nil {
+		return shim.Error("Failed to record voyage: " + err.Error())
+	}
+	if err := setKeyEndorsementOrgs(APIstub, voyageKey, carrier.MspId); err != nil {
+		return shim.Error("Failed to set endorsement policy: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// assignCargoToVoyage - args: cargoHashId, voyageId. The Voyage has to call at the Cargo's origin before its destination
+// and not have left the origin yet. A Cargo already on another Voyage is moved off it. The caller must act for the Cargo's
+// owner; a carrier cannot put someone else's Cargo on its Voyage.
+func (s *SmartContract) assignCargoToVoyage(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	cargo, err := readCargo(APIstub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if cargo.Status != "Ready" {
+		return shim.Error("Only Ready Cargo can be assigned to a Voyage. Cargo status is " + cargo.Status)
+	} else if cargo.VoyageId == args[1] {
+		return shim.Error("Cargo is already assigned to Voyage " + args[1])
+	}
+
+	voyage, voyageKey, err := readVoyage(APIstub, args[1])
+	if err != nil {
+		return shim.Error("Failed to get voyage: " + err.Error())
+	} else if voyage == nil {
+		return shim.Error("Voyage does not exist. VoyageId: " + args[1])
+	}
+	if err := assertCallerActsFor(APIstub, cargo.Owner); err != nil {
+		return shim.Error(err.Error())
+	}
+	origin, destination := voyage.portCallIndex(cargo.ShippedFrom), voyage.portCallIndex(cargo.ShippedTo)
+	if origin < 0 || destination <= origin {
+		return shim.Error(fmt.Sprintf("Voyage %s does not call at %s and then %s", args[1], cargo.ShippedFrom, cargo.ShippedTo))
+	} else if voyage.PortCalls[origin].ActualEtd != "" {
+		return shim.Error("Voyage " + args[1] + " has already left " + cargo.ShippedFrom)
+	}
+	if err := assertNotSuspended(APIstub, voyage.Carrier); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if cargo.VoyageId != "" {
+		previous, previousKey, err := readVoyage(APIstub, cargo.VoyageId)
+		if err != nil {
+			return shim.Error("Failed to get voyage: " + err.Error())
+		}
+		if previous != nil {
+			cargoIds := []string{}
+			for _, cargoId := range previous.CargoIds {
+				if cargoId != args[0] {
+					cargoIds = append(cargoIds, cargoId)
+				}
+			}
+			previous.CargoIds = cargoIds
+			if err := putObject(APIstub, previousKey, previous); err != nil {
+				return shim.Error("Failed to update voyage: " + err.Error())
+			}
+		}
+	}
+
+	voyage.CargoIds = append(voyage.CargoIds, args[0])
+	cargo.VoyageId = args[1]
+	cargo.TransportationType = voyage.Mode
+
+	if err := putObject(APIstub, voyageKey, voyage); err != nil {
+		return shim.Error("Failed to update voyage: " + err.Error())
+	}
+	if err := putObject(APIstub, args[0], cargo); err != nil {
+		return shim.Error("Failed to update Cargo: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// updatePortCallEta - args: voyageId, port, plannedEta, plannedEtd (RFC3339; empty leaves the time unchanged).
+// Emits a VoyageScheduleChanged event listing the Cargos on the Voyage.
+func (s *SmartContract) updatePortCallEta(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting 4")
+	}
+
+	voyage, voyageKey, err := readVoyage(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get voyage: " + err.Error())
+	} else if voyage == nil {
+		return shim.Error("Voyage does not exist. VoyageId: " + args[0])
+	}
+	if err := voyage.assertCallerOperates(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+	index := voyage.portCallIndex(args[1])
+	if index < 0 {
+		return shim.Error("Voyage " + args[0] + " does not call at " + args[1])
+	}
+	portCall := &voyage.PortCalls[index]
+
+	event := VoyageEvent{VoyageId: args[0], Port: args[1], PreviousEta: portCall.PlannedEta, PreviousEtd: portCall.PlannedEtd, CargoIds: voyage.CargoIds}
+
+	if args[2] != "" {
+		if portCall.ActualEta != "" {
+			return shim.Error("Voyage has already arrived at " + args[1])
+		}
+		portCall.PlannedEta = args[2]
+	}
+	if args[3] != "" {
+		if portCall.ActualEtd != "" {
+			return shim.Error("Voyage has already left " + args[1])
+		}
+		portCall.PlannedEtd = args[3]
+	}
+	if err := validatePortCalls(voyage.PortCalls); err != nil {
+		return shim.Error(err.Error())
+	}
+	event.Eta = portCall.PlannedEta
+	event.Etd = portCall.PlannedEtd
+
+	if err := putObject(APIstub, voyageKey, voyage); err != nil {
+		return shim.Error("Failed to update voyage: " + err.Error())
+	}
+	if err := emitVoyageEvent(APIstub, "VoyageScheduleChanged", event); err != nil {
+		return shim.Error("Failed to emit event: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// recordPortCallDeparture - args: voyageId, port, actualEtd (RFC3339).
+// Ready Cargos loaded at this port go In-Transit; every Container on them needs a VGM declaration.
+func (s *SmartContract) recordPortCallDeparture(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+	if _, err := time.Parse(time.RFC3339, args[2]); err != nil {
+		return shim.Error("actualEtd must be in RFC3339 format: " + err.Error())
+	}
+
+	voyage, voyageKey, err := readVoyage(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get voyage: " + err.Error())
+	} else if voyage == nil {
+		return shim.Error("Voyage does not exist. VoyageId: " + args[0])
+	}
+	if err := voyage.assertCallerOperates(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+	index := voyage.portCallIndex(args[1])
+	if index < 0 {
+		return shim.Error("Voyage " + args[0] + " does not call at " + args[1])
+	} else if voyage.PortCalls[index].ActualEtd != "" {
+		return shim.Error("Voyage has already left " + args[1])
+	} else if index == len(voyage.PortCalls)-1 {
+		return shim.Error(args[1] + " is the last port call of the Voyage")
+	} else if index > 0 && voyage.PortCalls[index].ActualEta == "" {
+		return shim.Error("Voyage has not arrived at " + args[1] + " yet")
+	}
+
+	voyage.PortCalls[index].ActualEtd = args[2]
+	voyage.Status = "Underway"
+
+	for _, cargoId := range voyage.CargoIds {
+		cargo, err := readCargo(APIstub, cargoId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if cargo.ShippedFrom != args[1] || cargo.Status != "Ready" {
+			continue
+		}
+		if err := assertContainersHaveVgm(APIstub, cargo.AssociatedContainerHashIds); err != nil {
+			return shim.Error(err.Error())
+		}
+		cargo.Status = "In-Transit"
+		cargo.Timestamp = args[2]
+		cargo.CargoLocation = args[1]
+
+		if err := putObject(APIstub, cargoId, cargo); err != nil {
+			return shim.Error("Failed to update Cargo: " + err.Error())
+		}
+		if err := evaluateCargoSla(APIstub, cargo, nil); err != nil {
+			return shim.Error("Failed to evaluate SLA: " + err.Error())
+		}
+	}
+
+	if err := putObject(APIstub, voyageKey, voyage); err != nil {
+		return shim.Error("Failed to update voyage: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// recordPortCallArrival - args: voyageId, port, actualEta (RFC3339).
+// Every Cargo in transit on the Voyage moves to the port, along with its Containers, and Cargos bound for it are Arrived.
+// Emits a VoyagePortCallArrived event listing the Cargos on the Voyage.
+func (s *SmartContract) recordPortCallArrival(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting 3")
+	}
+	if _, err := time.Parse(time.RFC3339, args[2]); err != nil {
+		return shim.Error("actualEta must be in RFC3339 format: " + err.Error())
+	}
+
+	voyage, voyageKey, err := readVoyage(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get voyage: " + err.Error())
+	} else if voyage == nil {
+		return shim.Error("Voyage does not exist. VoyageId: " + args[0])
+	}
+	if err := voyage.assertCallerOperates(APIstub); err != nil {
+		return shim.Error(err.Error())
+	}
+	index := voyage.portCallIndex(args[1])
+	if index < 0 {
+		return shim.Error("Voyage " + args[0] + " does not call at " + args[1])
+	} else if voyage.PortCalls[index].ActualEta != "" {
+		return shim.Error("Voyage has already arrived at " + args[1])
+	} else if index > 0 && voyage.PortCalls[index-1].ActualEtd == "" {
+		return shim.Error("Voyage has not left " + voyage.PortCalls[index-1].Port + " yet")
+	}
+
+	voyage.PortCalls[index].ActualEta = args[2]
+	if index == len(voyage.PortCalls)-1 {
+		voyage.Status = "Completed"
+	}
+
+	for _, cargoId := range voyage.CargoIds {
+		cargo, err := readCargo(APIstub, cargoId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if cargo.Status != "In-Transit" {
+			continue
+		}
+		cargo.Timestamp = args[2]
+		cargo.CargoLocation = args[1]
+		if cargo.ShippedTo == args[1] {
+			cargo.Status = "Arrived"
+		}
+
+		if err := putObject(APIstub, cargoId, cargo); err != nil {
+			return shim.Error("Failed to update Cargo: " + err.Error())
+		}
+		if err := evaluateCargoSla(APIstub, cargo, nil); err != nil {
+			return shim.Error("Failed to evaluate SLA: " + err.Error())
+		}
+
+		for _, containerHashId := range cargo.AssociatedContainerHashIds {
+			container, err := readContainer(APIstub, containerHashId)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			container.ContainerLocation = args[1]
+			if err := putObject(APIstub, containerHashId, container); err != nil {
+				return shim.Error("Failed to update Container: " + err.Error())
+			}
+		}
+	}
+
+	if err := putObject(APIstub, voyageKey, voyage); err != nil {
+		return shim.Error("Failed to update voyage: " + err.Error())
+	}
+
+	portCall := voyage.PortCalls[index]
+	event := VoyageEvent{VoyageId: args[0], Port: args[1], Eta: portCall.ActualEta, Etd: portCall.PlannedEtd, CargoIds: voyage.CargoIds}
+	if err := emitVoyageEvent(APIstub, "VoyagePortCallArrived", event); err != nil {
+		return shim.Error("Failed to emit event: " + err.Error())
+	}
+
+	return shim.Success(nil)
+}
+
+// getVoyage - args: voyageId
+func (s *SmartContract) getVoyage(APIstub shim.ChaincodeStubInterface, args []string) sc.Response {
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting 1")
+	}
+
+	voyage, _, err := readVoyage(APIstub, args[0])
+	if err != nil {
+		return shim.Error("Failed to get voyage: " + err.Error())
+	} else if voyage == nil {
+		return shim.Error("Voyage does not exist. VoyageId: " + args[0])
+	}
+
+	voyageAsBytes, _ := json.Marshal(voyage)
+	return shim.Success(voyageAsBytes)
+}
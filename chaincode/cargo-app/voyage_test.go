@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+func TestValidateImoNumber(t *testing.T) {
+	tests := []struct {
+		imoNumber string
+		wantErr   bool
+	}{
+		{"IMO9074729", false},
+		{"IMO9176187", false},
+		{"IMO9074728", true},
+		{"9074729", true},
+		{"IMO907472", true},
+		{"imo9074729", true},
+	}
+	for _, test := range tests {
+		if err := validateImoNumber(test.imoNumber); (err != nil) != test.wantErr {
+			t.Errorf("validateImoNumber(%s) = %v, wantErr %v", test.imoNumber, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidatePortCalls(t *testing.T) {
+	tests := []struct {
+		name      string
+		portCalls []PortCall
+		wantErr   bool
+	}{
+		{"forward", []PortCall{{Port: "Mumbai", PlannedEtd: "2020-03-02T00:00:00Z"}, {Port: "Rotterdam", PlannedEta: "2020-03-20T00:00:00Z"}}, false},
+		{"unplanned", []PortCall{{Port: "Mumbai"}, {Port: "Rotterdam"}}, false},
+		{"one call", []PortCall{{Port: "Mumbai"}}, true},
+		{"repeated port", []PortCall{{Port: "Mumbai"}, {Port: "Mumbai"}}, true},
+		{"backwards", []PortCall{{Port: "Mumbai", PlannedEtd: "2020-03-20T00:00:00Z"}, {Port: "Rotterdam", PlannedEta: "2020-03-02T00:00:00Z"}}, true},
+		{"not RFC3339", []PortCall{{Port: "Mumbai", PlannedEtd: "02/03/2020"}, {Port: "Rotterdam"}}, true},
+	}
+	for _, test := range tests {
+		if err := validatePortCalls(test.portCalls); (err != nil) != test.wantErr {
+			t.Errorf("%s: validatePortCalls() = %v, wantErr %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestVoyageCallers(t *testing.T) {
+	stub := newTestStub(t)
+	stub.asAdmin(testMspId).mustInvoke("registerOrganisation", "LINE", "Line Shipping", testMspId, "SG", "Transporter", "")
+	for _, hashId := range []string{"CARRIER", "CREW"} {
+		stub.asAdmin(testMspId).mustInvoke("registerParticipant", hashId, hashId+" Ltd", "ops@line.example.com", "Transporter", "LINE")
+	}
+	stub.registerTestParticipant(testMspId, "SHIPPER", "Exporter")
+	stub.registerTestParticipant(testMspId, "OUTSIDER", "Transporter")
+	stub.registerTestParticipant(otherTestMspId, "FOREIGN", "Transporter")
+	stub.seedTestRecord("Cargo", "CG1", "SHIPPER", Cargo{HashId: "CG1", Owner: "SHIPPER", Status: "Ready", ShippedFrom: "Mumbai", ShippedTo: "Rotterdam", AssociatedContainerHashIds: []string{}})
+
+	portCalls := `[{"port":"Mumbai","plannedEtd":"2020-03-02T00:00:00Z"},{"port":"Rotterdam","plannedEta":"2020-03-20T00:00:00Z"}]`
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("does not work for CARRIER", "createVoyage", "V1", "CARRIER", "Sea", "IMO9074729", portCalls)
+	stub.asParticipant(testMspId, "CARRIER").mustInvoke("createVoyage", "V1", "CARRIER", "Sea", "IMO9074729", portCalls)
+
+	stub.asParticipant(testMspId, "OUTSIDER").mustFail("not participant SHIPPER", "assignCargoToVoyage", "CG1", "V1")
+	// The carrier cannot take someone else's Cargo onto its Voyage.
+	stub.asParticipant(testMspId, "CARRIER").mustFail("not participant SHIPPER", "assignCargoToVoyage", "CG1", "V1")
+	stub.asParticipant(testMspId, "CREW").mustFail("not participant SHIPPER", "assignCargoToVoyage", "CG1", "V1")
+	stub.asParticipant(testMspId, "SHIPPER").mustInvoke("assignCargoToVoyage", "CG1", "V1")
+
+	tests := []struct {
+		function string
+		args     []string
+	}{
+		{"updatePortCallEta", []string{"V1", "Rotterdam", "2020-03-21T00:00:00Z", ""}},
+		{"recordPortCallDeparture", []string{"V1", "Mumbai", "2020-03-02T06:00:00Z"}},
+		{"recordPortCallArrival", []string{"V1", "Rotterdam", "2020-03-21T06:00:00Z"}},
+	}
+	for _, test := range tests {
+		stub.asParticipant(testMspId, "SHIPPER").mustFail("does not work for CARRIER", test.function, test.args...)
+		stub.asParticipant(otherTestMspId, "FOREIGN").mustFail("does not work for CARRIER", test.function, test.args...)
+		stub.asAdmin(otherTestMspId).mustFail("does not work for CARRIER", test.function, test.args...)
+		// Anyone in the carrier's organisation operates the Voyage.
+		stub.asParticipant(testMspId, "CREW").mustInvoke(test.function, test.args...)
+	}
+
+	var cargo Cargo
+	stub.readTestRecord("CG1", &cargo)
+	if cargo.Status != "Arrived" || cargo.CargoLocation != "Rotterdam" {
+		t.Errorf("cargo is %s at %s, want Arrived at Rotterdam", cargo.Status, cargo.CargoLocation)
+	}
+}